@@ -65,6 +65,16 @@ func main() {
 			fatalf(err.Error())
 		}
 		return
+	case "outbox":
+		if err := runOutbox(args); err != nil {
+			fatalf(err.Error())
+		}
+		return
+	case "state":
+		if err := runState(args); err != nil {
+			fatalf(err.Error())
+		}
+		return
 	case "run":
 		if err := runContext(context.Background(), args); err != nil {
 			fatalf(err.Error())
@@ -98,6 +108,12 @@ func runContext(parent context.Context, args []string) error {
 
 	ctx, stop := signal.NotifyContext(parent, syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
+	go func() {
+		// Restore default signal handling so a second signal exits immediately
+		// instead of waiting out the shutdown grace period.
+		<-ctx.Done()
+		stop()
+	}()
 
 	cfg, presetName, err := loadConfigWithPresets(*configPath, positional)
 	if err != nil {
@@ -117,7 +133,9 @@ func runContext(parent context.Context, args []string) error {
 
 	printBanner(cfg, "(computed later)", buildVer)
 
-	st, err := store.New(cfg.Storage.Path)
+	// Open without creating buckets so the migration's backup is the DB as
+	// the previous build left it; Init adds the buckets afterwards.
+	st, err := store.Open(cfg.Storage.Path)
 	if err != nil {
 		return fmt.Errorf("open store: %w", err)
 	}
@@ -126,6 +144,12 @@ func runContext(parent context.Context, args []string) error {
 			logger.Error("failed to close store", slog.String("err", err.Error()))
 		}
 	}()
+	if err := migrateStore(st, cfg, logger); err != nil {
+		return err
+	}
+	if err := st.Init(); err != nil {
+		return fmt.Errorf("init state DB: %w", err)
+	}
 
 	if !*skipCheck {
 		if err := runDepPreflight(cfg, presetName); err != nil {
@@ -139,7 +163,7 @@ func runContext(parent context.Context, args []string) error {
 	}
 
 	if *healthListen != "" {
-		if _, err := health.Start(ctx, *healthListen, buildVer, logger); err != nil {
+		if _, err := health.Start(ctx, *healthListen, buildVer, logger, health.WithTransports(runner.TransportStates)); err != nil {
 			return fmt.Errorf("start health: %w", err)
 		}
 	}
@@ -211,7 +235,7 @@ func parseSubcommand(args []string) (string, []string) {
 	}
 	first := args[0]
 	switch first {
-	case "presets", "wizard", "init-config", "check", "version", "help", "run":
+	case "presets", "wizard", "init-config", "check", "outbox", "state", "version", "help", "run":
 		return first, args[1:]
 	}
 	if strings.HasPrefix(first, "-") {
@@ -248,6 +272,8 @@ func usage() {
 	fmt.Fprintf(os.Stderr, "  wizard [config-path]      guided setup; supports dry-run\n")
 	fmt.Fprintf(os.Stderr, "  init-config [path]        write example config (default ./config.yaml)\n")
 	fmt.Fprintf(os.Stderr, "  presets [name]            list built-in presets or show one\n")
+	fmt.Fprintf(os.Stderr, "  outbox [list|replay <id>] inspect or replay dead-lettered replies\n")
+	fmt.Fprintf(os.Stderr, "  state migrate [-dry-run]  upgrade the state DB schema (or report what would change)\n")
 	fmt.Fprintf(os.Stderr, "  version                   show version\n")
 	fmt.Fprintf(os.Stderr, "  help [command]            show help\n\n")
 	fmt.Fprintf(os.Stderr, "Env: %s (preferred)\n", envConfigNew)
@@ -360,6 +386,17 @@ func printHelp(args []string) {
 		fmt.Println("Flags:")
 		fmt.Println("  -config <path>          config file path (default search: argv, ./config.yaml, ~/.config/buddy/config.yaml)")
 		fmt.Println("  -json                   output JSON report")
+	case "outbox":
+		fmt.Println("buddy outbox [list|replay <id|all>] - inspect or requeue replies that exhausted their retries")
+		fmt.Println("Run with buddy stopped (the state DB is locked while it runs); requeued replies are sent on the next start.")
+		fmt.Println("Flags:")
+		fmt.Println("  -config <path>          config file path (locates storage.path)")
+	case "state":
+		fmt.Println("buddy state migrate [-dry-run] - upgrade the state DB to this build's schema, backing it up first")
+		fmt.Println("buddy run migrates at startup too; run with buddy stopped (the state DB is locked while it runs).")
+		fmt.Println("Flags:")
+		fmt.Println("  -config <path>          config file path (locates storage.path)")
+		fmt.Println("  -dry-run                report what would change without touching the DB")
 	case "version":
 		fmt.Println("buddy version - print version")
 	default:
@@ -506,3 +543,33 @@ func runInitConfig(args []string) error {
 	fmt.Printf("Wrote example config to %s\n", path)
 	return nil
 }
+
+// migrateStore brings the state DB up to the current schema, backing it up
+// first, and restores keys an earlier migration held back.
+func migrateStore(st *store.Store, cfg *config.Config, logger *slog.Logger) error {
+	transportFor := app.LegacyTransport(cfg)
+	rep, err := st.Migrate(store.MigrationEnv{TransportFor: transportFor}, false)
+	if err != nil {
+		return fmt.Errorf("migrate state DB: %w", err)
+	}
+	// Keys held back for want of a transport move into place once the config
+	// has one.
+	n, err := st.ReleaseHeld(transportFor)
+	if err != nil {
+		return fmt.Errorf("restore held state keys: %w", err)
+	}
+	if n > 0 {
+		logger.Info("restored held state keys", slog.Int("keys", n))
+	}
+	if !rep.Pending() {
+		return nil
+	}
+	for _, step := range rep.Steps {
+		for _, note := range step.Notes {
+			logger.Warn("state migration", slog.Int("version", step.Version), slog.String("note", note))
+		}
+		logger.Info("applied state migration", slog.Int("version", step.Version), slog.String("migration", step.Description), slog.Int("changed", step.Changed))
+	}
+	logger.Info("migrated state DB", slog.Int("from", rep.From), slog.Int("to", rep.To), slog.String("backup", rep.Backup))
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/joelklabo/buddy/internal/store"
+)
+
+// runOutbox inspects and replays dead-lettered outbound messages. The state DB is
+// locked while buddy runs, so this is meant to be used with the runner stopped;
+// replayed messages are sent when it starts again.
+func runOutbox(args []string) error {
+	fs := flag.NewFlagSet("outbox", flag.ExitOnError)
+	configPath := fs.String("config", defaultConfigPath(), "Path to config.yaml")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	rest := fs.Args()
+	if len(rest) == 0 {
+		rest = []string{"list"}
+	}
+
+	cfg, _, err := loadConfigWithPresets(*configPath, "")
+	if err != nil {
+		return err
+	}
+	st, err := store.New(cfg.Storage.Path)
+	if err != nil {
+		return fmt.Errorf("open store %s (is buddy running?): %w", cfg.Storage.Path, err)
+	}
+	defer func() { _ = st.Close() }()
+
+	switch rest[0] {
+	case "list":
+		return listDeadLetters(os.Stdout, st)
+	case "replay":
+		if len(rest) != 2 {
+			return fmt.Errorf("usage: buddy outbox replay <id|all>")
+		}
+		return replayDeadLetters(os.Stdout, st, rest[1])
+	default:
+		return fmt.Errorf("unknown outbox command %q (want list or replay)", rest[0])
+	}
+}
+
+func listDeadLetters(w io.Writer, st *store.Store) error {
+	dead, err := st.DeadLetters()
+	if err != nil {
+		return err
+	}
+	if len(dead) == 0 {
+		fmt.Fprintln(w, "No dead letters.")
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTRANSPORT\tRECIPIENT\tATTEMPTS\tCREATED\tLAST ERROR\tTEXT")
+	for _, e := range dead {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\t%s\n", e.ID, e.Transport, e.Recipient, e.Attempts,
+			e.CreatedAt.Local().Format(time.DateTime), oneLine(e.LastError, 40), oneLine(e.Text, 40))
+	}
+	return tw.Flush()
+}
+
+func replayDeadLetters(w io.Writer, st *store.Store, id string) error {
+	ids := []string{id}
+	if id == "all" {
+		dead, err := st.DeadLetters()
+		if err != nil {
+			return err
+		}
+		ids = ids[:0]
+		for _, e := range dead {
+			ids = append(ids, e.ID)
+		}
+	}
+	for _, id := range ids {
+		if _, err := st.ReplayDeadLetter(id); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "Requeued %s; it will be sent when buddy runs.\n", id)
+	}
+	return nil
+}
+
+func oneLine(s string, max int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > max {
+		return string(r[:max-1]) + "…"
+	}
+	return s
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joelklabo/buddy/internal/store"
+)
+
+func TestOutboxListAndReplay(t *testing.T) {
+	st, err := store.New(filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	defer func() { _ = st.Close() }()
+
+	id, _ := st.EnqueueOutbox(store.OutboxEntry{Transport: "nostr", Recipient: "alice", Text: "the\nanswer"})
+	if err := st.DeadLetter(store.OutboxEntry{ID: id, Transport: "nostr", Recipient: "alice", Text: "the\nanswer", Attempts: 8, LastError: "relay down"}); err != nil {
+		t.Fatalf("dead letter: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := listDeadLetters(&out, st); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if !strings.Contains(out.String(), id) || !strings.Contains(out.String(), "the answer") || !strings.Contains(out.String(), "relay down") {
+		t.Fatalf("unexpected listing:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := replayDeadLetters(&out, st, "all"); err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if dead, _ := st.DeadLetters(); len(dead) != 0 {
+		t.Fatalf("dead letters left after replay: %+v", dead)
+	}
+	out.Reset()
+	_ = listDeadLetters(&out, st)
+	if strings.TrimSpace(out.String()) != "No dead letters." {
+		t.Fatalf("unexpected listing after replay: %q", out.String())
+	}
+}
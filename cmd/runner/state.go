@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/joelklabo/buddy/internal/app"
+	"github.com/joelklabo/buddy/internal/store"
+)
+
+// runState manages the state DB. "migrate" brings it to the current schema
+// (buddy run does the same at startup); with -dry-run it only reports what
+// would change. Like outbox, it needs buddy stopped to get at the DB.
+func runState(args []string) error {
+	if len(args) == 0 || args[0] != "migrate" {
+		return fmt.Errorf("usage: buddy state migrate [-dry-run] [-config path]")
+	}
+	fs := flag.NewFlagSet("state migrate", flag.ExitOnError)
+	configPath := fs.String("config", defaultConfigPath(), "Path to config.yaml")
+	dryRun := fs.Bool("dry-run", false, "Report what would change without touching the DB")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	cfg, _, err := loadConfigWithPresets(*configPath, "")
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(cfg.Storage.Path); os.IsNotExist(err) {
+		fmt.Printf("No state DB at %s; buddy creates it at schema v%d.\n", cfg.Storage.Path, store.SchemaVersion)
+		return nil
+	}
+	// Open leaves the DB as it is: a dry run must not change it, and the
+	// backup Migrate takes must be the DB before this build touched it.
+	st, err := store.Open(cfg.Storage.Path)
+	if err != nil {
+		return fmt.Errorf("open store %s (is buddy running?): %w", cfg.Storage.Path, err)
+	}
+	defer func() { _ = st.Close() }()
+
+	rep, err := st.Migrate(store.MigrationEnv{TransportFor: app.LegacyTransport(cfg)}, *dryRun)
+	if err != nil {
+		return err
+	}
+	printMigrationReport(os.Stdout, cfg.Storage.Path, rep)
+	return nil
+}
+
+func printMigrationReport(w io.Writer, path string, rep store.MigrationReport) {
+	if !rep.Pending() {
+		fmt.Fprintf(w, "State DB %s is up to date (schema v%d).\n", path, rep.To)
+		return
+	}
+	verb := "Migrated"
+	if rep.DryRun {
+		verb = "Would migrate"
+	}
+	fmt.Fprintf(w, "%s state DB %s from schema v%d to v%d:\n", verb, path, rep.From, rep.To)
+	for _, step := range rep.Steps {
+		fmt.Fprintf(w, "  v%d %s: %d keys rewritten\n", step.Version, step.Description, step.Changed)
+		for _, note := range step.Notes {
+			fmt.Fprintf(w, "      %s\n", note)
+		}
+	}
+	if rep.DryRun {
+		fmt.Fprintln(w, "Dry run: nothing was changed.")
+		return
+	}
+	fmt.Fprintf(w, "Backup of the previous DB: %s\n", rep.Backup)
+}
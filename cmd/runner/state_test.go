@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/joelklabo/buddy/internal/store"
+)
+
+func TestPrintMigrationReport(t *testing.T) {
+	rep := store.MigrationReport{From: 1, To: 2, DryRun: true, Steps: []store.MigrationStep{
+		{Version: 2, Description: "key state by transport", Changed: 3, Notes: []string{"dropped cursors/x: transport unknown"}},
+	}}
+	var out bytes.Buffer
+	printMigrationReport(&out, "state.db", rep)
+	for _, want := range []string{"Would migrate state DB state.db from schema v1 to v2", "v2 key state by transport: 3 keys rewritten", "dropped cursors/x", "nothing was changed"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("missing %q in:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	rep.DryRun, rep.Backup = false, "state.db.v1-20260101T000000.bak"
+	printMigrationReport(&out, "state.db", rep)
+	if !strings.Contains(out.String(), "Migrated state DB") || !strings.Contains(out.String(), rep.Backup) {
+		t.Fatalf("unexpected report:\n%s", out.String())
+	}
+
+	out.Reset()
+	printMigrationReport(&out, "state.db", store.MigrationReport{From: 2, To: 2})
+	if strings.TrimSpace(out.String()) != "State DB state.db is up to date (schema v2)." {
+		t.Fatalf("unexpected report: %q", out.String())
+	}
+}
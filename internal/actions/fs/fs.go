@@ -10,6 +10,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/joelklabo/buddy/internal/core"
 )
 
 // Config for filesystem actions.
@@ -44,7 +46,7 @@ func (r *ReadFile) Invoke(ctx context.Context, args json.RawMessage) (json.RawMe
 	if err := json.Unmarshal(args, &payload); err != nil {
 		return nil, fmt.Errorf("decode args: %w", err)
 	}
-	p, err := r.safePath(payload.Path)
+	p, err := safePath(ctx, r.cfg.Roots, payload.Path)
 	if err != nil {
 		return nil, err
 	}
@@ -100,7 +102,7 @@ func (w *WriteFile) Invoke(ctx context.Context, args json.RawMessage) (json.RawM
 	if err := json.Unmarshal(args, &payload); err != nil {
 		return nil, fmt.Errorf("decode args: %w", err)
 	}
-	p, err := w.safePath(payload.Path)
+	p, err := safePath(ctx, w.cfg.Roots, payload.Path)
 	if err != nil {
 		return nil, err
 	}
@@ -113,18 +115,33 @@ func (w *WriteFile) Invoke(ctx context.Context, args json.RawMessage) (json.RawM
 	return json.RawMessage(`"ok"`), nil
 }
 
-// safePath ensures path is within allowed roots.
-func (r *ReadFile) safePath(p string) (string, error)  { return safePath(r.cfg.Roots, p) }
-func (w *WriteFile) safePath(p string) (string, error) { return safePath(w.cfg.Roots, p) }
-
-func safePath(roots []string, p string) (string, error) {
+// safePath ensures path is within allowed roots. When ctx carries a project
+// working directory, relative paths are resolved against it and the path must
+// also lie inside it; the configured roots still apply, so a project never
+// widens access.
+func safePath(ctx context.Context, roots []string, p string) (string, error) {
 	if p == "" {
 		return "", errors.New("path required")
 	}
+	dir, inProject := core.WorkdirFrom(ctx)
+	if inProject && !filepath.IsAbs(p) {
+		p = filepath.Join(dir, p)
+	}
 	abs, err := filepath.Abs(p)
 	if err != nil {
 		return "", err
 	}
+	if inProject && !withinRoots(abs, []string{dir}) {
+		return "", fmt.Errorf("path outside project")
+	}
+	if len(roots) > 0 && !withinRoots(abs, roots) {
+		return "", fmt.Errorf("path outside allowed roots")
+	}
+	return abs, nil
+}
+
+// withinRoots reports whether abs is one of roots or below one of them.
+func withinRoots(abs string, roots []string) bool {
 	for _, root := range roots {
 		if root == "" {
 			continue
@@ -133,14 +150,11 @@ func safePath(roots []string, p string) (string, error) {
 		if err != nil {
 			continue
 		}
-		if strings.HasPrefix(abs, rAbs) {
-			return abs, nil
+		if rel, err := filepath.Rel(rAbs, abs); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
 		}
 	}
-	if len(roots) == 0 {
-		return abs, nil
-	}
-	return "", fmt.Errorf("path outside allowed roots")
+	return false
 }
 
 func isBinary(data []byte) bool {
@@ -6,6 +6,8 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/joelklabo/buddy/internal/core"
 )
 
 func TestReadFileAllowed(t *testing.T) {
@@ -97,10 +99,10 @@ func TestWriteFileSizeLimit(t *testing.T) {
 }
 
 func TestSafePathDefaults(t *testing.T) {
-	if _, err := safePath(nil, ""); err == nil {
+	if _, err := safePath(context.Background(), nil, ""); err == nil {
 		t.Fatalf("expected error on empty path")
 	}
-	p, err := safePath(nil, "./relative.txt")
+	p, err := safePath(context.Background(), nil, "./relative.txt")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -117,3 +119,34 @@ func TestIsBinaryHelper(t *testing.T) {
 		t.Fatalf("plain text should not be binary")
 	}
 }
+
+func TestProjectWorkdirNarrowsRoots(t *testing.T) {
+	root := t.TempDir()
+	project := filepath.Join(root, "app")
+	if err := os.MkdirAll(project, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(project, "README.md"), []byte("project"), 0o644); err != nil {
+		t.Fatalf("write seed file: %v", err)
+	}
+	rf := NewReadFile(Config{Roots: []string{root}})
+	ctx := core.WithWorkdir(context.Background(), project)
+
+	out, err := rf.Invoke(ctx, json.RawMessage(`{"path":"README.md"}`))
+	if err != nil || string(out) != `"project"` {
+		t.Fatalf("relative path not resolved in project: out=%s err=%v", out, err)
+	}
+	if _, err := rf.Invoke(ctx, json.RawMessage(`{"path":"`+filepath.Join(root, "x")+`"}`)); err == nil {
+		t.Fatalf("paths outside the project should be denied")
+	}
+
+	// A project outside the configured roots does not widen access.
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret"), []byte("s"), 0o644); err != nil {
+		t.Fatalf("write seed file: %v", err)
+	}
+	ctx = core.WithWorkdir(context.Background(), outside)
+	if _, err := rf.Invoke(ctx, json.RawMessage(`{"path":"secret"}`)); err == nil {
+		t.Fatalf("project outside fs roots should be denied")
+	}
+}
@@ -9,6 +9,9 @@ import (
 	"os/exec"
 	"strings"
 	"time"
+
+	"github.com/joelklabo/buddy/internal/commands"
+	"github.com/joelklabo/buddy/internal/core"
 )
 
 // Config controls the shell action.
@@ -34,6 +37,8 @@ func New(cfg Config) *Action {
 	return &Action{cfg: cfg}
 }
 
+var _ core.CommandAction = (*Action)(nil)
+
 func (a *Action) Name() string { return "shell" }
 
 func (a *Action) Capabilities() []string { return []string{"shell:exec"} }
@@ -42,6 +47,19 @@ func (a *Action) Help() string {
 	return "/shell <command> — execute a shell command (if enabled); obeys allowlist and timeouts."
 }
 
+// Command registers /shell; the rest of the line is the command, unparsed.
+func (a *Action) Command() commands.Spec {
+	return commands.Spec{Name: "shell", Usage: "<command>", Help: "run a shell command (obeys allowlist and timeouts)", Bare: true, RawArgs: true}
+}
+
+// CommandArgs builds the action arguments for /shell.
+func (a *Action) CommandArgs(cmd commands.Command) (json.RawMessage, error) {
+	if strings.TrimSpace(cmd.Args) == "" {
+		return nil, errors.New("Usage: /shell <command>")
+	}
+	return json.Marshal(map[string]string{"command": cmd.Args})
+}
+
 func (a *Action) Invoke(ctx context.Context, args json.RawMessage) (json.RawMessage, error) {
 	var payload struct {
 		Command string `json:"command"`
@@ -73,7 +91,9 @@ func (a *Action) Invoke(ctx context.Context, args json.RawMessage) (json.RawMess
 	defer cancel()
 
 	cmd := exec.CommandContext(cctx, "bash", "-lc", cmdStr)
-	if a.cfg.Workdir != "" {
+	if dir, ok := core.WorkdirFrom(ctx); ok {
+		cmd.Dir = dir
+	} else if a.cfg.Workdir != "" {
 		cmd.Dir = a.cfg.Workdir
 	}
 	out, err := cmd.CombinedOutput()
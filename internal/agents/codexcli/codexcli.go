@@ -4,6 +4,7 @@ package codexcli
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/joelklabo/buddy/internal/codex"
 	"github.com/joelklabo/buddy/internal/config"
@@ -15,7 +16,8 @@ type Config config.CodexConfig
 
 // Agent wraps the Codex CLI runner.
 type Agent struct {
-	runner runnerIface
+	runner  runnerIface
+	workdir string // configured working dir; attachments are staged under it
 }
 
 // runnerIface allows substitution in tests.
@@ -25,14 +27,55 @@ type runnerIface interface {
 }
 
 func New(cfg Config) *Agent {
-	return &Agent{runner: codex.New(config.CodexConfig(cfg))}
+	return &Agent{runner: codex.New(config.CodexConfig(cfg)), workdir: cfg.WorkingDir}
+}
+
+// EnforcesSandbox reports that Codex runs each request under its Sandbox level.
+func (a *Agent) EnforcesSandbox() bool { return true }
+
+// GenerateStream runs like Generate and reports Codex item events to emit.
+func (a *Agent) GenerateStream(ctx context.Context, req core.AgentRequest, emit func(core.AgentEvent)) (core.AgentResponse, error) {
+	ctx = codex.WithEvents(ctx, func(ev codex.Event) {
+		emit(core.AgentEvent{Kind: ev.Kind, Text: ev.Text})
+	})
+	return a.Generate(ctx, req)
 }
 
 func (a *Agent) Generate(ctx context.Context, req core.AgentRequest) (core.AgentResponse, error) {
-	if req.Prompt == "" {
-		return core.AgentResponse{}, fmt.Errorf("prompt is empty")
+	if req.Prompt == "" && len(req.Attachments) == 0 {
+		return core.AgentResponse{}, core.Permanent(fmt.Errorf("prompt is empty"))
+	}
+	if req.Sandbox != "" {
+		ctx = codex.WithSandbox(ctx, req.Sandbox)
+	}
+	if req.WorkingDir != "" {
+		ctx = codex.WithWorkingDir(ctx, req.WorkingDir)
+	}
+	prompt := req.Prompt
+	if len(req.Attachments) > 0 {
+		dir := req.WorkingDir
+		if dir == "" {
+			dir = a.workdir
+		}
+		if dir == "" {
+			dir = "."
+		}
+		staged, err := core.StageAttachments(ctx, codex.ExpandPath(dir), req.Attachments)
+		if err != nil {
+			return core.AgentResponse{}, core.Permanent(err)
+		}
+		var images []string
+		for _, att := range staged {
+			if strings.HasPrefix(att.MIMEType, "image/") {
+				images = append(images, att.Path)
+			}
+		}
+		if len(images) > 0 {
+			ctx = codex.WithImages(ctx, images)
+		}
+		prompt = strings.TrimSpace(prompt + core.AttachmentsPrompt(staged))
 	}
-	res, err := a.runner.Run(ctx, "", req.Prompt)
+	res, err := a.runner.Run(ctx, req.SessionID, prompt)
 	if err != nil {
 		return core.AgentResponse{}, err
 	}
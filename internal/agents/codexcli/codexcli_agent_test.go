@@ -3,6 +3,9 @@ package codexcli
 import (
 	"context"
 	"errors"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/joelklabo/buddy/internal/codex"
@@ -10,11 +13,15 @@ import (
 )
 
 type fakeRunner struct {
-	reply string
-	err   error
+	reply   string
+	err     error
+	session string
+	prompt  string
 }
 
 func (f *fakeRunner) Run(ctx context.Context, sessionID string, prompt string) (codex.Result, error) {
+	f.session = sessionID
+	f.prompt = prompt
 	return codex.Result{Reply: f.reply, SessionID: "s1"}, f.err
 }
 
@@ -46,3 +53,41 @@ func TestGenerateRunnerError(t *testing.T) {
 		t.Fatalf("expected error")
 	}
 }
+
+func TestGenerateResumesSession(t *testing.T) {
+	fr := &fakeRunner{reply: "ok"}
+	ag := &Agent{runner: fr}
+	if _, err := ag.Generate(context.Background(), core.AgentRequest{Prompt: "hi", SessionID: "s1"}); err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if fr.session != "s1" {
+		t.Fatalf("expected session s1 passed to runner, got %q", fr.session)
+	}
+}
+
+func TestGenerateStagesAttachments(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "shot.png")
+	if err := os.WriteFile(src, []byte("png"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	work := t.TempDir()
+	fr := &fakeRunner{reply: "ok"}
+	ag := &Agent{runner: fr, workdir: work}
+	att := core.Attachment{Name: "shot.png", MIMEType: "image/png", Size: 3, Path: src}
+	ctx, cleanup := core.WithAttachmentStaging(context.Background())
+	defer cleanup()
+	if _, err := ag.Generate(ctx, core.AgentRequest{Attachments: []core.Attachment{att}}); err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	matches, _ := filepath.Glob(filepath.Join(work, ".buddy", "attachments", "*", "shot.png"))
+	if len(matches) != 1 {
+		t.Fatalf("attachment not staged: %v", matches)
+	}
+	staged := matches[0]
+	if data, err := os.ReadFile(staged); err != nil || string(data) != "png" {
+		t.Fatalf("attachment not staged: %q, %v", data, err)
+	}
+	if !strings.Contains(fr.prompt, "Attached files:\n- shot.png (image/png, 3 bytes): "+staged) {
+		t.Fatalf("prompt does not list the file: %q", fr.prompt)
+	}
+}
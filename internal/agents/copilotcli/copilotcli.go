@@ -38,12 +38,36 @@ func New(cfg Config) *Agent {
 	return &Agent{cfg: cfg}
 }
 
+// EnforcesSandbox reports that the Copilot CLI has no sandbox levels, so
+// AgentRequest.Sandbox is not applied.
+func (a *Agent) EnforcesSandbox() bool { return false }
+
 func (a *Agent) Generate(ctx context.Context, req core.AgentRequest) (core.AgentResponse, error) {
 	timeout := time.Duration(a.cfg.TimeoutSeconds) * time.Second
 	cctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	args := []string{"-p", strings.TrimSpace(req.Prompt)}
+	dir := req.WorkingDir
+	if dir == "" {
+		dir = a.cfg.WorkingDir
+	}
+	prompt := strings.TrimSpace(req.Prompt)
+	if len(req.Attachments) > 0 {
+		stageDir := dir
+		if stageDir == "" {
+			stageDir = "."
+		}
+		staged, err := core.StageAttachments(cctx, stageDir, req.Attachments)
+		if err != nil {
+			return core.AgentResponse{}, core.Permanent(err)
+		}
+		prompt = strings.TrimSpace(prompt + core.AttachmentsPrompt(staged))
+	}
+
+	args := []string{"-p", prompt}
+	if req.SessionID != "" {
+		args = append(args, "--resume", req.SessionID)
+	}
 	if a.cfg.AllowAllTools {
 		args = append(args, "--allow-all-tools")
 	}
@@ -52,9 +76,7 @@ func (a *Agent) Generate(ctx context.Context, req core.AgentRequest) (core.Agent
 	}
 
 	cmd := exec.CommandContext(cctx, a.cfg.Binary, args...)
-	if a.cfg.WorkingDir != "" {
-		cmd.Dir = a.cfg.WorkingDir
-	}
+	cmd.Dir = dir
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
@@ -64,7 +86,7 @@ func (a *Agent) Generate(ctx context.Context, req core.AgentRequest) (core.Agent
 		if cctx.Err() == context.DeadlineExceeded {
 			return core.AgentResponse{}, fmt.Errorf("copilot timeout")
 		}
-		return core.AgentResponse{}, fmt.Errorf("copilot failed: %v (stderr: %s)", err, stderr.String())
+		return core.AgentResponse{}, fmt.Errorf("copilot failed: %w (stderr: %s)", err, stderr.String())
 	}
 
 	reply := strings.TrimSpace(stdout.String())
@@ -72,8 +94,11 @@ func (a *Agent) Generate(ctx context.Context, req core.AgentRequest) (core.Agent
 		reply = "(no output from copilot)"
 	}
 
+	// Copilot does not report session ids in prompt mode; echo back the resumed one
+	// so the runner keeps the conversation bound to it.
 	return core.AgentResponse{
 		Reply:       reply,
+		SessionID:   req.SessionID,
 		ActionCalls: nil,
 	}, nil
 }
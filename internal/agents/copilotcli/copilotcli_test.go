@@ -77,3 +77,24 @@ func TestCopilotAgentAllowAllTools(t *testing.T) {
 	}
 	time.Sleep(10 * time.Millisecond) // ensure script finished
 }
+
+func TestCopilotAgentResumesSession(t *testing.T) {
+	td := t.TempDir()
+	bin := filepath.Join(td, "args")
+	script := "#!/usr/bin/env bash\necho \"$@\"\n"
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+
+	ag := New(Config{Binary: bin, TimeoutSeconds: 2})
+	resp, err := ag.Generate(context.Background(), core.AgentRequest{Prompt: "prompt", SessionID: "abc"})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if !strings.Contains(resp.Reply, "--resume abc") {
+		t.Fatalf("expected resume flag in args: %s", resp.Reply)
+	}
+	if resp.SessionID != "abc" {
+		t.Fatalf("expected session echoed back, got %q", resp.SessionID)
+	}
+}
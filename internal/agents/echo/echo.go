@@ -7,12 +7,12 @@ import (
 	"github.com/joelklabo/buddy/internal/core"
 )
 
-// Agent echoes prompts; intended for tests and examples.
+// Agent echoes prompts and attachments; intended for tests and examples.
 type Agent struct{}
 
 func New() *Agent { return &Agent{} }
 
 func (a *Agent) Generate(ctx context.Context, req core.AgentRequest) (core.AgentResponse, error) {
 	reply := req.Prompt
-	return core.AgentResponse{Reply: reply}, nil
+	return core.AgentResponse{Reply: reply, Attachments: req.Attachments}, nil
 }
@@ -25,5 +25,5 @@ func New(cfg Config) *Agent {
 }
 
 func (a *Agent) Generate(ctx context.Context, req core.AgentRequest) (core.AgentResponse, error) {
-	return core.AgentResponse{}, errors.New("http agent not implemented")
+	return core.AgentResponse{}, core.Permanent(errors.New("http agent not implemented"))
 }
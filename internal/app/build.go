@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/joelklabo/buddy/internal/actions/fs"
@@ -24,17 +26,22 @@ import (
 
 // Build constructs transports, agent, and actions from config.
 func Build(cfg *config.Config, st *store.Store, logger *slog.Logger) (*core.Runner, error) {
+	spool, err := buildSpool(cfg.Attachments)
+	if err != nil {
+		return nil, err
+	}
 	transports := make([]core.Transport, 0, len(cfg.Transports))
 	for _, t := range cfg.Transports {
 		switch t.Type {
 		case "nostr":
-			nt, err := tnostr.New(tnostr.Config{Relays: t.Relays, PrivateKey: t.PrivateKey, AllowedPubkeys: t.AllowedPubkeys}, st)
+			allowed := append(append([]string{}, t.AllowedPubkeys...), cfg.UserIdentities(t.RuntimeID())...)
+			nt, err := tnostr.New(tnostr.Config{ID: t.RuntimeID(), Relays: t.Relays, PrivateKey: t.PrivateKey, AllowedPubkeys: allowed}, st)
 			if err != nil {
 				return nil, err
 			}
 			transports = append(transports, nt)
 		case "mock":
-			transports = append(transports, tmock.New(t.ID))
+			transports = append(transports, tmock.New(t.RuntimeID()))
 		case "email":
 			mode, _ := t.Config["mode"].(string)
 			if mode == "" {
@@ -46,9 +53,9 @@ func Build(cfg *config.Config, st *store.Store, logger *slog.Logger) (*core.Runn
 				if err := decodeMap(t.Config, &mcfg); err != nil {
 					return nil, fmt.Errorf("decode mailgun config: %w", err)
 				}
-				if mcfg.ID == "" {
-					mcfg.ID = t.ID
-				}
+				mcfg.ID = t.RuntimeID()
+				mcfg.Spool = spool
+				mcfg.AllowSenders = append(mcfg.AllowSenders, cfg.UserIdentities(t.RuntimeID())...)
 				mt, err := memg.New(mcfg)
 				if err != nil {
 					return nil, err
@@ -59,10 +66,15 @@ func Build(cfg *config.Config, st *store.Store, logger *slog.Logger) (*core.Runn
 				if err := decodeMap(t.Config, &icfg); err != nil {
 					return nil, fmt.Errorf("decode imap config: %w", err)
 				}
-				if icfg.ID == "" {
-					icfg.ID = t.ID
+				icfg.ID = t.RuntimeID()
+				icfg.Spool = spool
+				if ids := cfg.UserIdentities(t.RuntimeID()); len(ids) > 0 {
+					if len(icfg.AllowSenders) == 0 {
+						icfg.AllowSenders = []string{icfg.Username} // keep the default when adding users
+					}
+					icfg.AllowSenders = append(icfg.AllowSenders, ids...)
 				}
-				it, err := imap.New(icfg)
+				it, err := imap.New(icfg, logger)
 				if err != nil {
 					return nil, err
 				}
@@ -75,9 +87,10 @@ func Build(cfg *config.Config, st *store.Store, logger *slog.Logger) (*core.Runn
 			if err := decodeMap(t.Config, &wcfg); err != nil {
 				return nil, fmt.Errorf("decode whatsapp config: %w", err)
 			}
-			// fallback to ID if provided at top-level
-			if wcfg.ID == "" {
-				wcfg.ID = t.ID
+			wcfg.ID = t.RuntimeID()
+			wcfg.Spool = spool
+			if len(wcfg.AllowedNumbers) > 0 { // empty accepts every number; users must not narrow it
+				wcfg.AllowedNumbers = append(wcfg.AllowedNumbers, cfg.UserIdentities(t.RuntimeID())...)
 			}
 			wt, err := twa.New(wcfg, logger)
 			if err != nil {
@@ -89,25 +102,37 @@ func Build(cfg *config.Config, st *store.Store, logger *slog.Logger) (*core.Runn
 		}
 	}
 
-	agentCfg := cfg.Agent.Config
-	var agent core.Agent
-	switch cfg.Agent.Type {
-	case "codexcli", "":
-		agent = codexcli.New(codexcli.Config(agentCfg))
-	case "echo":
-		agent = echo.New()
-	case "http":
-		agent = http.New(http.Config{APIBase: agentCfg.Binary, Model: agentCfg.Profile}) // placeholder reuse fields
-	case "copilotcli":
-		agent = copilotcli.New(copilotcli.Config{
-			Binary:         agentCfg.Binary,
-			WorkingDir:     agentCfg.WorkingDir,
-			TimeoutSeconds: agentCfg.TimeoutSeconds,
-			AllowAllTools:  false,
-			ExtraArgs:      agentCfg.ExtraArgs,
-		})
-	default:
-		return nil, fmt.Errorf("unknown agent type %s", cfg.Agent.Type)
+	// With an agents list the first entry is the default and `agent` is unused.
+	agent, err := buildAgent(cfg.Agent)
+	if err != nil {
+		return nil, err
+	}
+	defaultAgent := ""
+	namedAgents := map[string]core.Agent{}
+	fallbacks := map[string][]string{}
+	for i, na := range cfg.Agents {
+		if len(na.Fallback) > 0 {
+			fallbacks[na.Name] = na.Fallback
+		}
+		a, err := buildAgent(na.AgentConfig)
+		if err != nil {
+			return nil, fmt.Errorf("agent %s: %w", na.Name, err)
+		}
+		namedAgents[na.Name] = a
+		if i == 0 {
+			defaultAgent, agent = na.Name, a
+		}
+	}
+	if err := checkRoleSandboxes(cfg.Roles, defaultAgent, agent, namedAgents); err != nil {
+		return nil, err
+	}
+	projects := make([]core.Project, 0, len(cfg.Projects))
+	for _, p := range cfg.Projects {
+		projects = append(projects, core.Project(p))
+	}
+	routes := make([]core.Route, 0, len(cfg.Routes))
+	for _, rc := range cfg.Routes {
+		routes = append(routes, core.Route(rc))
 	}
 
 	actions := make([]core.Action, 0, len(cfg.Actions))
@@ -129,16 +154,178 @@ func Build(cfg *config.Config, st *store.Store, logger *slog.Logger) (*core.Runn
 		}
 	}
 
+	policy := core.ApprovalPolicy{
+		Actions: cfg.Approvals.Actions,
+		TTL:     time.Duration(cfg.Approvals.ExpiryMinutes) * time.Minute,
+	}
+	for _, p := range cfg.Approvals.Patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("approval pattern %q: %w", p, err)
+		}
+		policy.Patterns = append(policy.Patterns, re)
+	}
+
+	scope, err := core.ParseSessionScope(cfg.Runner.SessionScope)
+	if err != nil {
+		return nil, err
+	}
+	replyLimits, transportScopes, err := transportOverrides(cfg.Transports)
+	if err != nil {
+		return nil, err
+	}
+
+	transportRates := map[string]core.RateLimit{}
+	for id, l := range cfg.RateLimits.Transports {
+		transportRates[id] = coreRateLimit(l)
+	}
+
+	roleSenders := map[string]core.Role{}
+	var defaultRole *core.Role
+	for name, rc := range cfg.Roles {
+		role := core.Role{
+			Name:           name,
+			Actions:        rc.Actions,
+			Commands:       rc.Commands,
+			ShellAllowlist: rc.ShellAllowlist,
+			Sandbox:        rc.Sandbox,
+		}
+		for _, s := range rc.Senders {
+			roleSenders[s] = role
+		}
+		if rc.Default {
+			defaultRole = &role
+		}
+	}
+	users := make([]core.User, 0, len(cfg.Users))
+	for id, u := range cfg.Users {
+		users = append(users, core.User{ID: id, Identities: u.Identities})
+		if u.Role != "" {
+			rc := cfg.Roles[u.Role]
+			roleSenders["user:"+id] = core.Role{
+				Name:           u.Role,
+				Actions:        rc.Actions,
+				Commands:       rc.Commands,
+				ShellAllowlist: rc.ShellAllowlist,
+				Sandbox:        rc.Sandbox,
+			}
+		}
+	}
+
 	r := core.NewRunner(transports, agent, actions, logger,
 		core.WithAllowedSenders(cfg.Runner.AllowedPubkeys),
+		core.WithUsers(users),
 		core.WithStore(st),
 		core.WithSessionTimeout(time.Duration(cfg.Runner.SessionTimeoutMins)*time.Minute),
+		core.WithSessionScope(scope, transportScopes),
 		core.WithInitialPrompt(cfg.Runner.InitialPrompt),
 		core.WithMaxReplyChars(cfg.Runner.MaxReplyChars),
+		core.WithMaxReplyParts(cfg.Runner.MaxReplyParts),
+		core.WithTransportReplyLimits(replyLimits),
+		core.WithHistoryLimits(cfg.Runner.HistoryTurns, cfg.Runner.HistoryMaxChars, cfg.Runner.HistoryMaxTokens),
+		core.WithMaxSteps(cfg.Runner.MaxAgentSteps),
+		core.WithRequestTimeout(time.Duration(cfg.Runner.RequestTimeoutSecs)*time.Second),
+		core.WithMaxConcurrency(cfg.Runner.MaxConcurrency),
+		core.WithProgressInterval(time.Duration(cfg.Runner.ProgressSecs)*time.Second),
+		core.WithResumeInterrupted(cfg.Runner.ResumeInterrupted),
+		core.WithShutdownGrace(time.Duration(max(cfg.Runner.ShutdownGraceSecs, 0))*time.Second),
+		core.WithStrictCommands(cfg.Runner.StrictCommands),
+		core.WithDedupeTTL(time.Duration(cfg.Runner.DedupeTTLMins)*time.Minute),
+		core.WithRetryPolicy(core.RetryPolicy{
+			Attempts:  cfg.Retry.Attempts,
+			BaseDelay: time.Duration(cfg.Retry.BaseDelayMS) * time.Millisecond,
+			MaxDelay:  time.Duration(cfg.Retry.MaxDelayMS) * time.Millisecond,
+			Jitter:    cfg.Retry.Jitter,
+		}),
+		core.WithBreakerPolicy(core.BreakerPolicy{
+			Failures: cfg.CircuitBreaker.Failures,
+			Cooldown: time.Duration(cfg.CircuitBreaker.CooldownSeconds) * time.Second,
+		}),
+		core.WithOutboxPolicy(core.OutboxPolicy{
+			MaxAttempts: cfg.Outbox.MaxAttempts,
+			BaseDelay:   time.Duration(cfg.Outbox.BaseDelaySeconds) * time.Second,
+			MaxDelay:    time.Duration(cfg.Outbox.MaxDelaySeconds) * time.Second,
+		}),
+		core.WithApprovalPolicy(policy),
+		core.WithRateLimits(coreRateLimit(cfg.RateLimits.RateLimit), transportRates),
+		core.WithRoles(roleSenders, defaultRole),
+		core.WithAgents(defaultAgent, namedAgents, routes),
+		core.WithFallbacks(fallbacks),
+		core.WithProjects(projects),
+		core.WithSpool(spool),
+		core.WithAuditLogger(st),
 	)
 	return r, nil
 }
 
+func buildAgent(ac config.AgentConfig) (core.Agent, error) {
+	agentCfg := ac.Config
+	switch ac.Type {
+	case "codexcli", "":
+		return codexcli.New(codexcli.Config(agentCfg)), nil
+	case "echo":
+		return echo.New(), nil
+	case "http":
+		return http.New(http.Config{APIBase: agentCfg.Binary, Model: agentCfg.Profile}), nil // placeholder reuse fields
+	case "copilotcli":
+		return copilotcli.New(copilotcli.Config{
+			Binary:         agentCfg.Binary,
+			WorkingDir:     agentCfg.WorkingDir,
+			TimeoutSeconds: agentCfg.TimeoutSeconds,
+			AllowAllTools:  false,
+			ExtraArgs:      agentCfg.ExtraArgs,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown agent type %s", ac.Type)
+	}
+}
+
+// checkRoleSandboxes refuses roles with a sandbox level when an agent runs
+// tools on the host but cannot apply the level, so a sandboxed role never
+// silently runs unsandboxed.
+func checkRoleSandboxes(roles map[string]config.Role, defaultName string, defaultAgent core.Agent, named map[string]core.Agent) error {
+	agents := map[string]core.Agent{defaultName: defaultAgent}
+	for name, a := range named {
+		agents[name] = a
+	}
+	for roleName, rc := range roles {
+		if rc.Sandbox == "" {
+			continue
+		}
+		for name, a := range agents {
+			if sa, ok := a.(core.SandboxAgent); ok && !sa.EnforcesSandbox() {
+				if name == "" {
+					name = "agent"
+				}
+				return fmt.Errorf("role %q sets sandbox %q but %s cannot enforce it; remove the sandbox or use a codexcli agent", roleName, rc.Sandbox, name)
+			}
+		}
+	}
+	return nil
+}
+
+// buildSpool opens the attachment spool. It returns nil, which makes transports
+// drop attachments, when no directory is set or max_total_mb is negative.
+func buildSpool(ac config.AttachmentsConfig) (*core.Spool, error) {
+	if ac.Dir == "" || ac.MaxTotalMB < 0 {
+		return nil, nil
+	}
+	spool, err := core.NewSpool(ac.Dir, int64(ac.MaxTotalMB)<<20, int64(ac.MaxFileMB)<<20)
+	if err != nil {
+		return nil, fmt.Errorf("attachments spool: %w", err)
+	}
+	return spool, nil
+}
+
+func coreRateLimit(l config.RateLimit) core.RateLimit {
+	return core.RateLimit{
+		MessagesPerMinute:       l.MessagesPerMinute,
+		ConcurrentRuns:          l.ConcurrentRuns,
+		TransportConcurrentRuns: l.TransportConcurrentRuns,
+		DailyAgentTime:          time.Duration(l.DailyAgentMinutes) * time.Minute,
+	}
+}
+
 // decodeMap marshals a generic map into a typed struct via JSON.
 func decodeMap(m map[string]any, out any) error {
 	if len(m) == 0 {
@@ -150,3 +337,51 @@ func decodeMap(m map[string]any, out any) error {
 	}
 	return json.Unmarshal(b, out)
 }
+
+// transportOverrides collects per-transport reply limits and session scopes,
+// keyed by the ID each transport runs under.
+func transportOverrides(ts []config.TransportConfig) (map[string]int, map[string]core.SessionScope, error) {
+	replyLimits := map[string]int{}
+	scopes := map[string]core.SessionScope{}
+	for _, t := range ts {
+		id := t.RuntimeID()
+		if t.MaxReplyChars > 0 {
+			replyLimits[id] = t.MaxReplyChars
+		}
+		if t.SessionScope != "" {
+			s, err := core.ParseSessionScope(t.SessionScope)
+			if err != nil {
+				return nil, nil, fmt.Errorf("transport %s: %w", id, err)
+			}
+			scopes[id] = s
+		}
+	}
+	return replyLimits, scopes, nil
+}
+
+var hexPubkey = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// LegacyTransport returns the MigrationEnv.TransportFor resolver for sender keys
+// written before keys named their transport. It tells the transport by the
+// sender's shape: hex pubkeys are Nostr, phone numbers WhatsApp and addresses
+// email, and picks the first configured transport of that type.
+func LegacyTransport(cfg *config.Config) func(sender string) string {
+	first := map[string]string{}
+	for _, t := range cfg.Transports {
+		if _, ok := first[t.Type]; !ok {
+			first[t.Type] = t.RuntimeID()
+		}
+	}
+	return func(sender string) string {
+		s := strings.ToLower(strings.TrimSpace(sender))
+		switch {
+		case hexPubkey.MatchString(s):
+			return first["nostr"]
+		case strings.HasPrefix(s, "whatsapp:") || strings.HasPrefix(s, "+"):
+			return first["whatsapp"]
+		case strings.Contains(s, "@"):
+			return first["email"]
+		}
+		return ""
+	}
+}
@@ -44,3 +44,22 @@ func TestBuildFailsOnUnknownAction(t *testing.T) {
 		t.Fatalf("expected error for unknown action")
 	}
 }
+
+func TestBuildFailsOnSandboxedRoleWithCopilot(t *testing.T) {
+	cfg := &config.Config{
+		Runner:     config.RunnerConfig{PrivateKey: "k", AllowedPubkeys: []string{"a"}},
+		Storage:    config.StorageConfig{Path: filepath.Join(t.TempDir(), "state.db")},
+		Transports: []config.TransportConfig{{Type: "mock", ID: "mock"}},
+		Agent:      config.AgentConfig{Type: "copilotcli"},
+		Roles:      map[string]config.Role{"viewer": {Senders: []string{"a"}, Sandbox: "read-only"}},
+	}
+	st, _ := store.New(cfg.Storage.Path)
+	defer func() { _ = st.Close() }()
+	if _, err := Build(cfg, st, slog.Default()); err == nil {
+		t.Fatalf("expected error for a sandboxed role the agent cannot enforce")
+	}
+	cfg.Agent.Type = "codexcli"
+	if _, err := Build(cfg, st, slog.Default()); err != nil {
+		t.Fatalf("codexcli enforces sandboxes: %v", err)
+	}
+}
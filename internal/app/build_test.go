@@ -4,9 +4,11 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/joelklabo/buddy/internal/config"
+	"github.com/joelklabo/buddy/internal/core"
 	"github.com/joelklabo/buddy/internal/store"
 )
 
@@ -62,3 +64,44 @@ func TestBuildUnknownTransport(t *testing.T) {
 		t.Fatalf("expected error for unknown transport")
 	}
 }
+
+func TestLegacyTransport(t *testing.T) {
+	cfg := &config.Config{Transports: []config.TransportConfig{
+		{Type: "nostr"},
+		{Type: "whatsapp", ID: "wa"},
+		{Type: "email", ID: "mail"},
+		{Type: "email", ID: "mail2"},
+	}}
+	resolve := LegacyTransport(cfg)
+	cases := map[string]string{
+		strings.Repeat("ab", 32): "nostr",
+		"+15550001":              "wa",
+		"whatsapp:+15550001":     "wa",
+		"Alice@Example.com":      "mail",
+		"alice":                  "",
+	}
+	for sender, want := range cases {
+		if got := resolve(sender); got != want {
+			t.Fatalf("%s: got %q, want %q", sender, got, want)
+		}
+	}
+}
+
+func TestTransportOverridesDefaultID(t *testing.T) {
+	limits, scopes, err := transportOverrides([]config.TransportConfig{
+		{Type: "whatsapp", MaxReplyChars: 500, SessionScope: "thread"},
+		{Type: "mock", ID: "m1", MaxReplyChars: 200},
+	})
+	if err != nil {
+		t.Fatalf("overrides: %v", err)
+	}
+	if limits["whatsapp"] != 500 || limits["m1"] != 200 {
+		t.Fatalf("limits = %v", limits)
+	}
+	if scopes["whatsapp"] != core.ScopeThread {
+		t.Fatalf("scopes = %v", scopes)
+	}
+	if _, ok := limits[""]; ok {
+		t.Fatalf("limit keyed by empty id: %v", limits)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -33,6 +34,44 @@ func New(cfg config.CodexConfig) *Runner {
 	return &Runner{cfg: cfg}
 }
 
+type sandboxKey struct{}
+
+// WithSandbox returns a context that makes Run use the given --sandbox level
+// instead of the configured one.
+func WithSandbox(ctx context.Context, level string) context.Context {
+	return context.WithValue(ctx, sandboxKey{}, level)
+}
+
+type workdirKey struct{}
+
+// WithWorkingDir returns a context that makes Run start Codex in dir instead of
+// the configured working directory.
+func WithWorkingDir(ctx context.Context, dir string) context.Context {
+	return context.WithValue(ctx, workdirKey{}, dir)
+}
+
+type imagesKey struct{}
+
+// WithImages returns a context that makes Run attach the given image files to
+// the prompt with --image.
+func WithImages(ctx context.Context, paths []string) context.Context {
+	return context.WithValue(ctx, imagesKey{}, paths)
+}
+
+// Event is a progress update parsed from a Codex JSONL item line.
+type Event struct {
+	Kind string // reasoning, command or file_change
+	Text string
+}
+
+type eventsKey struct{}
+
+// WithEvents returns a context that makes Run report item events to fn as Codex
+// prints them.
+func WithEvents(ctx context.Context, fn func(Event)) context.Context {
+	return context.WithValue(ctx, eventsKey{}, fn)
+}
+
 // Run executes a prompt. If sessionID is empty, a new Codex session is started;
 // otherwise the session is resumed.
 func (r *Runner) Run(ctx context.Context, sessionID string, prompt string) (Result, error) {
@@ -45,8 +84,12 @@ func (r *Runner) Run(ctx context.Context, sessionID string, prompt string) (Resu
 	if r.cfg.Approval != "" {
 		args = append(args, "-a", r.cfg.Approval)
 	}
-	if r.cfg.Sandbox != "" {
-		args = append(args, "--sandbox", r.cfg.Sandbox)
+	sandbox := r.cfg.Sandbox
+	if level, ok := ctx.Value(sandboxKey{}).(string); ok && level != "" {
+		sandbox = level
+	}
+	if sandbox != "" {
+		args = append(args, "--sandbox", sandbox)
 	}
 	if r.cfg.Profile != "" {
 		args = append(args, "--profile", r.cfg.Profile)
@@ -59,6 +102,21 @@ func (r *Runner) Run(ctx context.Context, sessionID string, prompt string) (Resu
 	if len(r.cfg.ExtraArgs) > 0 {
 		args = append(args, r.cfg.ExtraArgs...)
 	}
+	if images, ok := ctx.Value(imagesKey{}).([]string); ok {
+		// --image takes several values, so a spaced value list would swallow
+		// "resume <id>" and the prompt. One comma-joined --image=... ends it;
+		// a path with a comma in it cannot be said that way and is left to the
+		// prompt, which lists every attachment anyway.
+		paths := make([]string, 0, len(images))
+		for _, img := range images {
+			if !strings.Contains(img, ",") {
+				paths = append(paths, img)
+			}
+		}
+		if len(paths) > 0 {
+			args = append(args, "--image="+strings.Join(paths, ","))
+		}
+	}
 
 	if sessionID == "" {
 		// new session
@@ -69,13 +127,22 @@ func (r *Runner) Run(ctx context.Context, sessionID string, prompt string) (Resu
 	args = append(args, prompt)
 
 	cmd := exec.CommandContext(ctx, r.cfg.Binary, args...)
-	if r.cfg.WorkingDir != "" {
-		cmd.Dir = expandPath(r.cfg.WorkingDir)
+	if dir, ok := ctx.Value(workdirKey{}).(string); ok && dir != "" {
+		cmd.Dir = ExpandPath(dir)
+	} else if r.cfg.WorkingDir != "" {
+		cmd.Dir = ExpandPath(r.cfg.WorkingDir)
 	}
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
+	if fn, ok := ctx.Value(eventsKey{}).(func(Event)); ok && fn != nil {
+		cmd.Stdout = io.MultiWriter(&stdout, &lineWriter{fn: func(line string) {
+			if ev, ok := parseEvent(line); ok {
+				fn(ev)
+			}
+		}})
+	}
 
 	if err := cmd.Run(); err != nil {
 		return Result{}, fmt.Errorf("codex exec failed: %w; stderr: %s", err, stderr.String())
@@ -131,6 +198,72 @@ func parseCodexJSONL(data []byte) (Result, error) {
 	return res, nil
 }
 
+// parseEvent turns a started command, completed reasoning or completed file change
+// item into an Event.
+func parseEvent(line string) (Event, bool) {
+	var evt struct {
+		Type string `json:"type"`
+		Item *struct {
+			Type    string `json:"type"`
+			Text    string `json:"text"`
+			Command string `json:"command"`
+			Changes []struct {
+				Path string `json:"path"`
+			} `json:"changes"`
+		} `json:"item"`
+	}
+	if err := json.Unmarshal([]byte(line), &evt); err != nil || evt.Item == nil {
+		return Event{}, false
+	}
+	switch {
+	case evt.Item.Type == "command_execution" && evt.Type == "item.started" && evt.Item.Command != "":
+		return Event{Kind: "command", Text: "running: " + unwrapShell(evt.Item.Command)}, true
+	case evt.Item.Type == "reasoning" && evt.Type == "item.completed":
+		text := strings.TrimSpace(strings.SplitN(strings.TrimSpace(evt.Item.Text), "\n", 2)[0])
+		text = strings.Trim(text, "*")
+		if text == "" {
+			return Event{}, false
+		}
+		return Event{Kind: "reasoning", Text: "thinking: " + text}, true
+	case evt.Item.Type == "file_change" && evt.Type == "item.completed" && len(evt.Item.Changes) > 0:
+		paths := make([]string, 0, len(evt.Item.Changes))
+		for _, c := range evt.Item.Changes {
+			paths = append(paths, filepath.Base(c.Path))
+		}
+		return Event{Kind: "file_change", Text: "editing: " + strings.Join(paths, ", ")}, true
+	}
+	return Event{}, false
+}
+
+// unwrapShell strips the bash -lc '...' wrapper Codex reports around commands.
+func unwrapShell(cmd string) string {
+	for _, prefix := range []string{"bash -lc ", "/bin/bash -lc ", "sh -c "} {
+		if rest, ok := strings.CutPrefix(cmd, prefix); ok {
+			return strings.Trim(rest, `'"`)
+		}
+	}
+	return cmd
+}
+
+// lineWriter calls fn for each complete line written to it.
+type lineWriter struct {
+	fn  func(string)
+	buf []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.fn(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
 // ContextWithTimeout returns a context derived from parent with the configured timeout applied.
 func (r *Runner) ContextWithTimeout(parent context.Context) (context.Context, context.CancelFunc) {
 	t := time.Duration(r.cfg.TimeoutSeconds) * time.Second
@@ -140,8 +273,8 @@ func (r *Runner) ContextWithTimeout(parent context.Context) (context.Context, co
 	return context.WithTimeout(parent, t)
 }
 
-// expandPath resolves leading ~ and environment variables.
-func expandPath(p string) string {
+// ExpandPath resolves leading ~ and environment variables.
+func ExpandPath(p string) string {
 	if p == "" {
 		return p
 	}
@@ -49,10 +49,10 @@ func TestContextWithTimeout(t *testing.T) {
 
 func TestExpandPath(t *testing.T) {
 	home, _ := os.UserHomeDir()
-	got := expandPath("~/x")
+	got := ExpandPath("~/x")
 	want := filepath.Join(home, "x")
 	if got != want {
-		t.Fatalf("expandPath got %s want %s", got, want)
+		t.Fatalf("ExpandPath got %s want %s", got, want)
 	}
 }
 
@@ -134,3 +134,126 @@ func TestRunResumeAddsSessionID(t *testing.T) {
 		t.Fatalf("expected resume args, got %s", argStr)
 	}
 }
+
+func TestRunSandboxOverride(t *testing.T) {
+	td := t.TempDir()
+	argsFile := filepath.Join(td, "args.txt")
+	bin := filepath.Join(td, "codexsandbox")
+	script := "#!/usr/bin/env bash\necho \"$@\" > " + argsFile + "\necho '{\"thread_id\":\"s1\"}'\n"
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+
+	r := New(config.CodexConfig{Binary: bin, Sandbox: "danger-full-access"})
+	if _, err := r.Run(WithSandbox(context.Background(), "read-only"), "", "hello"); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	data, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatalf("read args: %v", err)
+	}
+	if argStr := string(data); !strings.Contains(argStr, "--sandbox read-only") || strings.Contains(argStr, "danger-full-access") {
+		t.Fatalf("expected sandbox override, got %s", argStr)
+	}
+}
+
+func TestRunWorkingDirOverride(t *testing.T) {
+	td := t.TempDir()
+	project := t.TempDir()
+	pwdFile := filepath.Join(td, "pwd.txt")
+	bin := filepath.Join(td, "codexpwd")
+	script := "#!/usr/bin/env bash\npwd > " + pwdFile + "\necho '{\"thread_id\":\"s1\"}'\n"
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+
+	r := New(config.CodexConfig{Binary: bin, WorkingDir: td})
+	if _, err := r.Run(WithWorkingDir(context.Background(), project), "", "hello"); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	data, err := os.ReadFile(pwdFile)
+	if err != nil {
+		t.Fatalf("read pwd: %v", err)
+	}
+	if got := strings.TrimSpace(string(data)); got != project {
+		t.Fatalf("expected codex to run in %s, got %s", project, got)
+	}
+}
+
+func TestParseEvent(t *testing.T) {
+	cases := []struct {
+		line string
+		want string
+	}{
+		{`{"type":"item.started","item":{"type":"command_execution","command":"bash -lc 'go test ./...'"}}`, "running: go test ./..."},
+		{`{"type":"item.completed","item":{"type":"reasoning","text":"**Checking tests**\n\nmore detail"}}`, "thinking: Checking tests"},
+		{`{"type":"item.completed","item":{"type":"file_change","changes":[{"path":"/repo/a.go"},{"path":"/repo/b.go"}]}}`, "editing: a.go, b.go"},
+		{`{"type":"item.completed","item":{"type":"agent_message","text":"done"}}`, ""},
+		{`not json`, ""},
+	}
+	for _, tc := range cases {
+		ev, ok := parseEvent(tc.line)
+		if tc.want == "" {
+			if ok {
+				t.Fatalf("expected no event for %s, got %+v", tc.line, ev)
+			}
+			continue
+		}
+		if !ok || ev.Text != tc.want {
+			t.Fatalf("parseEvent(%s) = %+v, want %q", tc.line, ev, tc.want)
+		}
+	}
+}
+
+func TestRunReportsEvents(t *testing.T) {
+	td := t.TempDir()
+	bin := filepath.Join(td, "codexstream")
+	script := "#!/usr/bin/env bash\n" +
+		"echo '{\"thread_id\":\"s1\"}'\n" +
+		"echo '{\"type\":\"item.started\",\"item\":{\"type\":\"command_execution\",\"command\":\"ls\"}}'\n" +
+		"echo '{\"type\":\"item.completed\",\"item\":{\"type\":\"agent_message\",\"text\":\"ok\"}}'\n"
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+	var got []Event
+	ctx := WithEvents(context.Background(), func(ev Event) { got = append(got, ev) })
+	res, err := New(config.CodexConfig{Binary: bin}).Run(ctx, "", "hello")
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if res.Reply != "ok" || len(got) != 1 || got[0].Text != "running: ls" {
+		t.Fatalf("unexpected result %+v events %+v", res, got)
+	}
+}
+
+func TestRunPassesImages(t *testing.T) {
+	td := t.TempDir()
+	argsFile := filepath.Join(td, "args.txt")
+	bin := filepath.Join(td, "codeximages")
+	script := "#!/usr/bin/env bash\necho \"$@\" > " + argsFile + "\necho '{\"thread_id\":\"s1\"}'\n"
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+
+	r := New(config.CodexConfig{Binary: bin})
+	if _, err := r.Run(WithImages(context.Background(), []string{"/w/a.png", "/w/b.jpg"}), "", "look"); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	data, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatalf("read args: %v", err)
+	}
+	if argStr := strings.TrimSpace(string(data)); !strings.HasSuffix(argStr, "--image=/w/a.png,/w/b.jpg look") {
+		t.Fatalf("expected image args, got %s", argStr)
+	}
+
+	// On resume the image list must end before the subcommand, or codex reads
+	// "resume" and the session id as more images.
+	if _, err := r.Run(WithImages(context.Background(), []string{"/w/a.png", "/w/x,y.png"}), "s0", "again"); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	data, _ = os.ReadFile(argsFile)
+	if argStr := strings.TrimSpace(string(data)); !strings.HasSuffix(argStr, "exec --json --image=/w/a.png resume s0 again") {
+		t.Fatalf("expected images before resume, got %s", argStr)
+	}
+}
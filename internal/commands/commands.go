@@ -1,56 +1,40 @@
 // Package commands parses the mini-DSL used in inbound messages.
 package commands
 
-import (
-	"strings"
-)
-
 // Command represents a parsed user instruction carried over transports.
 type Command struct {
-	Name string // run|new|reset|use|status|help|shell
-	Args string // remaining text after the command keyword
-	Raw  string // original user message
+	Name  string            // registered command name, or "run" for a plain prompt
+	Args  string            // remaining text after the command keyword
+	Raw   string            // original user message
+	Words []string          // Args split into positional words, quotes removed
+	Flags map[string]string // --flag or --flag=value; boolean flags map to "true"
+	Err   string            // usage error when the arguments do not fit the grammar
 }
 
-// Parse inspects the incoming plaintext message and extracts a command.
-// Supported forms:
+// Parse parses msg with the built-in commands in non-strict mode. Supported forms:
 //
-//	"/new" or "new"                -> start a new session (Args optional)
+//	"/new [prompt]" or "new ..."   -> start a new session (alias reset)
 //	"/use <session-id>"            -> switch to an existing session
 //	"/status"                      -> show active session info
 //	"/help"                        -> usage help
-//	"/shell <command>"             -> run a shell action (if enabled)
+//	"/cancel"                      -> stop the sender's in-flight run (slash form only)
+//	"/approve <id>", "/deny <id>"  -> decide on a held action call (slash form only)
+//	"/more"                        -> next parts of a long reply (slash form only)
 //	Anything else                  -> run prompt in the active/new session
+//
+// Runners use their own Registry so actions can add commands such as /shell.
 func Parse(msg string) Command {
-	trimmed := strings.TrimSpace(msg)
-	lower := strings.ToLower(trimmed)
+	return defaultRegistry.Parse(msg)
+}
+
+var defaultRegistry = mustRegistry(Builtins()...)
 
-	switch {
-	case strings.HasPrefix(lower, "/new"):
-		return Command{Name: "new", Args: strings.TrimSpace(trimmed[4:]), Raw: msg}
-	case strings.HasPrefix(lower, "new"):
-		return Command{Name: "new", Args: strings.TrimSpace(trimmed[3:]), Raw: msg}
-	case strings.HasPrefix(lower, "/reset"):
-		return Command{Name: "new", Args: strings.TrimSpace(trimmed[6:]), Raw: msg}
-	case strings.HasPrefix(lower, "reset"):
-		return Command{Name: "new", Args: strings.TrimSpace(trimmed[5:]), Raw: msg}
-	case strings.HasPrefix(lower, "/use"):
-		return Command{Name: "use", Args: strings.TrimSpace(trimmed[4:]), Raw: msg}
-	case strings.HasPrefix(lower, "use"):
-		return Command{Name: "use", Args: strings.TrimSpace(trimmed[3:]), Raw: msg}
-	case strings.HasPrefix(lower, "/shell"):
-		return Command{Name: "shell", Args: strings.TrimSpace(trimmed[6:]), Raw: msg}
-	case strings.HasPrefix(lower, "shell"):
-		return Command{Name: "shell", Args: strings.TrimSpace(trimmed[5:]), Raw: msg}
-	case strings.HasPrefix(lower, "/status"):
-		return Command{Name: "status", Raw: msg}
-	case strings.HasPrefix(lower, "status"):
-		return Command{Name: "status", Raw: msg}
-	case strings.HasPrefix(lower, "/help"):
-		return Command{Name: "help", Raw: msg}
-	case strings.HasPrefix(lower, "help"):
-		return Command{Name: "help", Raw: msg}
-	default:
-		return Command{Name: "run", Args: trimmed, Raw: msg}
+func mustRegistry(specs ...Spec) *Registry {
+	r := NewRegistry()
+	for _, s := range specs {
+		if err := r.Register(s); err != nil {
+			panic(err)
+		}
 	}
+	return r
 }
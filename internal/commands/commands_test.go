@@ -9,19 +9,27 @@ func TestParseCommands(t *testing.T) {
 		args string
 	}{
 		{"/new start fresh", "new", "start fresh"},
-		{"new start", "new", "start"},
+		{"new", "new", ""},
+		{"new start", "run", "new start"},
 		{"/reset wiped", "new", "wiped"},
-		{"reset again", "new", "again"},
+		{"reset", "new", ""},
+		{"reset again", "run", "reset again"},
 		{"/use abc123", "use", "abc123"},
-		{"use abc123", "use", "abc123"},
+		{"use abc123", "run", "use abc123"},
 		{"/status", "status", ""},
 		{"/help", "help", ""},
 		{"/shell ls -la", "shell", "ls -la"},
 		{"shell ls -la", "shell", "ls -la"},
+		{"/cancel", "cancel", ""},
+		{"/approve ab12cd", "approve", "ab12cd"},
+		{"/deny ab12cd", "deny", "ab12cd"},
+		{"/more", "more", ""},
+		{"cancel the meeting", "run", "cancel the meeting"},
 		{"free text prompt", "run", "free text prompt"},
 	}
+	reg := mustRegistry(append(Builtins(), Spec{Name: "shell", Bare: true, RawArgs: true})...)
 	for _, tc := range cases {
-		cmd := Parse(tc.in)
+		cmd := reg.Parse(tc.in)
 		if cmd.Name != tc.name {
 			t.Fatalf("%q expected name %s got %s", tc.in, tc.name, cmd.Name)
 		}
@@ -0,0 +1,239 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Spec describes a slash command.
+type Spec struct {
+	Name      string
+	Aliases   []string
+	Usage     string   // argument grammar shown in help, e.g. "<session-id>"
+	Help      string   // one-line description
+	Bare      bool     // may also be typed without the slash outside strict mode
+	BareAlone bool     // bare form only as the whole message ("new", not "New York weather?")
+	RawArgs   bool     // take the rest of the line verbatim instead of parsing words
+	MinArgs   int      // positional words required
+	MaxArgs   int      // positional words allowed; negative means unlimited
+	Flags     []string // accepted --flags, without dashes
+}
+
+// Builtins are the commands the runner itself implements.
+func Builtins() []Spec {
+	return []Spec{
+		{Name: "help", Help: "show this help", Bare: true},
+		{Name: "status", Help: "show the active session", Bare: true},
+		{Name: "new", Aliases: []string{"reset"}, Usage: "[prompt]", Help: "start a fresh session, optionally with a first prompt", Bare: true, BareAlone: true, RawArgs: true},
+		{Name: "use", Usage: "<session-id>", Help: "resume an existing session", MinArgs: 1, MaxArgs: 1},
+		{Name: "cancel", Help: "stop your running request"},
+		{Name: "approve", Usage: "<id>", Help: "run a held action", MinArgs: 1, MaxArgs: 1},
+		{Name: "deny", Usage: "<id>", Help: "drop a held action", MinArgs: 1, MaxArgs: 1},
+		{Name: "more", Help: "send the next parts of a long reply"},
+	}
+}
+
+// Registry holds the commands a runner understands.
+type Registry struct {
+	specs  []Spec
+	byName map[string]int // name or alias -> index into specs
+	strict bool
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{byName: map[string]int{}}
+}
+
+// SetStrict makes bare-word commands ("new", "status") require the slash.
+func (r *Registry) SetStrict(strict bool) {
+	r.strict = strict
+}
+
+// Register adds s. Names and aliases are case-insensitive and must be unique.
+func (r *Registry) Register(s Spec) error {
+	s.Name = strings.ToLower(strings.TrimSpace(s.Name))
+	if s.Name == "" || s.Name == "run" || strings.ContainsAny(s.Name, " /") {
+		return fmt.Errorf("invalid command name %q", s.Name)
+	}
+	keys := append([]string{s.Name}, s.Aliases...)
+	for i, k := range keys {
+		k = strings.ToLower(strings.TrimSpace(k))
+		if _, ok := r.byName[k]; ok {
+			return fmt.Errorf("command %q already registered", k)
+		}
+		keys[i] = k
+	}
+	r.specs = append(r.specs, s)
+	for _, k := range keys {
+		r.byName[k] = len(r.specs) - 1
+	}
+	return nil
+}
+
+// Lookup returns the spec registered under name or one of its aliases.
+func (r *Registry) Lookup(name string) (Spec, bool) {
+	i, ok := r.byName[strings.ToLower(name)]
+	if !ok {
+		return Spec{}, false
+	}
+	return r.specs[i], true
+}
+
+// Specs returns the registered commands in registration order.
+func (r *Registry) Specs() []Spec {
+	return append([]Spec(nil), r.specs...)
+}
+
+// Parse extracts a command from msg. Unknown commands, and bare words whose
+// arguments do not fit the command ("status of the build"), are plain prompts.
+func (r *Registry) Parse(msg string) Command {
+	trimmed := strings.TrimSpace(msg)
+	prompt := Command{Name: "run", Args: trimmed, Raw: msg}
+
+	word, rest := trimmed, ""
+	if i := strings.IndexAny(trimmed, " \t\n"); i >= 0 {
+		word, rest = trimmed[:i], strings.TrimSpace(trimmed[i+1:])
+	}
+	slash := strings.HasPrefix(word, "/")
+	spec, ok := r.Lookup(strings.TrimPrefix(word, "/"))
+	if !ok || (!slash && (!spec.Bare || r.strict || (spec.BareAlone && rest != ""))) {
+		return prompt
+	}
+
+	cmd := Command{Name: spec.Name, Args: rest, Raw: msg}
+	if spec.RawArgs {
+		return cmd
+	}
+	words, flags, err := splitArgs(rest)
+	if err == nil {
+		err = spec.check(words, flags)
+	}
+	if err != nil {
+		if !slash {
+			return prompt
+		}
+		cmd.Err = fmt.Sprintf("%v. Usage: %s", err, spec.synopsis())
+	}
+	cmd.Words, cmd.Flags = words, flags
+	return cmd
+}
+
+func (s Spec) check(words []string, flags map[string]string) error {
+	for f := range flags {
+		if !contains(s.Flags, f) {
+			return fmt.Errorf("unknown flag --%s", f)
+		}
+	}
+	if len(words) < s.MinArgs {
+		return fmt.Errorf("missing argument")
+	}
+	if s.MaxArgs >= 0 && len(words) > s.MaxArgs {
+		return fmt.Errorf("too many arguments")
+	}
+	return nil
+}
+
+func (s Spec) synopsis() string {
+	out := "/" + s.Name
+	for _, f := range s.Flags {
+		out += " [--" + f + "]"
+	}
+	if s.Usage != "" {
+		out += " " + s.Usage
+	}
+	return out
+}
+
+// Help renders one line per command, for /help.
+func (r *Registry) Help() string {
+	lines := make([]string, 0, len(r.specs))
+	for _, s := range r.specs {
+		line := s.synopsis()
+		if len(s.Aliases) > 0 {
+			aliases := append([]string(nil), s.Aliases...)
+			sort.Strings(aliases)
+			line += " (also /" + strings.Join(aliases, ", /") + ")"
+		}
+		if s.Help != "" {
+			line += " — " + s.Help
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// splitArgs splits s into words, honouring single and double quotes and
+// backslash escapes, and separates --flag and --flag=value words. A bare "--"
+// ends flag parsing.
+func splitArgs(s string) ([]string, map[string]string, error) {
+	var (
+		words   []string
+		flags   map[string]string
+		cur     strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+		noFlags bool
+	)
+	flush := func() {
+		if !inWord {
+			return
+		}
+		w := cur.String()
+		cur.Reset()
+		inWord = false
+		switch {
+		case noFlags || !strings.HasPrefix(w, "--"):
+			words = append(words, w)
+		case w == "--":
+			noFlags = true
+		default:
+			name, value, ok := strings.Cut(w[2:], "=")
+			if !ok {
+				value = "true"
+			}
+			if flags == nil {
+				flags = map[string]string{}
+			}
+			flags[strings.ToLower(name)] = value
+		}
+	}
+	for _, c := range s {
+		switch {
+		case escaped:
+			cur.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(c)
+			}
+		case c == '"' || c == '\'':
+			quote, inWord = c, true
+		case c == ' ' || c == '\t' || c == '\n':
+			flush()
+		default:
+			cur.WriteRune(c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, nil, fmt.Errorf("unterminated quote")
+	}
+	flush()
+	return words, flags, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
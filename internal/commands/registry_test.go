@@ -0,0 +1,89 @@
+package commands
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseLeavesProseAlone(t *testing.T) {
+	for _, in := range []string{
+		"news about the launch",
+		"user list is empty",
+		"use the force luke",
+		"status of the build",
+		"help me write a test",
+		"New York weather?",
+		"reset my password",
+		"use it",
+		"/unknown thing",
+	} {
+		if cmd := Parse(in); cmd.Name != "run" || cmd.Args != in {
+			t.Fatalf("%q parsed as %+v", in, cmd)
+		}
+	}
+}
+
+func TestStrictRequiresSlash(t *testing.T) {
+	reg := mustRegistry(Builtins()...)
+	reg.SetStrict(true)
+	if cmd := reg.Parse("new start"); cmd.Name != "run" {
+		t.Fatalf("bare word ran %s in strict mode", cmd.Name)
+	}
+	if cmd := reg.Parse("/new start"); cmd.Name != "new" || cmd.Args != "start" {
+		t.Fatalf("slash form not parsed: %+v", cmd)
+	}
+}
+
+func TestParseQuotesAndFlags(t *testing.T) {
+	reg := mustRegistry(Spec{Name: "note", Usage: "<title> [body]", MinArgs: 1, MaxArgs: 2, Flags: []string{"pin", "tag"}})
+	cmd := reg.Parse(`/note --pin --tag=work "weekly sync" 'say "hi" -- now' `)
+	if cmd.Err != "" {
+		t.Fatalf("unexpected error %q", cmd.Err)
+	}
+	if want := []string{"weekly sync", `say "hi" -- now`}; !reflect.DeepEqual(cmd.Words, want) {
+		t.Fatalf("words = %q, want %q", cmd.Words, want)
+	}
+	if cmd.Flags["pin"] != "true" || cmd.Flags["tag"] != "work" {
+		t.Fatalf("flags = %v", cmd.Flags)
+	}
+	if cmd := reg.Parse("/note -- --pin"); cmd.Err != "" || cmd.Words[0] != "--pin" {
+		t.Fatalf("-- did not end flags: %+v", cmd)
+	}
+}
+
+func TestParseUsageErrors(t *testing.T) {
+	reg := mustRegistry(Builtins()...)
+	for in, want := range map[string]string{
+		"/use":               "missing argument. Usage: /use <session-id>",
+		"/use a b":           "too many arguments. Usage: /use <session-id>",
+		"/approve --now x":   "unknown flag --now. Usage: /approve <id>",
+		`/use "unterminated`: "unterminated quote. Usage: /use <session-id>",
+	} {
+		if cmd := reg.Parse(in); cmd.Err != want {
+			t.Fatalf("%q: err = %q, want %q", in, cmd.Err, want)
+		}
+	}
+}
+
+func TestRegisterRejectsDuplicates(t *testing.T) {
+	reg := mustRegistry(Builtins()...)
+	if err := reg.Register(Spec{Name: "renew", Aliases: []string{"RESET"}}); err == nil {
+		t.Fatal("alias clash not rejected")
+	}
+	if err := reg.Register(Spec{Name: "run"}); err == nil {
+		t.Fatal("reserved name accepted")
+	}
+	if _, ok := reg.Lookup("renew"); ok {
+		t.Fatal("rejected command was registered")
+	}
+}
+
+func TestHelpListsCommands(t *testing.T) {
+	help := mustRegistry(Builtins()...).Help()
+	for _, want := range []string{"/new [prompt] (also /reset) — start a fresh session", "/use <session-id> — resume", "/cancel — "} {
+		if !strings.Contains(help, want) {
+			t.Fatalf("help missing %q:\n%s", want, help)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/nbd-wtf/go-nostr"
@@ -23,7 +24,19 @@ type Config struct {
 
 	Transports []TransportConfig `yaml:"transports"`
 	Agent      AgentConfig       `yaml:"agent"`
+	Agents     []NamedAgent      `yaml:"agents"`
+	Routes     []Route           `yaml:"routes"`
 	Actions    []ActionConfig    `yaml:"actions"`
+	Approvals  ApprovalConfig    `yaml:"approvals"`
+	RateLimits RateLimitConfig   `yaml:"rate_limits"`
+	Roles      map[string]Role   `yaml:"roles"`
+	Users      map[string]User   `yaml:"users"`
+	Outbox     OutboxConfig      `yaml:"outbox"`
+
+	Retry          RetryConfig   `yaml:"retry"`
+	CircuitBreaker BreakerConfig `yaml:"circuit_breaker"`
+
+	Attachments AttachmentsConfig `yaml:"attachments"`
 }
 
 // RunnerConfig controls Nostr-facing behaviour.
@@ -32,8 +45,21 @@ type RunnerConfig struct {
 	AllowedPubkeys     []string `yaml:"allowed_pubkeys"`
 	AutoReply          bool     `yaml:"auto_reply"`
 	MaxReplyChars      int      `yaml:"max_reply_chars"`
+	MaxReplyParts      int      `yaml:"max_reply_parts"`
 	SessionTimeoutMins int      `yaml:"session_timeout_minutes"`
 	InitialPrompt      string   `yaml:"initial_prompt"`
+	HistoryTurns       int      `yaml:"history_turns"`
+	HistoryMaxChars    int      `yaml:"history_max_chars"`
+	HistoryMaxTokens   int      `yaml:"history_max_tokens"`
+	MaxAgentSteps      int      `yaml:"max_agent_steps"`
+	RequestTimeoutSecs int      `yaml:"request_timeout_seconds"`
+	MaxConcurrency     int      `yaml:"max_concurrency"`
+	ProgressSecs       int      `yaml:"progress_interval_seconds"`
+	ResumeInterrupted  bool     `yaml:"resume_interrupted"`
+	ShutdownGraceSecs  int      `yaml:"shutdown_grace_seconds"`
+	StrictCommands     bool     `yaml:"strict_commands"`
+	DedupeTTLMins      int      `yaml:"dedupe_ttl_minutes"`
+	SessionScope       string   `yaml:"session_scope"` // sender|thread|sender+thread
 	ProfileName        string   `yaml:"profile_name"`
 	ProfileImage       string   `yaml:"profile_image"`
 }
@@ -75,18 +101,62 @@ type TransportConfig struct {
 	ID     string         `yaml:"id"`
 	Config map[string]any `yaml:"config"` // generic, transport-specific fields
 
+	// MaxReplyChars caps each outbound message on this transport (0 = runner default).
+	MaxReplyChars int `yaml:"max_reply_chars"`
+	// SessionScope overrides runner.session_scope for this transport.
+	SessionScope string `yaml:"session_scope"`
+
 	// Nostr-specific fields (used when type=nostr)
 	Relays         []string `yaml:"relays"`
 	PrivateKey     string   `yaml:"private_key"`
 	AllowedPubkeys []string `yaml:"allowed_pubkeys"`
 }
 
+// RuntimeID is the ID the transport reports once built: the id in its config
+// block for email and WhatsApp, else the entry id, else the type's default
+// ("email-mailgun" or "email-imap" for email).
+func (t TransportConfig) RuntimeID() string {
+	if t.Type == "email" || t.Type == "whatsapp" {
+		if id, _ := t.Config["id"].(string); id != "" {
+			return id
+		}
+	}
+	if t.ID != "" {
+		return t.ID
+	}
+	if t.Type == "email" {
+		mode, _ := t.Config["mode"].(string)
+		if mode == "" {
+			mode = "mailgun"
+		}
+		return "email-" + mode
+	}
+	return t.Type
+}
+
 // AgentConfig holds agent selection and backend config.
 type AgentConfig struct {
 	Type   string      `yaml:"type"`
 	Config CodexConfig `yaml:"config"` // generic CLI-like config
 }
 
+// NamedAgent is an entry in the agents list; routes refer to it by Name.
+type NamedAgent struct {
+	Name        string   `yaml:"name"`
+	Fallback    []string `yaml:"fallback"` // agents tried in order when this one fails
+	AgentConfig `yaml:",inline"`
+}
+
+// Route picks the agent for messages matching every non-empty field. Routes are
+// tried in order; messages matching none go to the first entry in agents.
+type Route struct {
+	Agent     string `yaml:"agent"`
+	Transport string `yaml:"transport"` // transport ID
+	Sender    string `yaml:"sender"`
+	Prefix    string `yaml:"prefix"`  // stripped from the prompt
+	Project   string `yaml:"project"` // sender's active project ID
+}
+
 // ActionConfig defines an action plugin instance.
 type ActionConfig struct {
 	Type             string   `yaml:"type"`
@@ -103,6 +173,91 @@ type ActionConfig struct {
 	UnsafeAllowEmpty bool     `yaml:"unsafe_allow_empty"`
 }
 
+// ApprovalConfig lists agent action calls that need a human /approve before running.
+type ApprovalConfig struct {
+	Actions       []string `yaml:"actions"`  // action names that always need approval
+	Patterns      []string `yaml:"patterns"` // regexes matched against the call arguments
+	ExpiryMinutes int      `yaml:"expiry_minutes"`
+}
+
+// RateLimit bounds a single sender's usage. Zero means unlimited.
+type RateLimit struct {
+	MessagesPerMinute       int `yaml:"messages_per_minute"`
+	ConcurrentRuns          int `yaml:"concurrent_runs"`           // per sender
+	TransportConcurrentRuns int `yaml:"transport_concurrent_runs"` // per transport, across senders
+	DailyAgentMinutes       int `yaml:"daily_agent_minutes"`
+}
+
+// RateLimitConfig applies per-sender limits, optionally tightened or relaxed per
+// transport ID.
+type RateLimitConfig struct {
+	RateLimit  `yaml:",inline"`
+	Transports map[string]RateLimit `yaml:"transports"`
+}
+
+// OutboxConfig controls retries of replies that could not be delivered.
+type OutboxConfig struct {
+	MaxAttempts      int `yaml:"max_attempts"`
+	BaseDelaySeconds int `yaml:"base_delay_seconds"`
+	MaxDelaySeconds  int `yaml:"max_delay_seconds"`
+}
+
+// RetryConfig controls inline retries of agent calls and sends. Errors that
+// agents or transports mark as permanent are never retried.
+type RetryConfig struct {
+	Attempts    int     `yaml:"attempts"`
+	BaseDelayMS int     `yaml:"base_delay_ms"`
+	MaxDelayMS  int     `yaml:"max_delay_ms"`
+	Jitter      float64 `yaml:"jitter"` // fraction of the delay; negative disables
+}
+
+// BreakerConfig controls the per-agent circuit breaker.
+type BreakerConfig struct {
+	Failures        int `yaml:"failures"` // negative disables
+	CooldownSeconds int `yaml:"cooldown_seconds"`
+}
+
+// AttachmentsConfig controls the spool that holds files received from and
+// sent to senders.
+type AttachmentsConfig struct {
+	Dir        string `yaml:"dir"`          // defaults to "attachments" next to the state DB
+	MaxTotalMB int    `yaml:"max_total_mb"` // oldest files are removed beyond this; negative disables attachments
+	MaxFileMB  int    `yaml:"max_file_mb"`  // larger files are dropped
+}
+
+// Role grants a set of senders (npub, phone number or email) specific actions,
+// slash commands, shell prefixes and an agent sandbox level.
+type Role struct {
+	Senders        []string `yaml:"senders"`
+	Default        bool     `yaml:"default"`  // applies to senders not listed in any role
+	Actions        []string `yaml:"actions"`  // "*" allows all
+	Commands       []string `yaml:"commands"` // without the slash; "*" allows all
+	ShellAllowlist []string `yaml:"shell_allowlist"`
+	Sandbox        string   `yaml:"sandbox"` // read-only|workspace-write|danger-full-access
+}
+
+// User links one person's sender IDs across transports, so sessions, quotas,
+// roles and audit follow the person rather than the channel.
+type User struct {
+	Role       string              `yaml:"role"`       // optional; takes precedence over roles.*.senders
+	Identities map[string][]string `yaml:"identities"` // transport ID -> npub/hex pubkey, phone number or email
+}
+
+// UserIdentities returns the sender IDs users have linked on a transport, in
+// user order.
+func (c *Config) UserIdentities(transportID string) []string {
+	names := make([]string, 0, len(c.Users))
+	for name := range c.Users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var ids []string
+	for _, name := range names {
+		ids = append(ids, c.Users[name].Identities[transportID]...)
+	}
+	return ids
+}
+
 // Load reads and validates configuration from the provided path.
 func Load(path string) (*Config, error) {
 	raw, err := os.ReadFile(path)
@@ -122,6 +277,7 @@ func LoadBytes(raw []byte, baseDir string) (*Config, error) {
 
 	cfg.applyDefaults(baseDir)
 	cfg.Storage.Path = expandPath(cfg.Storage.Path)
+	cfg.Attachments.Dir = expandPath(cfg.Attachments.Dir)
 	if err := cfg.Validate(); err != nil {
 		return nil, err
 	}
@@ -168,12 +324,30 @@ func (c *Config) Validate() error {
 			return fmt.Errorf("project %s has empty path", p.ID)
 		}
 	}
+	if err := validSessionScope(c.Runner.SessionScope); err != nil {
+		return fmt.Errorf("runner.session_scope: %w", err)
+	}
 	if err := c.ValidateTransports(); err != nil {
 		return err
 	}
 	if err := c.ValidateActions(); err != nil {
 		return err
 	}
+	if err := c.ValidateApprovals(); err != nil {
+		return err
+	}
+	if err := c.ValidateRateLimits(); err != nil {
+		return err
+	}
+	if err := c.ValidateRoles(); err != nil {
+		return err
+	}
+	if err := c.ValidateUsers(); err != nil {
+		return err
+	}
+	if err := c.ValidateAgents(); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -181,9 +355,75 @@ func (c *Config) applyDefaults(baseDir string) {
 	if c.Runner.MaxReplyChars == 0 {
 		c.Runner.MaxReplyChars = 8000
 	}
+	if c.Runner.MaxReplyParts == 0 {
+		c.Runner.MaxReplyParts = 3
+	}
 	if c.Runner.SessionTimeoutMins == 0 {
 		c.Runner.SessionTimeoutMins = 240
 	}
+	if c.Runner.HistoryTurns == 0 {
+		c.Runner.HistoryTurns = 20
+	}
+	if c.Runner.HistoryMaxChars == 0 {
+		c.Runner.HistoryMaxChars = 12000
+	}
+	if c.Runner.HistoryMaxTokens == 0 {
+		c.Runner.HistoryMaxTokens = 3000
+	}
+	if c.Runner.MaxAgentSteps == 0 {
+		c.Runner.MaxAgentSteps = 5
+	}
+	if c.Runner.RequestTimeoutSecs == 0 {
+		c.Runner.RequestTimeoutSecs = 900 // 15 minutes
+	}
+	if c.Runner.MaxConcurrency == 0 {
+		c.Runner.MaxConcurrency = 4
+	}
+	if c.Runner.ProgressSecs == 0 {
+		c.Runner.ProgressSecs = 30
+	}
+	if c.Runner.ShutdownGraceSecs == 0 {
+		c.Runner.ShutdownGraceSecs = 30
+	}
+	if c.Runner.DedupeTTLMins == 0 {
+		c.Runner.DedupeTTLMins = 1440 // 24 hours
+	}
+	if c.Outbox.MaxAttempts == 0 {
+		c.Outbox.MaxAttempts = 8
+	}
+	if c.Outbox.BaseDelaySeconds == 0 {
+		c.Outbox.BaseDelaySeconds = 30
+	}
+	if c.Outbox.MaxDelaySeconds == 0 {
+		c.Outbox.MaxDelaySeconds = 1800
+	}
+	if c.Retry.Attempts == 0 {
+		c.Retry.Attempts = 3
+	}
+	if c.Retry.BaseDelayMS == 0 {
+		c.Retry.BaseDelayMS = 100
+	}
+	if c.Retry.MaxDelayMS == 0 {
+		c.Retry.MaxDelayMS = 2000
+	}
+	if c.Retry.Jitter == 0 {
+		c.Retry.Jitter = 0.5
+	}
+	if c.CircuitBreaker.Failures == 0 {
+		c.CircuitBreaker.Failures = 5
+	}
+	if c.CircuitBreaker.CooldownSeconds == 0 {
+		c.CircuitBreaker.CooldownSeconds = 60
+	}
+	if c.Attachments.MaxTotalMB == 0 {
+		c.Attachments.MaxTotalMB = 500
+	}
+	if c.Attachments.MaxFileMB == 0 {
+		c.Attachments.MaxFileMB = 25
+	}
+	if c.Approvals.ExpiryMinutes == 0 {
+		c.Approvals.ExpiryMinutes = 30
+	}
 	if strings.TrimSpace(c.Runner.InitialPrompt) == "" {
 		c.Runner.InitialPrompt = "You are an AI agent with shell access to this machine. Be concise, be careful, and always explain what you plan to do before running commands. Ask for confirmation before risky actions."
 	}
@@ -194,6 +434,17 @@ func (c *Config) applyDefaults(baseDir string) {
 		c.Runner.ProfileImage = "https://raw.githubusercontent.com/joelklabo/buddy/main/assets/social-preview.svg"
 	}
 	applyCLIConfigDefaults(&c.Agent.Config)
+	for i := range c.Agents {
+		if c.Agents[i].Type == "" {
+			c.Agents[i].Type = "codexcli"
+		}
+		applyCLIConfigDefaults(&c.Agents[i].Config)
+	}
+	for i, r := range c.Routes {
+		if strings.HasPrefix(strings.ToLower(strings.TrimSpace(r.Sender)), "npub") {
+			c.Routes[i].Sender = normalizePubkey(r.Sender)
+		}
+	}
 	if c.Logging.Level == "" {
 		c.Logging.Level = "info"
 	}
@@ -246,6 +497,9 @@ func (c *Config) applyDefaults(baseDir string) {
 			c.Storage.Path = filepath.Join(home, ".buddy", "state.db")
 		}
 	}
+	if c.Attachments.Dir == "" && c.Storage.Path != "" {
+		c.Attachments.Dir = filepath.Join(filepath.Dir(c.Storage.Path), "attachments")
+	}
 	if c.Logging.File != "" {
 		c.Logging.File = expandPath(c.Logging.File)
 	}
@@ -253,6 +507,23 @@ func (c *Config) applyDefaults(baseDir string) {
 	for i, pk := range c.Runner.AllowedPubkeys {
 		c.Runner.AllowedPubkeys[i] = normalizePubkey(pk)
 	}
+	for _, role := range c.Roles {
+		for i, s := range role.Senders {
+			if strings.HasPrefix(strings.ToLower(strings.TrimSpace(s)), "npub") {
+				role.Senders[i] = normalizePubkey(s)
+			}
+		}
+	}
+
+	for _, u := range c.Users {
+		for _, ids := range u.Identities {
+			for i, s := range ids {
+				if strings.HasPrefix(strings.ToLower(strings.TrimSpace(s)), "npub") {
+					ids[i] = normalizePubkey(s)
+				}
+			}
+		}
+	}
 
 	// Defaults for plugin schema (backward compat)
 	if len(c.Transports) == 0 {
@@ -3,10 +3,12 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/nbd-wtf/go-nostr"
 	"github.com/nbd-wtf/go-nostr/nip19"
+	"gopkg.in/yaml.v3"
 )
 
 func TestNormalizePubkeyHandlesNpub(t *testing.T) {
@@ -72,3 +74,209 @@ func TestValidateProjectPath(t *testing.T) {
 		t.Fatalf("expected validation error for empty project path")
 	}
 }
+
+func TestRateLimitsParseInlineAndOverrides(t *testing.T) {
+	var cfg Config
+	raw := []byte("rate_limits:\n  messages_per_minute: 6\n  daily_agent_minutes: 60\n  transports:\n    whatsapp:\n      messages_per_minute: 2\n")
+	if err := yaml.Unmarshal(raw, &cfg); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if cfg.RateLimits.MessagesPerMinute != 6 || cfg.RateLimits.DailyAgentMinutes != 60 {
+		t.Fatalf("unexpected defaults %+v", cfg.RateLimits.RateLimit)
+	}
+	if cfg.RateLimits.Transports["whatsapp"].MessagesPerMinute != 2 {
+		t.Fatalf("unexpected overrides %+v", cfg.RateLimits.Transports)
+	}
+	if err := cfg.ValidateRateLimits(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	cfg.RateLimits.Transports["whatsapp"] = RateLimit{ConcurrentRuns: -1}
+	if err := cfg.ValidateRateLimits(); err == nil {
+		t.Fatalf("expected negative limit to fail validation")
+	}
+}
+
+func TestValidateRoles(t *testing.T) {
+	priv := nostr.GeneratePrivateKey()
+	pub, _ := nostr.GetPublicKey(priv)
+	npub, _ := nip19.EncodePublicKey(pub)
+	cfg := Config{Roles: map[string]Role{
+		"admin":  {Senders: []string{npub}, Actions: []string{"*"}, Sandbox: "danger-full-access"},
+		"viewer": {Senders: []string{"+15550001"}, Default: true, Sandbox: "read-only"},
+	}}
+	cfg.applyDefaults(".")
+	if got := cfg.Roles["admin"].Senders[0]; got != pub {
+		t.Fatalf("role npub not normalized: %s", got)
+	}
+	if err := cfg.ValidateRoles(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+
+	cfg.Roles["ops"] = Role{Senders: []string{"+15550001"}}
+	if err := cfg.ValidateRoles(); err == nil {
+		t.Fatalf("expected error for sender in two roles")
+	}
+	delete(cfg.Roles, "ops")
+	cfg.Roles["bad"] = Role{Sandbox: "yolo"}
+	if err := cfg.ValidateRoles(); err == nil {
+		t.Fatalf("expected error for unknown sandbox")
+	}
+}
+
+func TestLoadAgentsAndRoutes(t *testing.T) {
+	raw := []byte(`
+transports:
+  - type: mock
+    id: mock
+agents:
+  - name: coder
+    type: codexcli
+    config:
+      binary: codex
+  - name: quick
+    type: echo
+routes:
+  - agent: quick
+    prefix: "?"
+  - agent: quick
+    transport: mock
+    project: default
+`)
+	cfg, err := LoadBytes(raw, t.TempDir())
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(cfg.Agents) != 2 || cfg.Agents[1].Type != "echo" || cfg.Agents[0].Config.Sandbox == "" {
+		t.Fatalf("agents not parsed with defaults: %+v", cfg.Agents)
+	}
+
+	cfg.Routes = append(cfg.Routes, Route{Agent: "missing"})
+	if err := cfg.ValidateAgents(); err == nil || !strings.Contains(err.Error(), `unknown agent "missing"`) {
+		t.Fatalf("expected unknown agent error, got %v", err)
+	}
+	cfg.Routes[2] = Route{Agent: "quick", Project: "nope"}
+	if err := cfg.ValidateAgents(); err == nil {
+		t.Fatalf("expected unknown project error")
+	}
+	cfg.Routes = cfg.Routes[:2]
+	cfg.Agents[0].Fallback = []string{"quick", "gone"}
+	if err := cfg.ValidateAgents(); err == nil || !strings.Contains(err.Error(), `unknown fallback agent "gone"`) {
+		t.Fatalf("expected unknown fallback error, got %v", err)
+	}
+	cfg.Agents[0].Fallback = []string{"coder"}
+	if err := cfg.ValidateAgents(); err == nil {
+		t.Fatalf("expected self-fallback error")
+	}
+	cfg.Agents[0].Fallback = nil
+	cfg.Agents = append(cfg.Agents, NamedAgent{Name: "quick"})
+	if err := cfg.ValidateAgents(); err == nil {
+		t.Fatalf("expected duplicate agent error")
+	}
+}
+
+func TestSessionScopeValidation(t *testing.T) {
+	raw := []byte(`
+runner:
+  session_scope: thread
+transports:
+  - type: mock
+    id: mock
+    session_scope: sender
+`)
+	cfg, err := LoadBytes(raw, t.TempDir())
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.Runner.SessionScope != "thread" || cfg.Transports[0].SessionScope != "sender" {
+		t.Fatalf("scopes not parsed: %q %q", cfg.Runner.SessionScope, cfg.Transports[0].SessionScope)
+	}
+	cfg.Transports[0].SessionScope = "channel"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "session_scope") {
+		t.Fatalf("expected session_scope error, got %v", err)
+	}
+	cfg.Transports[0].SessionScope = ""
+	cfg.Runner.SessionScope = "room"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "runner.session_scope") {
+		t.Fatalf("expected runner.session_scope error, got %v", err)
+	}
+}
+
+func TestValidateUsers(t *testing.T) {
+	priv := nostr.GeneratePrivateKey()
+	pub, _ := nostr.GetPublicKey(priv)
+	npub, _ := nip19.EncodePublicKey(pub)
+	cfg := Config{
+		Transports: []TransportConfig{{Type: "nostr"}, {Type: "whatsapp", ID: "wa"}},
+		Roles:      map[string]Role{"admin": {Actions: []string{"*"}}},
+		Users: map[string]User{
+			"alice": {Role: "admin", Identities: map[string][]string{"nostr": {npub}, "wa": {"+15550001"}}},
+			"bob":   {Identities: map[string][]string{"wa": {"+15550002"}}},
+		},
+	}
+	cfg.applyDefaults(".")
+	if got := cfg.Users["alice"].Identities["nostr"][0]; got != pub {
+		t.Fatalf("user npub not normalized: %s", got)
+	}
+	if err := cfg.ValidateUsers(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if got := cfg.UserIdentities("wa"); len(got) != 2 || got[0] != "+15550001" || got[1] != "+15550002" {
+		t.Fatalf("unexpected identities %v", got)
+	}
+
+	bad := []map[string]User{
+		{"Alice": {Identities: map[string][]string{"wa": {"+1"}}}},
+		{"carol": {Role: "root", Identities: map[string][]string{"wa": {"+1"}}}},
+		{"carol": {}},
+		{"carol": {Identities: map[string][]string{"email": {"c@x"}}}},
+		{"carol": {Identities: map[string][]string{"wa": {"+15550001"}}}},
+	}
+	for _, extra := range bad {
+		c := cfg
+		c.Users = map[string]User{"alice": cfg.Users["alice"]}
+		for k, v := range extra {
+			c.Users[k] = v
+		}
+		if err := c.ValidateUsers(); err == nil {
+			t.Fatalf("expected error for %+v", extra)
+		}
+	}
+}
+
+func TestTransportRuntimeID(t *testing.T) {
+	cases := []struct {
+		t    TransportConfig
+		want string
+	}{
+		{TransportConfig{Type: "nostr"}, "nostr"},
+		{TransportConfig{Type: "mock", ID: "m1"}, "m1"},
+		{TransportConfig{Type: "email"}, "email-mailgun"},
+		{TransportConfig{Type: "email", Config: map[string]any{"mode": "imap"}}, "email-imap"},
+		{TransportConfig{Type: "email", ID: "mail"}, "mail"},
+		{TransportConfig{Type: "email", ID: "mail", Config: map[string]any{"id": "inbox"}}, "inbox"},
+		{TransportConfig{Type: "whatsapp", Config: map[string]any{"id": "wa"}}, "wa"},
+		{TransportConfig{Type: "whatsapp"}, "whatsapp"},
+	}
+	for _, c := range cases {
+		if got := c.t.RuntimeID(); got != c.want {
+			t.Fatalf("%+v: got %q want %q", c.t, got, c.want)
+		}
+	}
+
+	cfg := Config{
+		Transports: []TransportConfig{{Type: "email", Config: map[string]any{"mode": "imap"}}},
+		Agents:     []NamedAgent{{Name: "quick"}},
+		Routes:     []Route{{Agent: "quick", Transport: "email-imap"}},
+		Users:      map[string]User{"alice": {Identities: map[string][]string{"email-imap": {"a@x"}}}},
+	}
+	if err := cfg.ValidateAgents(); err != nil {
+		t.Fatalf("route on default email id: %v", err)
+	}
+	if err := cfg.ValidateUsers(); err != nil {
+		t.Fatalf("identity on default email id: %v", err)
+	}
+	cfg.Routes[0].Transport = "email"
+	if err := cfg.ValidateAgents(); err == nil {
+		t.Fatalf("expected unknown transport for the bare type")
+	}
+}
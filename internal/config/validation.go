@@ -1,7 +1,10 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"regexp"
+	"strings"
 )
 
 // ValidateTransports performs type-specific validation beyond core presence checks.
@@ -11,13 +14,14 @@ func (c *Config) ValidateTransports() error {
 		if t.Type == "" {
 			return fmt.Errorf("transport %d: type is required", i)
 		}
-		if t.ID == "" {
-			t.ID = t.Type
-		}
+		t.ID = t.RuntimeID()
 		if _, exists := seenIDs[t.ID]; exists {
 			return fmt.Errorf("transport id %q is duplicated", t.ID)
 		}
 		seenIDs[t.ID] = struct{}{}
+		if err := validSessionScope(t.SessionScope); err != nil {
+			return fmt.Errorf("transport %q: session_scope: %w", t.ID, err)
+		}
 
 		switch t.Type {
 		case "nostr":
@@ -77,3 +81,154 @@ func (c *Config) ValidateActions() error {
 	}
 	return nil
 }
+
+// ValidateApprovals ensures approval patterns compile.
+func (c *Config) ValidateApprovals() error {
+	for _, p := range c.Approvals.Patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return fmt.Errorf("approvals: invalid pattern %q: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// ValidateRateLimits rejects negative limits.
+func (c *Config) ValidateRateLimits() error {
+	check := func(where string, l RateLimit) error {
+		if l.MessagesPerMinute < 0 || l.ConcurrentRuns < 0 || l.TransportConcurrentRuns < 0 || l.DailyAgentMinutes < 0 {
+			return fmt.Errorf("%s: limits must not be negative", where)
+		}
+		return nil
+	}
+	if err := check("rate_limits", c.RateLimits.RateLimit); err != nil {
+		return err
+	}
+	for id, l := range c.RateLimits.Transports {
+		if err := check(fmt.Sprintf("rate_limits.transports.%s", id), l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateRoles checks sandbox levels and that each sender has at most one role.
+func (c *Config) ValidateRoles() error {
+	seen := make(map[string]string)
+	defaultRole := ""
+	for name, role := range c.Roles {
+		switch role.Sandbox {
+		case "", "read-only", "workspace-write", "danger-full-access":
+		default:
+			return fmt.Errorf("role %q: unknown sandbox %q", name, role.Sandbox)
+		}
+		if role.Default {
+			if defaultRole != "" {
+				return fmt.Errorf("roles %q and %q are both marked default", defaultRole, name)
+			}
+			defaultRole = name
+		}
+		for _, s := range role.Senders {
+			key := strings.ToLower(strings.TrimSpace(s))
+			if other, ok := seen[key]; ok {
+				return fmt.Errorf("sender %q is in roles %q and %q", s, other, name)
+			}
+			seen[key] = name
+		}
+	}
+	return nil
+}
+
+var userIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// ValidateUsers checks user IDs, that identities name configured transports and
+// belong to one user only, and that roles exist.
+func (c *Config) ValidateUsers() error {
+	transports := make(map[string]bool, len(c.Transports))
+	for _, t := range c.Transports {
+		transports[t.RuntimeID()] = true
+	}
+	seen := make(map[string]string)
+	for name, u := range c.Users {
+		if !userIDPattern.MatchString(name) {
+			return fmt.Errorf("user %q: id must be lowercase letters, digits, '.', '_' or '-'", name)
+		}
+		if u.Role != "" {
+			if _, ok := c.Roles[u.Role]; !ok {
+				return fmt.Errorf("user %q: unknown role %q", name, u.Role)
+			}
+		}
+		if len(u.Identities) == 0 {
+			return fmt.Errorf("user %q: at least one identity is required", name)
+		}
+		for transport, ids := range u.Identities {
+			if !transports[transport] {
+				return fmt.Errorf("user %q: unknown transport %q", name, transport)
+			}
+			for _, s := range ids {
+				key := transport + ":" + strings.ToLower(strings.TrimSpace(s))
+				if other, ok := seen[key]; ok {
+					return fmt.Errorf("identity %s:%s is linked to users %q and %q", transport, s, other, name)
+				}
+				seen[key] = name
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateAgents checks named agents and that routes refer to them.
+func (c *Config) ValidateAgents() error {
+	names := make(map[string]bool, len(c.Agents))
+	for i, a := range c.Agents {
+		name := strings.TrimSpace(a.Name)
+		if name == "" {
+			return fmt.Errorf("agents[%d]: name is required", i)
+		}
+		if names[name] {
+			return fmt.Errorf("agent %q defined twice", name)
+		}
+		names[name] = true
+	}
+	for _, a := range c.Agents {
+		for _, fb := range a.Fallback {
+			if !names[fb] {
+				return fmt.Errorf("agent %q: unknown fallback agent %q", a.Name, fb)
+			}
+			if fb == a.Name {
+				return fmt.Errorf("agent %q: cannot fall back to itself", a.Name)
+			}
+		}
+	}
+	projects := make(map[string]bool, len(c.Projects))
+	for _, p := range c.Projects {
+		projects[p.ID] = true
+	}
+	transports := make(map[string]bool, len(c.Transports))
+	for _, t := range c.Transports {
+		transports[t.RuntimeID()] = true
+	}
+	for i, r := range c.Routes {
+		if len(c.Agents) == 0 {
+			return errors.New("routes require an agents list")
+		}
+		if !names[r.Agent] {
+			return fmt.Errorf("routes[%d]: unknown agent %q", i, r.Agent)
+		}
+		if r.Transport != "" && !transports[r.Transport] {
+			return fmt.Errorf("routes[%d]: unknown transport %q", i, r.Transport)
+		}
+		if r.Project != "" && !projects[r.Project] {
+			return fmt.Errorf("routes[%d]: unknown project %q", i, r.Project)
+		}
+	}
+	return nil
+}
+
+// validSessionScope accepts the scopes core.ParseSessionScope understands.
+func validSessionScope(s string) error {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "sender", "thread", "sender+thread":
+		return nil
+	}
+	return fmt.Errorf("unknown scope %q (want sender, thread or sender+thread)", s)
+}
@@ -0,0 +1,152 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/joelklabo/buddy/internal/store"
+)
+
+// ApprovalStore persists action calls that wait for a human decision. store.Store
+// satisfies it; WithStore picks it up automatically.
+type ApprovalStore interface {
+	SavePendingApproval(p store.PendingApproval) error
+	TakePendingApproval(id string) (store.PendingApproval, bool, error)
+}
+
+// ApprovalPolicy selects agent action calls that must be approved by the sender
+// (/approve <id>) before they run.
+type ApprovalPolicy struct {
+	Actions  []string         // action names that always need approval
+	Patterns []*regexp.Regexp // matched against the raw call arguments
+	TTL      time.Duration    // how long a pending approval stays valid
+}
+
+// WithApprovalPolicy holds matching action calls for approval.
+func WithApprovalPolicy(p ApprovalPolicy) RunnerOption {
+	return func(r *Runner) {
+		if p.TTL <= 0 {
+			p.TTL = 30 * time.Minute
+		}
+		r.approvalPolicy = p
+	}
+}
+
+func (p ApprovalPolicy) requires(call ActionCall) bool {
+	for _, name := range p.Actions {
+		if name == call.Name {
+			return true
+		}
+	}
+	for _, re := range p.Patterns {
+		if re.Match(call.Args) {
+			return true
+		}
+	}
+	return false
+}
+
+// holdForApproval parks the call in the store and asks the sender to decide. The
+// returned text becomes the tool result the agent sees.
+func (r *Runner) holdForApproval(ctx context.Context, msg InboundMessage, call ActionCall, log *slog.Logger) ([]byte, error) {
+	if r.approvals == nil {
+		log.Warn("approval required but no store configured", slog.String("action", call.Name))
+		r.logAudit(call.Name, r.principal(msg), "denied", 0)
+		return nil, errors.New("action requires approval, but approvals are unavailable")
+	}
+	id, err := newApprovalID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	p := store.PendingApproval{
+		ID:        id,
+		Transport: msg.Transport,
+		Sender:    msg.Sender,
+		ThreadID:  msg.ThreadID,
+		Action:    call.Name,
+		Args:      call.Args,
+		CreatedAt: now,
+		ExpiresAt: now.Add(r.approvalPolicy.TTL),
+	}
+	if err := r.approvals.SavePendingApproval(p); err != nil {
+		return nil, fmt.Errorf("save approval: %w", err)
+	}
+	log.Info("action held for approval", slog.String("action", call.Name), slog.String("approval", id))
+	r.logAudit(call.Name, r.principal(msg), "pending", 0)
+	r.sendSimple(ctx, msg.Transport, msg.Sender, msg.ThreadID, fmt.Sprintf(
+		"Approval needed: %s %s\nReply /approve %s or /deny %s within %s.",
+		call.Name, snippet(string(call.Args), 200), id, id, r.approvalPolicy.TTL.Round(time.Minute)))
+	return []byte(fmt.Sprintf("held for human approval (id %s); not executed yet", id)), nil
+}
+
+// resolveApproval handles /approve and /deny.
+func (r *Runner) resolveApproval(ctx context.Context, msg InboundMessage, approve bool, id string, log *slog.Logger) {
+	reply := func(text string) { r.sendSimple(ctx, msg.Transport, msg.Sender, msg.ThreadID, text) }
+	if r.approvals == nil {
+		reply("Approvals are not enabled.")
+		return
+	}
+	if id == "" {
+		reply("Usage: /approve <id> or /deny <id>")
+		return
+	}
+	p, ok, err := r.approvals.TakePendingApproval(id)
+	if err != nil {
+		reply(fmt.Sprintf("Failed to load approval: %v", err))
+		return
+	}
+	if ok && (p.Transport != msg.Transport || !strings.EqualFold(p.Sender, msg.Sender)) {
+		// Not this sender's approval; put it back untouched.
+		_ = r.approvals.SavePendingApproval(p)
+		ok = false
+	}
+	if !ok {
+		reply(fmt.Sprintf("No pending approval %s.", id))
+		return
+	}
+	if p.Expired(time.Now()) {
+		r.logAudit(p.Action, r.principal(msg), "expired", 0)
+		reply(fmt.Sprintf("Approval %s expired; ask the agent again.", id))
+		return
+	}
+	if !approve {
+		log.Info("action denied by sender", slog.String("action", p.Action), slog.String("approval", id))
+		r.logAudit(p.Action, r.principal(msg), "denied", 0)
+		reply(fmt.Sprintf("Denied %s (%s).", p.Action, id))
+		return
+	}
+
+	act, ok := r.actions[p.Action]
+	if !ok {
+		reply(fmt.Sprintf("Action %s is no longer available.", p.Action))
+		return
+	}
+	log.Info("action approved by sender", slog.String("action", p.Action), slog.String("approval", id))
+	r.logAudit(p.Action, r.principal(msg), "approved", 0)
+	runCtx, done := r.trackRun(ctx, msg, p.Action+" action", "approval "+id)
+	defer done()
+	out, err := r.execAction(runCtx, msg, act, ActionCall{Name: p.Action, Args: p.Args}, log)
+	switch {
+	case runCancelled(runCtx):
+	case err != nil:
+		reply(fmt.Sprintf("%s error: %v", p.Action, err))
+	default:
+		r.replyLong(ctx, msg, fmt.Sprintf("[%s]\n%s", p.Action, string(out)), log)
+	}
+}
+
+func newApprovalID() (string, error) {
+	b := make([]byte, 3)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
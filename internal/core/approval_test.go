@@ -0,0 +1,142 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joelklabo/buddy/internal/store"
+)
+
+// approvalStore is an in-memory ApprovalStore layered on memoryStore.
+type approvalStore struct {
+	memoryStore
+	pending map[string]store.PendingApproval
+}
+
+func (a *approvalStore) SavePendingApproval(p store.PendingApproval) error {
+	if a.pending == nil {
+		a.pending = map[string]store.PendingApproval{}
+	}
+	a.pending[p.ID] = p
+	return nil
+}
+
+func (a *approvalStore) TakePendingApproval(id string) (store.PendingApproval, bool, error) {
+	p, ok := a.pending[id]
+	delete(a.pending, id)
+	return p, ok, nil
+}
+
+// pipeAction is a /shell action that counts its invocations.
+type pipeAction struct {
+	shellAction
+	name  string
+	calls int
+}
+
+func (p *pipeAction) Name() string           { return p.name }
+func (p *pipeAction) Capabilities() []string { return nil }
+func (p *pipeAction) Help() string           { return "" }
+func (p *pipeAction) Invoke(ctx context.Context, args json.RawMessage) (json.RawMessage, error) {
+	p.calls++
+	return json.RawMessage(`"removed"`), nil
+}
+
+func newApprovalRunner(st *approvalStore, act Action, audit *auditRecorder) (*Runner, chan OutboundMessage) {
+	r := NewRunner(nil, &mockAgent{}, []Action{act}, slog.Default(), WithStore(st), WithAuditLogger(audit),
+		WithApprovalPolicy(ApprovalPolicy{Patterns: []*regexp.Regexp{regexp.MustCompile(`\brm\b`)}}))
+	outCh := make(chan OutboundMessage, 8)
+	r.transportMap = map[string]Transport{"mock": &transportSpy{out: outCh}}
+	return r, outCh
+}
+
+func drain(ch chan OutboundMessage) []string {
+	var out []string
+	for {
+		select {
+		case m := <-ch:
+			out = append(out, m.Text)
+		default:
+			return out
+		}
+	}
+}
+
+func TestRiskyActionHeldUntilApproved(t *testing.T) {
+	st := &approvalStore{}
+	act := &pipeAction{name: "shell"}
+	audit := &auditRecorder{}
+	r, outCh := newApprovalRunner(st, act, audit)
+	r.agent = &scriptedAgent{call: ActionCall{Name: "shell", Args: []byte(`{"command":"rm -rf build"}`)}}
+
+	r.handleMessage(context.Background(), InboundMessage{Transport: "mock", Sender: "alice", Text: "clean", ThreadID: "t"})
+	if act.calls != 0 {
+		t.Fatalf("risky action ran without approval")
+	}
+	if len(st.pending) != 1 {
+		t.Fatalf("expected one pending approval, got %d", len(st.pending))
+	}
+	var id string
+	for k := range st.pending {
+		id = k
+	}
+	msgs := drain(outCh)
+	if len(msgs) != 2 || !strings.Contains(msgs[0], "/approve "+id) || !strings.Contains(msgs[1], "held for human approval") {
+		t.Fatalf("unexpected messages %q", msgs)
+	}
+
+	// Another sender cannot approve it.
+	captureSend(r, InboundMessage{Transport: "mock", Sender: "mallory", Text: "/approve " + id, ThreadID: "t"})
+	if act.calls != 0 || len(st.pending) != 1 {
+		t.Fatalf("approval by another sender should be refused")
+	}
+
+	out := captureSend(r, InboundMessage{Transport: "mock", Sender: "alice", Text: "/approve " + id, ThreadID: "t"})
+	if act.calls != 1 || !strings.Contains(out, "removed") {
+		t.Fatalf("approved action did not run: calls=%d out=%q", act.calls, out)
+	}
+	got := strings.Join(audit.snapshot(), ",")
+	if got != "shell:pending,shell:approved,shell:ok" {
+		t.Fatalf("unexpected audit trail %s", got)
+	}
+}
+
+func TestDenyAndExpiredApprovals(t *testing.T) {
+	st := &approvalStore{}
+	act := &pipeAction{name: "shell"}
+	audit := &auditRecorder{}
+	r, _ := newApprovalRunner(st, act, audit)
+
+	_ = st.SavePendingApproval(store.PendingApproval{ID: "aaa111", Transport: "mock", Sender: "alice", Action: "shell", ExpiresAt: time.Now().Add(time.Minute)})
+	_ = st.SavePendingApproval(store.PendingApproval{ID: "bbb222", Transport: "mock", Sender: "alice", Action: "shell", ExpiresAt: time.Now().Add(-time.Minute)})
+
+	if out := captureSend(r, InboundMessage{Transport: "mock", Sender: "alice", Text: "/deny aaa111"}); !strings.Contains(out, "Denied") {
+		t.Fatalf("unexpected deny reply %q", out)
+	}
+	if out := captureSend(r, InboundMessage{Transport: "mock", Sender: "alice", Text: "/approve bbb222"}); !strings.Contains(out, "expired") {
+		t.Fatalf("unexpected expired reply %q", out)
+	}
+	if act.calls != 0 {
+		t.Fatalf("denied/expired action must not run")
+	}
+	if got := strings.Join(audit.snapshot(), ","); got != "shell:denied,shell:expired" {
+		t.Fatalf("unexpected audit trail %s", got)
+	}
+}
+
+// scriptedAgent requests one action call, then answers with the tool result.
+type scriptedAgent struct{ call ActionCall }
+
+func (s *scriptedAgent) Generate(ctx context.Context, req AgentRequest) (AgentResponse, error) {
+	for _, st := range req.Steps {
+		if st.Role == "tool" {
+			return AgentResponse{Reply: st.Text}, nil
+		}
+	}
+	return AgentResponse{ActionCalls: []ActionCall{s.call}}, nil
+}
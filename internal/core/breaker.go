@@ -0,0 +1,128 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/joelklabo/buddy/internal/metrics"
+)
+
+// BreakerPolicy opens an agent's circuit after Failures consecutive failed
+// calls; while open, calls fail fast until Cooldown has passed, then a single
+// probe call decides whether it closes again. Failures <= 0 disables it.
+type BreakerPolicy struct {
+	Failures int
+	Cooldown time.Duration
+}
+
+// WithBreakerPolicy sets the per-agent circuit breaker.
+func WithBreakerPolicy(p BreakerPolicy) RunnerOption {
+	return func(r *Runner) { r.breakerPolicy = p }
+}
+
+// ErrCircuitOpen is returned, wrapped in a CircuitOpenError, while an agent's
+// circuit is open.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// CircuitOpenError reports an agent that is failing fast.
+type CircuitOpenError struct {
+	Agent   string
+	Until   time.Time
+	LastErr string
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("agent %s unavailable: %v (last error: %s)", e.Agent, ErrCircuitOpen, e.LastErr)
+}
+
+func (e *CircuitOpenError) Unwrap() error { return ErrCircuitOpen }
+
+// Breaker states, as reported by the runner_agent_circuit_state metric.
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
+
+type breaker struct {
+	failures  int
+	openUntil time.Time
+	probing   bool
+	lastErr   string
+}
+
+// breakerAllow reports whether a call to agent may proceed. After the cooldown
+// one caller is let through as a probe; others keep failing fast until it ends.
+func (r *Runner) breakerAllow(agent string) error {
+	if r.breakerPolicy.Failures <= 0 {
+		return nil
+	}
+	r.breakerMu.Lock()
+	defer r.breakerMu.Unlock()
+	b := r.breakers[agent]
+	if b == nil || b.failures < r.breakerPolicy.Failures {
+		return nil
+	}
+	if time.Now().Before(b.openUntil) || b.probing {
+		return &CircuitOpenError{Agent: agent, Until: b.openUntil, LastErr: b.lastErr}
+	}
+	b.probing = true
+	metrics.SetAgentCircuitState(agent, CircuitHalfOpen)
+	return nil
+}
+
+// breakerRecord updates agent's circuit with the outcome of a call. Permanent
+// errors say nothing about the backend's health; they only end a probe.
+func (r *Runner) breakerRecord(agent string, err error) {
+	if r.breakerPolicy.Failures <= 0 {
+		return
+	}
+	if err != nil && IsPermanent(err) {
+		r.breakerRelease(agent)
+		return
+	}
+	r.breakerMu.Lock()
+	defer r.breakerMu.Unlock()
+	if r.breakers == nil {
+		r.breakers = map[string]*breaker{}
+	}
+	b := r.breakers[agent]
+	if b == nil {
+		b = &breaker{}
+		r.breakers[agent] = b
+	}
+	b.probing = false
+	if err == nil {
+		if b.failures >= r.breakerPolicy.Failures {
+			metrics.SetAgentCircuitState(agent, CircuitClosed)
+		}
+		b.failures = 0
+		return
+	}
+	b.failures++
+	b.lastErr = err.Error()
+	if b.failures >= r.breakerPolicy.Failures {
+		b.openUntil = time.Now().Add(r.breakerPolicy.Cooldown)
+		metrics.SetAgentCircuitState(agent, CircuitOpen)
+	}
+}
+
+// breakerRelease ends agent's probe, if one is running, without recording an
+// outcome, so a cancelled or inconclusive probe lets the next call probe again.
+func (r *Runner) breakerRelease(agent string) {
+	r.breakerMu.Lock()
+	defer r.breakerMu.Unlock()
+	if b := r.breakers[agent]; b != nil {
+		b.probing = false
+	}
+}
+
+// circuitMessage is the reply sent while an agent's circuit is open.
+func circuitMessage(e *CircuitOpenError) string {
+	wait := time.Until(e.Until).Round(time.Second)
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return fmt.Sprintf("The %s agent is failing (%s). Not sending new requests for %s; try again after that.", e.Agent, e.LastErr, wait)
+}
@@ -0,0 +1,115 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// downAgent fails every call until up is set.
+type downAgent struct {
+	calls int
+	up    bool
+}
+
+func (d *downAgent) Generate(ctx context.Context, req AgentRequest) (AgentResponse, error) {
+	d.calls++
+	if !d.up {
+		return AgentResponse{}, errors.New("connection refused")
+	}
+	return AgentResponse{Reply: "back"}, nil
+}
+
+func TestBreakerFailsFastAndRecovers(t *testing.T) {
+	agent := &downAgent{}
+	r := NewRunner(nil, agent, nil, slog.Default(),
+		WithRetryPolicy(RetryPolicy{Attempts: 1}),
+		WithBreakerPolicy(BreakerPolicy{Failures: 2, Cooldown: 50 * time.Millisecond}))
+	outCh := make(chan OutboundMessage, 8)
+	r.transportMap = map[string]Transport{"mock": &transportSpy{out: outCh}}
+	send := func() []string {
+		r.handleMessage(context.Background(), InboundMessage{Transport: "mock", Sender: "alice", Text: "hi", ThreadID: "t"})
+		return drain(outCh)
+	}
+
+	send()
+	send()
+	if agent.calls != 2 {
+		t.Fatalf("expected 2 agent calls before the circuit opens, got %d", agent.calls)
+	}
+	got := send()
+	if agent.calls != 2 || len(got) != 1 || !strings.Contains(got[0], "agent is failing (connection refused)") {
+		t.Fatalf("expected fast failure without calling the agent, got %d calls, %q", agent.calls, got)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	agent.up = true
+	if got := send(); len(got) != 1 || got[0] != "back" {
+		t.Fatalf("probe after cooldown should reach the agent, got %q", got)
+	}
+	agent.up = false
+	send()
+	if agent.calls != 4 {
+		t.Fatalf("a success should close the circuit, got %d calls", agent.calls)
+	}
+}
+
+func TestBreakerIgnoresPermanentErrors(t *testing.T) {
+	r := &Runner{breakerPolicy: BreakerPolicy{Failures: 1, Cooldown: time.Minute}}
+	r.breakerRecord("codex", Permanent(errors.New("prompt is empty")))
+	if err := r.breakerAllow("codex"); err != nil {
+		t.Fatalf("permanent error opened the circuit: %v", err)
+	}
+	r.breakerRecord("codex", errors.New("timeout"))
+	if err := r.breakerAllow("codex"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected open circuit, got %v", err)
+	}
+}
+
+// funcAgent answers with fn.
+type funcAgent func(ctx context.Context, req AgentRequest) (AgentResponse, error)
+
+func (f funcAgent) Generate(ctx context.Context, req AgentRequest) (AgentResponse, error) {
+	return f(ctx, req)
+}
+
+// openBreaker returns a runner whose default agent's circuit is open and whose
+// cooldown has already passed, so the next call is the half-open probe.
+func openBreaker(t *testing.T, agent Agent) *Runner {
+	t.Helper()
+	r := NewRunner(nil, agent, nil, slog.Default(),
+		WithRetryPolicy(RetryPolicy{Attempts: 1}),
+		WithBreakerPolicy(BreakerPolicy{Failures: 1, Cooldown: time.Millisecond}))
+	r.breakerRecord("default", errors.New("timeout"))
+	time.Sleep(5 * time.Millisecond)
+	return r
+}
+
+func TestBreakerCancelledProbeAllowsNextProbe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := openBreaker(t, funcAgent(func(ctx context.Context, req AgentRequest) (AgentResponse, error) {
+		cancel()
+		return AgentResponse{}, ctx.Err()
+	}))
+	if _, err := r.callAgentWithRetry(ctx, AgentRequest{Prompt: "hi"}, slog.Default()); errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("first call after cooldown should probe, got %v", err)
+	}
+	if err := r.breakerAllow("default"); err != nil {
+		t.Fatalf("cancelled probe left the circuit stuck: %v", err)
+	}
+}
+
+func TestBreakerPermanentProbeFailureAllowsNextProbe(t *testing.T) {
+	r := openBreaker(t, funcAgent(func(ctx context.Context, req AgentRequest) (AgentResponse, error) {
+		return AgentResponse{}, Permanent(errors.New("prompt is empty"))
+	}))
+	if _, err := r.callAgentWithRetry(context.Background(), AgentRequest{}, slog.Default()); errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("first call after cooldown should probe, got %v", err)
+	}
+	if err := r.breakerAllow("default"); err != nil {
+		t.Fatalf("permanently failed probe left the circuit stuck: %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// errRunCancelled is the cancellation cause for runs stopped with /cancel.
+var errRunCancelled = errors.New("cancelled by sender")
+
+// inflightRun tracks a running agent or action request for one conversation.
+type inflightRun struct {
+	cancel  context.CancelCauseFunc
+	label   string
+	started time.Time
+
+	mu    sync.Mutex
+	stage string
+}
+
+func (f *inflightRun) setStage(stage string) {
+	f.mu.Lock()
+	f.stage = stage
+	f.mu.Unlock()
+}
+
+func (f *inflightRun) describe() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return fmt.Sprintf("%s for %q", f.stage, f.label)
+}
+
+// trackRun registers a cancellable run for the message's conversation. The returned
+// func must be called when the run ends.
+func (r *Runner) trackRun(parent context.Context, msg InboundMessage, stage, label string) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(parent)
+	run := &inflightRun{cancel: cancel, label: snippet(label, 60), started: time.Now(), stage: stage}
+	key := r.runKey(msg)
+
+	r.inflightMu.Lock()
+	if r.inflight == nil {
+		r.inflight = make(map[string]*inflightRun)
+	}
+	r.inflight[key] = run
+	r.inflightMu.Unlock()
+
+	return ctx, func() {
+		r.inflightMu.Lock()
+		if r.inflight[key] == run {
+			delete(r.inflight, key)
+		}
+		r.inflightMu.Unlock()
+		cancel(nil)
+	}
+}
+
+// setRunStage records what the conversation's in-flight run is currently doing.
+func (r *Runner) setRunStage(msg InboundMessage, stage string) {
+	r.inflightMu.Lock()
+	run := r.inflight[r.runKey(msg)]
+	r.inflightMu.Unlock()
+	if run != nil {
+		run.setStage(stage)
+	}
+}
+
+// cancelRun stops the conversation's in-flight run and describes what was stopped.
+func (r *Runner) cancelRun(msg InboundMessage) (string, bool) {
+	r.inflightMu.Lock()
+	run := r.inflight[r.runKey(msg)]
+	r.inflightMu.Unlock()
+	if run == nil {
+		return "", false
+	}
+	run.cancel(errRunCancelled)
+	return fmt.Sprintf("Cancelled %s after %s.", run.describe(), time.Since(run.started).Round(time.Second)), true
+}
+
+// runCancelled reports whether ctx was stopped by /cancel.
+func runCancelled(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errRunCancelled)
+}
+
+// snippet shortens s to at most max runes for display.
+func snippet(s string, max int) string {
+	rs := []rune(s)
+	if len(rs) <= max {
+		return s
+	}
+	return string(rs[:max]) + "…"
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// blockingAgent waits until its context is done.
+type blockingAgent struct{ started chan struct{} }
+
+func (b *blockingAgent) Generate(ctx context.Context, req AgentRequest) (AgentResponse, error) {
+	close(b.started)
+	<-ctx.Done()
+	return AgentResponse{}, ctx.Err()
+}
+
+func TestCancelStopsInFlightRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tr := &mockTransport{id: "mock"}
+	ag := &blockingAgent{started: make(chan struct{})}
+	audit := &auditRecorder{}
+	r := NewRunner([]Transport{tr}, ag, nil, nil, WithAuditLogger(audit))
+
+	done := make(chan struct{})
+	go func() {
+		_ = r.Start(ctx)
+		close(done)
+	}()
+
+	inCh := waitForChannel(t, tr.inboundChan)
+	inCh <- InboundMessage{Transport: "mock", Sender: "alice", Text: "refactor everything", ThreadID: "t"}
+	select {
+	case <-ag.started:
+	case <-time.After(time.Second):
+		t.Fatal("agent never started")
+	}
+	inCh <- InboundMessage{Transport: "mock", Sender: "alice", Text: "/cancel", ThreadID: "t"}
+
+	deadline := time.After(2 * time.Second)
+	for len(audit.snapshot()) == 0 {
+		select {
+		case <-deadline:
+			t.Fatal("run was not cancelled")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	cancel()
+	<-done
+
+	sent := tr.sentMessages()
+	if len(sent) != 1 || !strings.Contains(sent[0].Text, `Cancelled agent run for "refactor everything"`) {
+		t.Fatalf("expected single cancel confirmation, got %+v", sent)
+	}
+	if got := audit.snapshot(); got[0] != "agent:cancelled" {
+		t.Fatalf("expected cancelled audit outcome, got %v", got)
+	}
+}
+
+func TestCancelWithNothingRunning(t *testing.T) {
+	r := NewRunner(nil, &mockAgent{}, nil, nil)
+	out := captureSend(r, InboundMessage{Transport: "mock", Sender: "alice", Text: "/cancel", ThreadID: "t"})
+	if out != "Nothing is running." {
+		t.Fatalf("unexpected reply %q", out)
+	}
+}
@@ -0,0 +1,144 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/joelklabo/buddy/internal/commands"
+)
+
+// CommandAction is an Action that also answers to a slash command, such as
+// /shell. NewRunner registers the command alongside the built-ins.
+type CommandAction interface {
+	Action
+	Command() commands.Spec
+	// CommandArgs turns the parsed command into the action's JSON arguments.
+	CommandArgs(cmd commands.Command) (json.RawMessage, error)
+}
+
+// WithStrictCommands requires the slash for every command, so a message that
+// starts with "new" or "status" always goes to the agent.
+func WithStrictCommands(strict bool) RunnerOption {
+	return func(r *Runner) { r.strictCommands = strict }
+}
+
+// buildCommands registers the built-in commands, those of configured features
+// and those declared by actions.
+func (r *Runner) buildCommands() {
+	reg := commands.NewRegistry()
+	reg.SetStrict(r.strictCommands)
+	specs := commands.Builtins()
+	if len(r.namedAgents) > 0 {
+		specs = append(specs, commands.Spec{Name: "agent", Usage: "[name|auto]", Help: "pick the agent for this conversation", MaxArgs: 1})
+	}
+	if len(r.projects) > 0 {
+		specs = append(specs,
+			commands.Spec{Name: "projects", Help: "list projects"},
+			commands.Spec{Name: "project", Usage: "[id]", Help: "switch project", MaxArgs: 1},
+		)
+	}
+	for _, s := range specs {
+		if err := reg.Register(s); err != nil {
+			r.logger.Warn("command not registered", slog.String("err", err.Error()))
+		}
+	}
+	r.actionCommands = map[string]CommandAction{}
+	for _, spec := range r.actionSpecs {
+		act, ok := r.actions[spec.Name].(CommandAction)
+		if !ok {
+			continue
+		}
+		cs := act.Command()
+		if err := reg.Register(cs); err != nil {
+			r.logger.Warn("action command not registered", slog.String("action", spec.Name), slog.String("err", err.Error()))
+			continue
+		}
+		r.actionCommands[strings.ToLower(cs.Name)] = act
+	}
+	r.commands = reg
+}
+
+// registry returns the runner's commands; runners not built by NewRunner get
+// the built-ins.
+func (r *Runner) registry() *commands.Registry {
+	if r.commands == nil {
+		reg := commands.NewRegistry()
+		for _, s := range commands.Builtins() {
+			_ = reg.Register(s)
+		}
+		return reg
+	}
+	return r.commands
+}
+
+// parse parses text with the runner's commands.
+func (r *Runner) parse(text string) commands.Command {
+	return r.registry().Parse(text)
+}
+
+// runActionCommand invokes the action behind a command such as /shell. The call
+// goes through invokeAction, so commands get the same allow list, role checks,
+// approvals, timeout and audit entries as calls the agent makes.
+func (r *Runner) runActionCommand(ctx context.Context, msg InboundMessage, act CommandAction, cmd commands.Command, log *slog.Logger) {
+	reply := func(text string) { r.sendSimple(ctx, msg.Transport, msg.Sender, msg.ThreadID, text) }
+	name := act.Name()
+	args, err := act.CommandArgs(cmd)
+	if err != nil {
+		reply(err.Error())
+		return
+	}
+	call := ActionCall{Name: name, Args: args}
+	runCtx, done := r.trackRun(ctx, msg, name+" command", cmd.Args)
+	defer done()
+	out, err := r.invokeAction(runCtx, msg, call, log)
+	if runCancelled(runCtx) {
+		return
+	}
+	if err != nil {
+		reply(fmt.Sprintf("%s error: %v", name, err))
+		return
+	}
+	if r.approvalPolicy.requires(call) {
+		// holdForApproval already told the sender how to approve the call.
+		return
+	}
+	r.replyLong(ctx, msg, string(out), log)
+}
+
+// renderHelp lists the registered commands, then the help of actions that have
+// no command of their own.
+func (r *Runner) renderHelp() string {
+	reg := r.registry()
+	lines := []string{"Commands:", reg.Help()}
+	if !r.strictCommands {
+		var bare []string
+		for _, s := range reg.Specs() {
+			if s.Bare {
+				bare = append(bare, "/"+s.Name)
+			}
+		}
+		if len(bare) > 0 {
+			lines = append(lines, fmt.Sprintf("%s also work without the slash when the rest of the message fits.", strings.Join(bare, ", ")))
+		}
+	}
+	if len(r.projects) > 0 {
+		lines = append(lines, fmt.Sprintf("Projects: %s.", r.projectList()))
+	}
+	if len(r.namedAgents) > 0 {
+		lines = append(lines, fmt.Sprintf("Agents: %s.", strings.Join(r.agentNames(), ", ")))
+	}
+	for _, spec := range r.actionSpecs {
+		act, ok := r.actions[spec.Name]
+		if _, declared := act.(CommandAction); !ok || declared {
+			continue
+		}
+		if h := act.Help(); strings.TrimSpace(h) != "" {
+			lines = append(lines, h)
+		}
+	}
+	lines = append(lines, "Anything else runs as a prompt.")
+	return strings.Join(lines, "\n")
+}
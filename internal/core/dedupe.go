@@ -0,0 +1,116 @@
+package core
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/joelklabo/buddy/internal/metrics"
+)
+
+// DedupeStore remembers inbound message IDs so redeliveries are dropped.
+// store.Store satisfies it; WithStore picks it up automatically.
+type DedupeStore interface {
+	InboundSeen(key string, ttl time.Duration) (bool, error)
+	RecordInbound(key string) error
+	PruneInbound(cutoff time.Time) (int, error)
+}
+
+// WithDedupeTTL sets how long an inbound MessageID is remembered. Zero or
+// negative disables deduplication.
+func WithDedupeTTL(d time.Duration) RunnerOption {
+	return func(r *Runner) { r.dedupeTTL = d }
+}
+
+// dedupeKey is the key msg's MessageID is remembered under, or "" when msg is
+// not deduplicated.
+func (r *Runner) dedupeKey(msg InboundMessage) string {
+	if msg.MessageID == "" || r.dedupeTTL <= 0 {
+		return ""
+	}
+	return msg.Transport + ":" + msg.MessageID
+}
+
+// duplicate reports whether msg was already taken from its transport. It only
+// checks; markSeen (or the inbound queue) records a message once it is taken.
+// Messages without a MessageID are never considered duplicates.
+func (r *Runner) duplicate(msg InboundMessage) bool {
+	key := r.dedupeKey(msg)
+	if key == "" {
+		return false
+	}
+	if r.dedupe != nil {
+		seen, err := r.dedupe.InboundSeen(key, r.dedupeTTL)
+		if err != nil {
+			r.logger.Warn("dedupe check failed", slog.String("transport", msg.Transport), slog.String("err", err.Error()))
+			return false
+		}
+		return seen
+	}
+	r.dedupeMu.Lock()
+	defer r.dedupeMu.Unlock()
+	last, ok := r.seen[key]
+	return ok && time.Since(last) < r.dedupeTTL
+}
+
+// markSeen records that msg was taken, so later deliveries are duplicates.
+func (r *Runner) markSeen(msg InboundMessage) {
+	key := r.dedupeKey(msg)
+	if key == "" {
+		return
+	}
+	if r.dedupe != nil {
+		if err := r.dedupe.RecordInbound(key); err != nil {
+			r.logger.Warn("dedupe record failed", slog.String("transport", msg.Transport), slog.String("err", err.Error()))
+		}
+		return
+	}
+	r.dedupeMu.Lock()
+	defer r.dedupeMu.Unlock()
+	if r.seen == nil {
+		r.seen = map[string]time.Time{}
+	}
+	r.seen[key] = time.Now()
+}
+
+// runDedupePrune drops expired message IDs every hour until ctx is done.
+func (r *Runner) runDedupePrune(ctx context.Context) {
+	if r.dedupeTTL <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		r.pruneSeen(time.Now().Add(-r.dedupeTTL))
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Runner) pruneSeen(cutoff time.Time) {
+	if r.dedupe != nil {
+		if n, err := r.dedupe.PruneInbound(cutoff); err != nil {
+			r.logger.Warn("dedupe prune failed", slog.String("err", err.Error()))
+		} else if n > 0 {
+			r.logger.Debug("pruned inbound message ids", slog.Int("count", n))
+		}
+		return
+	}
+	r.dedupeMu.Lock()
+	defer r.dedupeMu.Unlock()
+	for k, t := range r.seen {
+		if t.Before(cutoff) {
+			delete(r.seen, k)
+		}
+	}
+}
+
+// dropDuplicate logs and counts a redelivered message.
+func (r *Runner) dropDuplicate(msg InboundMessage) {
+	r.logger.Info("duplicate inbound message dropped",
+		slog.String("transport", msg.Transport), slog.String("sender", msg.Sender), slog.String("message_id", msg.MessageID))
+	metrics.IncDuplicateInbound(msg.Transport)
+}
@@ -0,0 +1,53 @@
+package core
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestRunnerDropsRedeliveredMessages(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	agent := &mockAgent{reply: "ok"}
+	tr := &mockTransport{id: "mock"}
+	r := NewRunner([]Transport{tr}, agent, nil, slog.Default())
+	go func() { _ = r.Start(ctx) }()
+
+	inCh := waitForChannel(t, tr.inboundChan)
+	for _, id := range []string{"SM1", "SM1", "", "", "SM2"} {
+		inCh <- InboundMessage{Transport: "mock", Sender: "alice", Text: "hi " + id, MessageID: id}
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(tr.sentMessages()) < 4 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if sent := tr.sentMessages(); len(sent) != 4 {
+		t.Fatalf("expected 4 replies (one duplicate dropped), got %d: %+v", len(sent), sent)
+	}
+}
+
+func TestDedupeTTLExpires(t *testing.T) {
+	r := &Runner{dedupeTTL: time.Hour}
+	msg := InboundMessage{Transport: "imap", MessageID: "<a@b>"}
+	if r.duplicate(msg) || r.duplicate(msg) {
+		t.Fatalf("checking must not record the message")
+	}
+	r.markSeen(msg)
+	if !r.duplicate(msg) {
+		t.Fatalf("expected a sighting after markSeen to be a duplicate")
+	}
+	if r.duplicate(InboundMessage{Transport: "mailgun", MessageID: "<a@b>"}) {
+		t.Fatalf("IDs are scoped per transport")
+	}
+	r.seen["imap:<a@b>"] = time.Now().Add(-2 * time.Hour)
+	if r.duplicate(msg) {
+		t.Fatalf("expired ID still treated as duplicate")
+	}
+	r.pruneSeen(time.Now().Add(time.Minute))
+	if len(r.seen) != 0 {
+		t.Fatalf("prune left %d ids", len(r.seen))
+	}
+}
@@ -0,0 +1,100 @@
+package core
+
+import (
+	"sync"
+
+	"github.com/joelklabo/buddy/internal/metrics"
+)
+
+// WithMaxConcurrency caps how many conversations are processed at once.
+// Values below 1 process one message at a time.
+func WithMaxConcurrency(n int) RunnerOption {
+	return func(r *Runner) { r.maxConcurrency = n }
+}
+
+// dispatcher runs messages for different conversations in parallel while keeping
+// messages of the same conversation strictly ordered. Each conversation with pending
+// work has one goroutine draining its queue; a semaphore bounds how many of them
+// run the handler at the same time.
+type dispatcher struct {
+	handle func(InboundMessage)
+	key    func(InboundMessage) string
+	sem    chan struct{}
+
+	mu     sync.Mutex
+	queues map[string][]InboundMessage
+	wg     sync.WaitGroup
+}
+
+// newDispatcher orders messages by key, which names their conversation.
+func newDispatcher(limit int, key func(InboundMessage) string, handle func(InboundMessage)) *dispatcher {
+	if limit < 1 {
+		limit = 1
+	}
+	return &dispatcher{
+		handle: handle,
+		key:    key,
+		sem:    make(chan struct{}, limit),
+		queues: make(map[string][]InboundMessage),
+	}
+}
+
+// runKey groups messages that must be handled in order: those sharing a
+// session, as sessionBase scopes it. Under sender scope that is the sender, or
+// the linked user across transports; under the thread scopes each thread runs
+// on its own. /cancel stops the run of the same conversation.
+func (r *Runner) runKey(msg InboundMessage) string {
+	return r.sessionBase(msg).String()
+}
+
+// submit queues msg behind any pending work for the same conversation.
+func (d *dispatcher) submit(msg InboundMessage) {
+	key := d.key(msg)
+	metrics.IncQueueDepth()
+
+	d.mu.Lock()
+	q, active := d.queues[key]
+	d.queues[key] = append(q, msg)
+	d.mu.Unlock()
+
+	if !active {
+		d.wg.Add(1)
+		go d.drain(key)
+	}
+}
+
+func (d *dispatcher) drain(key string) {
+	defer d.wg.Done()
+	for {
+		d.mu.Lock()
+		q := d.queues[key]
+		if len(q) == 0 {
+			delete(d.queues, key)
+			d.mu.Unlock()
+			return
+		}
+		msg := q[0]
+		d.queues[key] = q[1:]
+		d.mu.Unlock()
+
+		d.sem <- struct{}{}
+		metrics.DecQueueDepth()
+		d.handle(msg)
+		<-d.sem
+	}
+}
+
+// bypass handles msg right away, outside its conversation's queue and the
+// concurrency cap. Used for control commands such as /cancel.
+func (d *dispatcher) bypass(msg InboundMessage) {
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		d.handle(msg)
+	}()
+}
+
+// wait blocks until every queued message has been handled.
+func (d *dispatcher) wait() {
+	d.wg.Wait()
+}
@@ -0,0 +1,93 @@
+package core
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDispatcherOrdersPerConversation(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+	d := newDispatcher(4, new(Runner).runKey, func(msg InboundMessage) {
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		got = append(got, msg.Text)
+		mu.Unlock()
+	})
+	for _, txt := range []string{"1", "2", "3", "4", "5"} {
+		d.submit(InboundMessage{Transport: "mock", Sender: "alice", Text: txt})
+	}
+	d.wait()
+	if len(got) != 5 {
+		t.Fatalf("expected 5 handled, got %d", len(got))
+	}
+	for i, txt := range got {
+		if txt != string(rune('1'+i)) {
+			t.Fatalf("out of order: %v", got)
+		}
+	}
+}
+
+func TestDispatcherRunsConversationsInParallel(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan string, 2)
+	d := newDispatcher(2, new(Runner).runKey, func(msg InboundMessage) {
+		started <- msg.Sender
+		<-release
+	})
+	d.submit(InboundMessage{Transport: "mock", Sender: "alice"})
+	d.submit(InboundMessage{Transport: "mock", Sender: "bob"})
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatalf("a slow conversation blocked another sender")
+		}
+	}
+	close(release)
+	d.wait()
+}
+
+func TestDispatcherRespectsConcurrencyCap(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan string, 2)
+	d := newDispatcher(1, new(Runner).runKey, func(msg InboundMessage) {
+		started <- msg.Sender
+		<-release
+	})
+	d.submit(InboundMessage{Transport: "mock", Sender: "alice"})
+	d.submit(InboundMessage{Transport: "mock", Sender: "bob"})
+
+	<-started
+	select {
+	case s := <-started:
+		t.Fatalf("cap exceeded: %s started while another run was active", s)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	d.wait()
+}
+
+func TestDispatcherRunsThreadsInParallel(t *testing.T) {
+	r := NewRunner(nil, &mockAgent{}, nil, nil, WithSessionScope(ScopeSenderThread, nil))
+	release := make(chan struct{})
+	started := make(chan string, 2)
+	d := newDispatcher(2, r.runKey, func(msg InboundMessage) {
+		started <- msg.ThreadID
+		<-release
+	})
+	d.submit(InboundMessage{Transport: "mock", Sender: "alice", ThreadID: "t1"})
+	d.submit(InboundMessage{Transport: "mock", Sender: "alice", ThreadID: "t2"})
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatalf("one thread blocked another thread of the same sender")
+		}
+	}
+	close(release)
+	d.wait()
+}
@@ -0,0 +1,64 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/joelklabo/buddy/internal/metrics"
+)
+
+// WithFallbacks sets, per agent name, the agents tried in order when that agent
+// fails with a permanent error, exhausts its retries or has an open circuit.
+func WithFallbacks(chains map[string][]string) RunnerOption {
+	return func(r *Runner) { r.fallbacks = chains }
+}
+
+// fallback tries the fallback chain of the agent carried by ctx after it failed
+// with cause. On success it returns the context and request for the agent that
+// answered, so later steps and the stored session stay with it. Each agent
+// keeps its own session; a fallback never resumes the primary's.
+func (r *Runner) fallback(ctx context.Context, msg InboundMessage, req AgentRequest, cause error, log *slog.Logger) (AgentResponse, context.Context, AgentRequest, error) {
+	from := agentChoiceFrom(ctx).name
+	if from == "" {
+		from = r.defaultAgent
+	}
+	err := cause
+	for _, name := range r.fallbacks[from] {
+		agent, ok := r.namedAgents[name]
+		if !ok || name == from {
+			continue
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		log.Warn("agent failed; falling back", slog.String("from", from), slog.String("to", name), slog.String("err", err.Error()))
+		metrics.IncAgentFallback(from, name)
+		fctx := context.WithValue(ctx, agentChoiceKey{}, agentChoice{name: name, agent: agent, reason: "fallback"})
+		freq := req
+		freq.SessionID = r.activeSession(r.sessionKey(msg, name))
+		start := time.Now()
+		var resp AgentResponse
+		resp, err = r.callAgentWithRetry(fctx, freq, log.With(slog.String("agent", name)))
+		outcome := "ok"
+		if err != nil {
+			outcome = "error"
+		}
+		r.logAudit(fmt.Sprintf("fallback:%s->%s", from, name), r.principal(msg), outcome, time.Since(start))
+		if err == nil {
+			return resp, fctx, freq, nil
+		}
+	}
+	return AgentResponse{}, ctx, req, err
+}
+
+// fallbackNote is appended to replies from a fallback agent.
+func fallbackNote(from, to string) string {
+	return fmt.Sprintf("\n\n— answered by %s (%s failed)", to, from)
+}
+
+// agentFailedMessage tells the sender that no agent produced a reply.
+func agentFailedMessage(err error) string {
+	return fmt.Sprintf("Sorry, the agent failed to answer (%s). Try again later.", snippet(err.Error(), 200))
+}
@@ -0,0 +1,70 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestFallbackChainAnswersAndAnnotates(t *testing.T) {
+	codex := &downAgent{}
+	copilot := &downAgent{}
+	http := &mockAgent{reply: "from http"}
+	audit := &auditRecorder{}
+	st := &memoryStore{}
+	r := NewRunner(nil, codex, nil, slog.Default(),
+		WithRetryPolicy(RetryPolicy{Attempts: 1}),
+		WithStore(st),
+		WithAuditLogger(audit),
+		WithAgents("codex", map[string]Agent{"codex": codex, "copilot": copilot, "http": http}, nil),
+		WithFallbacks(map[string][]string{"codex": {"copilot", "http"}}))
+	outCh := make(chan OutboundMessage, 4)
+	r.transportMap = map[string]Transport{"mock": &transportSpy{out: outCh}}
+
+	r.handleMessage(context.Background(), InboundMessage{Transport: "mock", Sender: "alice", Text: "hi", ThreadID: "t"})
+	got := drain(outCh)
+	if len(got) != 1 || got[0] != "from http\n\n— answered by http (codex failed)" {
+		t.Fatalf("unexpected reply %q", got)
+	}
+	if codex.calls != 1 || copilot.calls != 1 || len(http.calls) != 1 {
+		t.Fatalf("expected each agent tried once, got %d/%d/%d", codex.calls, copilot.calls, len(http.calls))
+	}
+	if trail := strings.Join(audit.snapshot(), ","); trail != "fallback:codex->copilot:error,fallback:codex->http:ok" {
+		t.Fatalf("unexpected audit trail %s", trail)
+	}
+}
+
+func TestFallbackExhaustedTellsSender(t *testing.T) {
+	codex := &downAgent{}
+	copilot := &errAgent{err: Permanent(errors.New("binary missing"))}
+	r := NewRunner(nil, codex, nil, slog.Default(),
+		WithRetryPolicy(RetryPolicy{Attempts: 1}),
+		WithAgents("codex", map[string]Agent{"codex": codex, "copilot": copilot}, nil),
+		WithFallbacks(map[string][]string{"codex": {"copilot"}}))
+	outCh := make(chan OutboundMessage, 4)
+	r.transportMap = map[string]Transport{"mock": &transportSpy{out: outCh}}
+
+	r.handleMessage(context.Background(), InboundMessage{Transport: "mock", Sender: "alice", Text: "hi"})
+	if got := drain(outCh); len(got) != 1 || !strings.Contains(got[0], "failed to answer (binary missing)") {
+		t.Fatalf("unexpected reply %q", got)
+	}
+}
+
+type errAgent struct{ err error }
+
+func (e *errAgent) Generate(ctx context.Context, req AgentRequest) (AgentResponse, error) {
+	return AgentResponse{}, e.err
+}
+
+func TestAgentFailedMessageKeepsRunesWhole(t *testing.T) {
+	msg := agentFailedMessage(errors.New(strings.Repeat("é", 300)))
+	if !utf8.ValidString(msg) {
+		t.Fatalf("message is not valid UTF-8: %q", msg)
+	}
+	if !strings.Contains(msg, "("+strings.Repeat("é", 200)+"…)") {
+		t.Fatalf("expected 200 runes and an ellipsis, got %q", msg)
+	}
+}
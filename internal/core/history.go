@@ -0,0 +1,101 @@
+package core
+
+import (
+	"encoding/json"
+	"log/slog"
+
+	"github.com/joelklabo/buddy/internal/store"
+)
+
+// HistoryStore persists conversation turns per thread. store.Store satisfies it;
+// WithStore picks it up automatically when the provided store implements it.
+type HistoryStore interface {
+	AppendHistory(thread store.Key, turn json.RawMessage, maxEntries int) error
+	History(thread store.Key, maxEntries int) ([]json.RawMessage, error)
+	ClearHistory(thread store.Key) error
+}
+
+// WithHistoryLimits sets how many turns are kept per thread and the character/token
+// budgets applied when replaying them to the agent. Zero budgets disable that check.
+func WithHistoryLimits(turns, maxChars, maxTokens int) RunnerOption {
+	return func(r *Runner) {
+		r.historyTurns = turns
+		r.historyMaxChars = maxChars
+		r.historyMaxTokens = maxTokens
+	}
+}
+
+// historyKey scopes stored turns to the conversation a message belongs to:
+// the session's key, so history is shared exactly as the session is and /new
+// clears only the history it starts afresh.
+func (r *Runner) historyKey(msg InboundMessage) store.Key {
+	return r.sessionBase(msg)
+}
+
+// loadHistory returns prior turns for the message's thread, trimmed to the budgets.
+func (r *Runner) loadHistory(msg InboundMessage, log *slog.Logger) []MessageTurn {
+	if r.history == nil || r.historyTurns <= 0 {
+		return nil
+	}
+	raw, err := r.history.History(r.historyKey(msg), r.historyTurns)
+	if err != nil {
+		log.Warn("load history failed", slog.String("err", err.Error()))
+		return nil
+	}
+	turns := make([]MessageTurn, 0, len(raw))
+	for _, entry := range raw {
+		var t MessageTurn
+		if err := json.Unmarshal(entry, &t); err != nil || t.Text == "" {
+			continue
+		}
+		turns = append(turns, t)
+	}
+	return trimHistory(turns, r.historyMaxChars, r.historyMaxTokens)
+}
+
+// recordTurns appends the exchanged turns to the thread history.
+func (r *Runner) recordTurns(msg InboundMessage, log *slog.Logger, turns ...MessageTurn) {
+	if r.history == nil || r.historyTurns <= 0 {
+		return
+	}
+	key := r.historyKey(msg)
+	for _, t := range turns {
+		if t.Text == "" {
+			continue
+		}
+		data, err := json.Marshal(t)
+		if err != nil {
+			continue
+		}
+		if err := r.history.AppendHistory(key, data, r.historyTurns); err != nil {
+			log.Warn("append history failed", slog.String("err", err.Error()))
+			return
+		}
+	}
+}
+
+// trimHistory keeps the most recent turns that fit inside the character and token
+// budgets. A zero budget is treated as unlimited.
+func trimHistory(turns []MessageTurn, maxChars, maxTokens int) []MessageTurn {
+	chars, tokens := 0, 0
+	start := len(turns)
+	for i := len(turns) - 1; i >= 0; i-- {
+		c := len(turns[i].Text)
+		tk := estimateTokens(turns[i].Text)
+		if maxChars > 0 && chars+c > maxChars {
+			break
+		}
+		if maxTokens > 0 && tokens+tk > maxTokens {
+			break
+		}
+		chars += c
+		tokens += tk
+		start = i
+	}
+	return turns[start:]
+}
+
+// estimateTokens approximates token usage (~4 characters per token for English text).
+func estimateTokens(s string) int {
+	return (len(s) + 3) / 4
+}
@@ -0,0 +1,117 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/joelklabo/buddy/internal/store"
+)
+
+// historyStore is an in-memory HistoryStore layered on memoryStore.
+type historyStore struct {
+	memoryStore
+	turns map[store.Key][]json.RawMessage
+}
+
+func (h *historyStore) AppendHistory(threadID store.Key, turn json.RawMessage, maxEntries int) error {
+	if h.turns == nil {
+		h.turns = map[store.Key][]json.RawMessage{}
+	}
+	entries := append(h.turns[threadID], turn)
+	if len(entries) > maxEntries {
+		entries = entries[len(entries)-maxEntries:]
+	}
+	h.turns[threadID] = entries
+	return nil
+}
+
+func (h *historyStore) History(threadID store.Key, maxEntries int) ([]json.RawMessage, error) {
+	entries := h.turns[threadID]
+	if len(entries) > maxEntries {
+		entries = entries[len(entries)-maxEntries:]
+	}
+	return entries, nil
+}
+
+func (h *historyStore) ClearHistory(threadID store.Key) error {
+	delete(h.turns, threadID)
+	return nil
+}
+
+func TestTrimHistoryBudgets(t *testing.T) {
+	turns := []MessageTurn{
+		{Role: "user", Text: strings.Repeat("a", 40)},
+		{Role: "agent", Text: strings.Repeat("b", 40)},
+		{Role: "user", Text: strings.Repeat("c", 40)},
+	}
+	if got := trimHistory(turns, 0, 0); len(got) != 3 {
+		t.Fatalf("expected all turns without budgets, got %d", len(got))
+	}
+	got := trimHistory(turns, 90, 0)
+	if len(got) != 2 || got[0].Text[0] != 'b' {
+		t.Fatalf("char budget should keep newest two turns, got %+v", got)
+	}
+	if got := trimHistory(turns, 0, 10); len(got) != 1 {
+		t.Fatalf("token budget should keep newest turn, got %d", len(got))
+	}
+}
+
+func TestRunnerReplaysThreadHistory(t *testing.T) {
+	st := &historyStore{}
+	ag := &mockAgent{reply: "pong"}
+	r := NewRunner(nil, ag, nil, slog.Default(), WithStore(st), WithHistoryLimits(10, 0, 0), WithSessionScope(ScopeThread, nil))
+	outCh := make(chan OutboundMessage, 4)
+	r.transportMap = map[string]Transport{"mock": &transportSpy{out: outCh}}
+
+	r.handleMessage(context.Background(), InboundMessage{Transport: "mock", Sender: "alice", Text: "ping", ThreadID: "t1"})
+	r.handleMessage(context.Background(), InboundMessage{Transport: "mock", Sender: "alice", Text: "again", ThreadID: "t1"})
+	r.handleMessage(context.Background(), InboundMessage{Transport: "mock", Sender: "alice", Text: "other", ThreadID: "t2"})
+
+	if len(ag.calls) != 3 {
+		t.Fatalf("expected 3 agent calls, got %d", len(ag.calls))
+	}
+	if len(ag.calls[0].History) != 0 {
+		t.Fatalf("first call should have no history, got %+v", ag.calls[0].History)
+	}
+	hist := ag.calls[1].History
+	if len(hist) != 2 || hist[0].Role != "user" || hist[0].Text != "ping" || hist[1].Role != "agent" || hist[1].Text != "pong" {
+		t.Fatalf("unexpected replayed history %+v", hist)
+	}
+	if len(ag.calls[2].History) != 0 {
+		t.Fatalf("history leaked across threads: %+v", ag.calls[2].History)
+	}
+
+	captureSend(r, InboundMessage{Transport: "mock", Sender: "alice", Text: "/new", ThreadID: "t1"})
+	if len(st.turns[store.Key{Transport: "mock", Thread: "t1"}]) != 0 {
+		t.Fatalf("expected /new to clear thread history")
+	}
+}
+
+func TestHistoryFollowsSessionScope(t *testing.T) {
+	st := &historyStore{}
+	ag := &mockAgent{reply: "pong"}
+	r := NewRunner(nil, ag, nil, slog.Default(), WithStore(st), WithHistoryLimits(10, 0, 0), WithSessionScope(ScopeSenderThread, nil))
+	outCh := make(chan OutboundMessage, 32)
+	r.transportMap = map[string]Transport{"mock": &transportSpy{out: outCh}}
+
+	r.handleMessage(context.Background(), InboundMessage{Transport: "mock", Sender: "alice", Text: "ping", ThreadID: "t1"})
+	r.handleMessage(context.Background(), InboundMessage{Transport: "mock", Sender: "bob", Text: "hello", ThreadID: "t1"})
+	if len(ag.calls[1].History) != 0 {
+		t.Fatalf("bob sees alice's turns in a sender+thread session: %+v", ag.calls[1].History)
+	}
+	r.handleMessage(context.Background(), InboundMessage{Transport: "mock", Sender: "bob", Text: "/new", ThreadID: "t1"})
+	r.handleMessage(context.Background(), InboundMessage{Transport: "mock", Sender: "alice", Text: "again", ThreadID: "t1"})
+	if len(ag.calls[2].History) != 2 {
+		t.Fatalf("bob's /new cleared alice's history: %+v", ag.calls[2].History)
+	}
+
+	// Unthreaded messages (WhatsApp, Nostr) keep per-sender history.
+	r.handleMessage(context.Background(), InboundMessage{Transport: "mock", Sender: "carol", Text: "one"})
+	r.handleMessage(context.Background(), InboundMessage{Transport: "mock", Sender: "carol", Text: "two"})
+	if len(ag.calls[4].History) != 2 {
+		t.Fatalf("unthreaded history not replayed: %+v", ag.calls[4].History)
+	}
+}
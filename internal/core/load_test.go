@@ -54,6 +54,16 @@ func TestRunnerHandlesBurst(t *testing.T) {
 		}
 	}
 
+	// Keep reading so replies still in flight do not hold up shutdown.
+	go func() {
+		for {
+			select {
+			case <-transport.Outbound:
+			case <-done:
+				return
+			}
+		}
+	}()
 	close(transport.Inbound)
 	time.Sleep(20 * time.Millisecond) // allow transport goroutine to exit before cancel closes inbound
 	cancel()
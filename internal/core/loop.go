@@ -0,0 +1,164 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/joelklabo/buddy/internal/metrics"
+)
+
+// WithMaxSteps bounds how many agent turns a single message may take when the
+// agent keeps requesting actions. Values below 1 mean a single turn.
+func WithMaxSteps(n int) RunnerOption {
+	return func(r *Runner) { r.maxSteps = n }
+}
+
+// runAgentLoop calls the agent, runs any requested actions and feeds their results
+// back as tool turns until the agent answers without action calls, the step limit
+// is reached, or ctx expires. It returns the text to send to the user and the
+// files the agent attached along the way.
+func (r *Runner) runAgentLoop(ctx context.Context, msg InboundMessage, req AgentRequest, log *slog.Logger) (string, []Attachment, error) {
+	maxSteps := r.maxSteps
+	if maxSteps < 1 {
+		maxSteps = 1
+	}
+	var (
+		last  AgentResponse
+		tools []MessageTurn
+		atts  []Attachment
+		note  string // set once a fallback agent has answered
+	)
+	for step := 1; ; step++ {
+		start := time.Now()
+		r.setRunStage(msg, "agent run")
+		resp, err := r.callAgentWithRetry(ctx, req, log)
+		if err != nil && ctx.Err() == nil && len(r.fallbacks) > 0 {
+			from := agentChoiceFrom(ctx).name
+			if from == "" {
+				from = r.defaultAgent
+			}
+			var fctx context.Context
+			resp, fctx, req, err = r.fallback(ctx, msg, req, err, log)
+			if err == nil {
+				ctx = fctx
+				note = fallbackNote(from, agentChoiceFrom(ctx).name)
+			}
+		}
+		if err != nil {
+			if step > 1 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				log.Warn("agent loop deadline reached", slog.Int("step", step))
+				return partialReply(last.Reply, tools, "stopped: deadline reached") + note, atts, nil
+			}
+			return "", nil, err
+		}
+		atts = append(atts, r.agentAttachments(ctx, resp.Attachments, log)...)
+		log.Info("agent reply", slog.Int("step", step), slog.Duration("ms", time.Since(start)))
+		r.saveSession(r.sessionKeyFor(ctx, msg), req.SessionID, resp.SessionID, log)
+		if resp.SessionID != "" {
+			req.SessionID = resp.SessionID
+		}
+
+		if len(resp.ActionCalls) == 0 {
+			return resp.Reply + note, atts, nil
+		}
+
+		last = resp
+		tools = r.runActions(ctx, msg, resp.ActionCalls, log)
+		if step >= maxSteps {
+			if maxSteps > 1 {
+				log.Warn("agent loop step limit reached", slog.Int("steps", maxSteps))
+				return partialReply(resp.Reply, tools, fmt.Sprintf("stopped after %d steps", maxSteps)) + note, atts, nil
+			}
+			return partialReply(resp.Reply, tools, "") + note, atts, nil
+		}
+
+		req.Steps = append(req.Steps, MessageTurn{Role: "agent", Text: resp.Reply})
+		req.Steps = append(req.Steps, tools...)
+	}
+}
+
+// runActions executes the calls in order and returns one tool turn per call. Denied,
+// unknown and failing calls produce an error turn so the agent can adapt.
+func (r *Runner) runActions(ctx context.Context, msg InboundMessage, calls []ActionCall, log *slog.Logger) []MessageTurn {
+	turns := make([]MessageTurn, 0, len(calls))
+	for _, call := range calls {
+		out, err := r.invokeAction(ctx, msg, call, log)
+		text := string(out)
+		if err != nil {
+			text = "error: " + err.Error()
+		}
+		turns = append(turns, MessageTurn{Role: "tool", Name: call.Name, Text: text})
+	}
+	return turns
+}
+
+func (r *Runner) invokeAction(ctx context.Context, msg InboundMessage, call ActionCall, log *slog.Logger) ([]byte, error) {
+	if len(r.allowedActions) > 0 {
+		if _, ok := r.allowedActions[call.Name]; !ok {
+			log.Warn("action not allowed", slog.String("action", call.Name))
+			r.logAudit(call.Name, r.principal(msg), "denied", 0)
+			return nil, errors.New("action not allowed")
+		}
+	}
+	if err := r.authorizeAction(msg, call, log); err != nil {
+		return nil, err
+	}
+	act, ok := r.actions[call.Name]
+	if !ok {
+		log.Warn("unknown action", slog.String("action", call.Name))
+		return nil, errors.New("unknown action")
+	}
+	if r.approvalPolicy.requires(call) {
+		return r.holdForApproval(ctx, msg, call, log)
+	}
+	return r.execAction(ctx, msg, act, call, log)
+}
+
+// execAction runs an already-authorized call with the action timeout, recording
+// audit entries and metrics.
+func (r *Runner) execAction(ctx context.Context, msg InboundMessage, act Action, call ActionCall, log *slog.Logger) ([]byte, error) {
+	if r.actionTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.actionTimeout)
+		defer cancel()
+	}
+	r.setRunStage(msg, call.Name+" action")
+	start := time.Now()
+	out, err := act.Invoke(ctx, call.Args)
+	if err != nil {
+		if runCancelled(ctx) {
+			r.logAudit(call.Name, r.principal(msg), "cancelled", time.Since(start))
+			metrics.IncAction(call.Name, "cancelled")
+			return nil, err
+		}
+		log.Error("action error", slog.String("action", call.Name), slog.String("err", err.Error()))
+		r.logAudit(call.Name, r.principal(msg), "error", time.Since(start))
+		metrics.IncAction(call.Name, "error")
+		return nil, err
+	}
+	log.Info("action ok", slog.String("action", call.Name), slog.Duration("ms", time.Since(start)))
+	r.logAudit(call.Name, r.principal(msg), "ok", time.Since(start))
+	metrics.IncAction(call.Name, "ok")
+	return out, nil
+}
+
+// partialReply is used when the loop ends before the agent composed a final answer:
+// the last reply is followed by the raw results of the last round of actions.
+func partialReply(reply string, tools []MessageTurn, note string) string {
+	parts := make([]string, 0, len(tools)+2)
+	if reply != "" {
+		parts = append(parts, reply)
+	}
+	for _, t := range tools {
+		if t.Text != "" {
+			parts = append(parts, fmt.Sprintf("[%s]\n%s", t.Name, t.Text))
+		}
+	}
+	if note != "" {
+		parts = append(parts, "("+note+")")
+	}
+	return joinStrings(parts, "\n\n")
+}
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// toolAgent requests the echo action until it sees a tool result, then answers.
+type toolAgent struct {
+	calls []AgentRequest
+}
+
+func (a *toolAgent) Generate(ctx context.Context, req AgentRequest) (AgentResponse, error) {
+	a.calls = append(a.calls, req)
+	for _, st := range req.Steps {
+		if st.Role == "tool" {
+			return AgentResponse{Reply: "final: " + st.Text}, nil
+		}
+	}
+	return AgentResponse{Reply: "checking", ActionCalls: []ActionCall{{Name: "echo"}}}, nil
+}
+
+func runLoopMessage(t *testing.T, r *Runner) string {
+	t.Helper()
+	outCh := make(chan OutboundMessage, 1)
+	r.transportMap = map[string]Transport{"mock": &transportSpy{out: outCh}}
+	r.handleMessage(context.Background(), InboundMessage{Transport: "mock", Sender: "alice", Text: "go", ThreadID: "t"})
+	select {
+	case out := <-outCh:
+		return out.Text
+	default:
+		t.Fatalf("expected outbound message")
+		return ""
+	}
+}
+
+func TestAgentLoopFeedsToolResultsBack(t *testing.T) {
+	ag := &toolAgent{}
+	r := NewRunner(nil, ag, []Action{&mockAction{name: "echo", result: `"pong"`}}, slog.Default())
+
+	out := runLoopMessage(t, r)
+	if out != `final: "pong"` {
+		t.Fatalf("expected agent-composed reply, got %q", out)
+	}
+	if len(ag.calls) != 2 {
+		t.Fatalf("expected 2 agent turns, got %d", len(ag.calls))
+	}
+	steps := ag.calls[1].Steps
+	if len(steps) != 2 || steps[0].Role != "agent" || steps[1].Role != "tool" || steps[1].Name != "echo" {
+		t.Fatalf("unexpected steps %+v", steps)
+	}
+}
+
+func TestAgentLoopStopsAtMaxSteps(t *testing.T) {
+	ag := &mockAgent{reply: "again", actionCalls: []ActionCall{{Name: "echo"}}}
+	r := NewRunner(nil, ag, []Action{&mockAction{name: "echo", result: `"pong"`}}, slog.Default(), WithMaxSteps(3))
+
+	out := runLoopMessage(t, r)
+	if len(ag.calls) != 3 {
+		t.Fatalf("expected 3 agent turns, got %d", len(ag.calls))
+	}
+	if !strings.Contains(out, "pong") || !strings.Contains(out, "stopped after 3 steps") {
+		t.Fatalf("expected partial reply with note, got %q", out)
+	}
+}
+
+func TestAgentLoopReportsDeniedAction(t *testing.T) {
+	ag := &toolAgent{}
+	r := NewRunner(nil, ag, []Action{&mockAction{name: "echo", result: `"pong"`}}, slog.Default(), WithAllowedActions([]string{"other"}))
+
+	out := runLoopMessage(t, r)
+	if out != "final: error: action not allowed" {
+		t.Fatalf("expected denial fed back to agent, got %q", out)
+	}
+}
@@ -0,0 +1,180 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/joelklabo/buddy/internal/metrics"
+	"github.com/joelklabo/buddy/internal/store"
+)
+
+// Outbox persists outbound messages that failed to send so they can be retried
+// across restarts. store.Store satisfies it; WithStore picks it up automatically.
+type Outbox interface {
+	EnqueueOutbox(e store.OutboxEntry) (string, error)
+	PendingOutbox() ([]store.OutboxEntry, error)
+	UpdateOutbox(e store.OutboxEntry) error
+	DeleteOutbox(id string) error
+	DeadLetter(e store.OutboxEntry) error
+}
+
+// OutboxPolicy controls outbox retries: the delay doubles from BaseDelay up to
+// MaxDelay, and after MaxAttempts failed outbox sends (not counting the inline
+// retries) the message is dead-lettered.
+type OutboxPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// WithOutboxPolicy overrides the outbox retry schedule.
+func WithOutboxPolicy(p OutboxPolicy) RunnerOption {
+	return func(r *Runner) { r.outboxPolicy = p }
+}
+
+func (p OutboxPolicy) delay(attempts int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempts && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d
+}
+
+// queueOutbound stores a message whose inline retries failed. It reports whether
+// the message was queued.
+func (r *Runner) queueOutbound(msg OutboundMessage, sendErr error, log *slog.Logger) bool {
+	if r.outbox == nil {
+		return false
+	}
+	id, err := r.enqueueOutbox(msg, sendErr.Error(), time.Now().UTC().Add(r.outboxPolicy.delay(1)))
+	if err != nil {
+		log.Error("outbox enqueue failed", slog.String("err", err.Error()))
+		return false
+	}
+	log.Warn("send failed; queued in outbox", slog.String("outbox_id", id), slog.String("err", sendErr.Error()))
+	return true
+}
+
+// queueNotice stores msg in the outbox, due at once, for runOutbox to deliver.
+// It is used for notices produced before the transports are running. It
+// reports whether the message was queued.
+func (r *Runner) queueNotice(msg OutboundMessage, log *slog.Logger) bool {
+	if r.outbox == nil {
+		return false
+	}
+	if _, err := r.enqueueOutbox(msg, "", time.Now().UTC()); err != nil {
+		log.Error("outbox enqueue failed", slog.String("err", err.Error()))
+		return false
+	}
+	return true
+}
+
+func (r *Runner) enqueueOutbox(msg OutboundMessage, lastErr string, next time.Time) (string, error) {
+	return r.outbox.EnqueueOutbox(store.OutboxEntry{
+		Transport:   msg.Transport,
+		Recipient:   msg.Recipient,
+		Text:        msg.Text,
+		ThreadID:    msg.ThreadID,
+		Meta:        msg.Meta,
+		Attachments: toStoreAttachments(msg.Attachments),
+		LastError:   lastErr,
+		NextAttempt: next,
+	})
+}
+
+// runOutbox retries due outbox entries until ctx is done.
+func (r *Runner) runOutbox(ctx context.Context) {
+	if r.outbox == nil {
+		return
+	}
+	interval := r.outboxPolicy.BaseDelay
+	if interval <= 0 || interval > 5*time.Second {
+		interval = 5 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		r.flushOutbox(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// flushOutbox makes one delivery attempt for every due entry.
+func (r *Runner) flushOutbox(ctx context.Context) {
+	r.flushOutboxDue(ctx, time.Now().UTC())
+}
+
+// outboxBatch caps the delivery attempts made per outbox pass.
+const outboxBatch = 50
+
+// flushOutboxDue makes one delivery attempt for every entry due by now. Entries
+// for a recipient go out in the order they were queued: an entry waits while an
+// older one for the same recipient is still in the outbox. A dead-lettered entry
+// no longer holds the recipient, so the next one makes its own attempt.
+func (r *Runner) flushOutboxDue(ctx context.Context, now time.Time) {
+	pending, err := r.outbox.PendingOutbox()
+	if err != nil {
+		r.logger.Warn("load outbox failed", slog.String("err", err.Error()))
+		return
+	}
+	held := map[string]bool{} // recipients with an older entry still waiting
+	attempts := 0
+	for _, e := range pending {
+		if ctx.Err() != nil {
+			return
+		}
+		key := e.Transport + ":" + e.Recipient
+		log := r.logger.With(slog.String("transport", e.Transport), slog.String("recipient", e.Recipient), slog.String("outbox_id", e.ID))
+		if held[key] {
+			continue
+		}
+		if e.NextAttempt.After(now) || attempts >= outboxBatch {
+			held[key] = true
+			continue
+		}
+		attempts++
+		tr, ok := r.transportMap[e.Transport]
+		var sendErr error
+		if ok {
+			sendErr = tr.Send(ctx, OutboundMessage{Transport: e.Transport, Recipient: e.Recipient, Text: e.Text, ThreadID: e.ThreadID, Meta: e.Meta, Attachments: fromStoreAttachments(e.Attachments)})
+		} else {
+			sendErr = fmt.Errorf("transport %s not configured", e.Transport)
+		}
+		if sendErr == nil {
+			log.Info("outbox message delivered", slog.Int("attempts", e.Attempts+1))
+			if err := r.outbox.DeleteOutbox(e.ID); err != nil {
+				log.Warn("outbox delete failed", slog.String("err", err.Error()))
+			}
+			continue
+		}
+		metrics.IncSendError()
+		e.Attempts++
+		e.LastError = sendErr.Error()
+		if IsPermanent(sendErr) || (r.outboxPolicy.MaxAttempts > 0 && e.Attempts >= r.outboxPolicy.MaxAttempts) {
+			r.deadLetter(e, log)
+			continue
+		}
+		held[key] = true
+		e.NextAttempt = time.Now().UTC().Add(r.outboxPolicy.delay(e.Attempts))
+		if err := r.outbox.UpdateOutbox(e); err != nil {
+			log.Warn("outbox update failed", slog.String("err", err.Error()))
+		}
+	}
+}
+
+func (r *Runner) deadLetter(e store.OutboxEntry, log *slog.Logger) {
+	log.Error("outbox message dead-lettered", slog.Int("attempts", e.Attempts), slog.String("err", e.LastError))
+	metrics.IncDeadLetter(e.Transport)
+	if err := r.outbox.DeadLetter(e); err != nil {
+		log.Error("dead-letter failed", slog.String("err", err.Error()))
+	}
+}
@@ -0,0 +1,176 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joelklabo/buddy/internal/store"
+)
+
+// outboxStore is an in-memory Outbox layered on memoryStore.
+type outboxStore struct {
+	memoryStore
+	mu      sync.Mutex
+	seq     int
+	entries []store.OutboxEntry
+	dead    []store.OutboxEntry
+}
+
+func (o *outboxStore) EnqueueOutbox(e store.OutboxEntry) (string, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.seq++
+	e.ID = string(rune('a' + o.seq))
+	o.entries = append(o.entries, e)
+	return e.ID, nil
+}
+
+func (o *outboxStore) PendingOutbox() ([]store.OutboxEntry, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]store.OutboxEntry(nil), o.entries...), nil
+}
+
+func (o *outboxStore) UpdateOutbox(e store.OutboxEntry) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i := range o.entries {
+		if o.entries[i].ID == e.ID {
+			o.entries[i] = e
+		}
+	}
+	return nil
+}
+
+func (o *outboxStore) DeleteOutbox(id string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i := range o.entries {
+		if o.entries[i].ID == id {
+			o.entries = append(o.entries[:i], o.entries[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (o *outboxStore) DeadLetter(e store.OutboxEntry) error {
+	_ = o.DeleteOutbox(e.ID)
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.dead = append(o.dead, e)
+	return nil
+}
+
+// downTransport fails every send until up is set.
+type downTransport struct {
+	mu   sync.Mutex
+	up   bool
+	bad  string // text refused with a permanent error even when up
+	sent []string
+}
+
+func (d *downTransport) ID() string { return "mock" }
+func (d *downTransport) Start(ctx context.Context, inbound chan<- InboundMessage) error {
+	return nil
+}
+func (d *downTransport) Send(ctx context.Context, msg OutboundMessage) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.up {
+		return errors.New("relay unreachable")
+	}
+	if d.bad != "" && msg.Text == d.bad {
+		return Permanent(errors.New("rejected"))
+	}
+	d.sent = append(d.sent, msg.Text)
+	return nil
+}
+
+func TestFailedReplyQueuedAndRetried(t *testing.T) {
+	st := &outboxStore{}
+	tr := &downTransport{}
+	r := NewRunner([]Transport{tr}, &mockAgent{reply: "answer"}, nil, slog.Default(), WithStore(st),
+		WithOutboxPolicy(OutboxPolicy{MaxAttempts: 3}))
+
+	r.handleMessage(context.Background(), InboundMessage{Transport: "mock", Sender: "alice", Text: "hi"})
+	if len(st.entries) != 1 || st.entries[0].Text != "answer" || st.entries[0].LastError == "" {
+		t.Fatalf("failed reply not queued: %+v", st.entries)
+	}
+
+	r.flushOutbox(context.Background())
+	if len(st.entries) != 1 || st.entries[0].Attempts != 1 {
+		t.Fatalf("expected one recorded outbox attempt, got %+v", st.entries)
+	}
+
+	tr.up = true
+	r.flushOutbox(context.Background())
+	if len(st.entries) != 0 || len(tr.sent) != 1 || tr.sent[0] != "answer" {
+		t.Fatalf("queued reply not delivered: entries=%+v sent=%v", st.entries, tr.sent)
+	}
+}
+
+func TestOutboxDeadLettersAfterMaxAttempts(t *testing.T) {
+	st := &outboxStore{}
+	tr := &downTransport{}
+	r := NewRunner([]Transport{tr}, &mockAgent{}, nil, slog.Default(), WithStore(st),
+		WithOutboxPolicy(OutboxPolicy{MaxAttempts: 2}))
+	_, _ = st.EnqueueOutbox(store.OutboxEntry{Transport: "mock", Recipient: "alice", Text: "lost"})
+
+	r.flushOutbox(context.Background())
+	r.flushOutbox(context.Background())
+	if len(st.entries) != 0 || len(st.dead) != 1 || st.dead[0].Attempts != 2 {
+		t.Fatalf("expected dead letter after 2 attempts: entries=%+v dead=%+v", st.entries, st.dead)
+	}
+}
+
+func TestOutboxPolicyDelay(t *testing.T) {
+	p := OutboxPolicy{BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+	for attempts, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 10: 5 * time.Second} {
+		if got := p.delay(attempts); got != want {
+			t.Fatalf("delay(%d) = %s, want %s", attempts, got, want)
+		}
+	}
+}
+
+func TestOutboxKeepsOrderAcrossPasses(t *testing.T) {
+	st := &outboxStore{}
+	tr := &downTransport{}
+	r := NewRunner([]Transport{tr}, &mockAgent{}, nil, slog.Default(), WithStore(st),
+		WithOutboxPolicy(OutboxPolicy{MaxAttempts: 5, BaseDelay: time.Minute, MaxDelay: time.Hour}))
+	now := time.Now().UTC()
+	_, _ = st.EnqueueOutbox(store.OutboxEntry{Transport: "mock", Recipient: "alice", Text: "(1/2)", NextAttempt: now})
+	_, _ = st.EnqueueOutbox(store.OutboxEntry{Transport: "mock", Recipient: "alice", Text: "(2/2)", NextAttempt: now})
+
+	r.flushOutboxDue(context.Background(), now)
+	tr.up = true
+	// Part 1 is now scheduled a minute out; part 2 is still due but must wait.
+	r.flushOutboxDue(context.Background(), now.Add(time.Second))
+	if len(tr.sent) != 0 {
+		t.Fatalf("part 2 overtook part 1: %v", tr.sent)
+	}
+	r.flushOutboxDue(context.Background(), now.Add(2*time.Minute))
+	if len(tr.sent) != 2 || tr.sent[0] != "(1/2)" || tr.sent[1] != "(2/2)" {
+		t.Fatalf("parts out of order: %v", tr.sent)
+	}
+}
+
+func TestOutboxDeadLetterReleasesLaterEntries(t *testing.T) {
+	st := &outboxStore{}
+	tr := &downTransport{up: true, bad: "(1/2)"}
+	r := NewRunner([]Transport{tr}, &mockAgent{}, nil, slog.Default(), WithStore(st))
+	_, _ = st.EnqueueOutbox(store.OutboxEntry{Transport: "mock", Recipient: "alice", Text: "(1/2)"})
+	_, _ = st.EnqueueOutbox(store.OutboxEntry{Transport: "mock", Recipient: "alice", Text: "(2/2)"})
+
+	r.flushOutbox(context.Background())
+	if len(st.dead) != 1 || st.dead[0].Text != "(1/2)" {
+		t.Fatalf("only the failing part should be dead-lettered: %+v", st.dead)
+	}
+	if len(tr.sent) != 1 || tr.sent[0] != "(2/2)" || len(st.entries) != 0 {
+		t.Fatalf("later part should make its own attempt: sent=%v entries=%+v", tr.sent, st.entries)
+	}
+}
@@ -0,0 +1,251 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/joelklabo/buddy/internal/metrics"
+	"github.com/joelklabo/buddy/internal/store"
+)
+
+// PagerStore keeps reply parts that did not fit in one send so /more can deliver
+// them later. store.Store satisfies it; WithStore picks it up automatically.
+type PagerStore interface {
+	SavePages(key store.Key, parts []string) error
+	NextPages(key store.Key, n int) ([]string, int, error)
+}
+
+// ReplyLimiter is implemented by transports whose channel rejects or truncates
+// long messages. The runner never sends a part longer than MaxReplyChars.
+type ReplyLimiter interface {
+	MaxReplyChars() int
+}
+
+// WithMaxReplyParts sets how many numbered parts are sent per reply before the
+// rest is held for /more.
+func WithMaxReplyParts(n int) RunnerOption {
+	return func(r *Runner) { r.maxReplyParts = n }
+}
+
+// WithTransportReplyLimits overrides the reply size limit per transport ID.
+func WithTransportReplyLimits(limits map[string]int) RunnerOption {
+	return func(r *Runner) { r.transportLimits = limits }
+}
+
+// partOverhead leaves room for the "(12/34) " prefix and the /more hint.
+const partOverhead = 48
+
+// replyLimit returns the effective reply size for a transport; 0 means unlimited.
+func (r *Runner) replyLimit(tr Transport) int {
+	limit := r.maxReplyChars
+	tighter := func(n int) {
+		if n > 0 && (limit <= 0 || n < limit) {
+			limit = n
+		}
+	}
+	if l, ok := tr.(ReplyLimiter); ok {
+		tighter(l.MaxReplyChars())
+	}
+	tighter(r.transportLimits[tr.ID()])
+	return limit
+}
+
+// sendReply delivers text as one or more numbered parts that fit the transport.
+// Parts beyond the per-reply budget are stored for /more when a pager is available.
+func (r *Runner) sendReply(ctx context.Context, tr Transport, out OutboundMessage, log *slog.Logger) error {
+	if len(out.Attachments) > 0 {
+		if as, ok := tr.(AttachmentSender); !ok || !as.SendsAttachments() {
+			log.Warn("transport cannot send attachments", slog.Int("count", len(out.Attachments)))
+			out.Text += fmt.Sprintf("\n\n(files not sent over %s: %s)", tr.ID(), attachmentNames(out.Attachments))
+			out.Attachments = nil
+		}
+	}
+	limit := r.replyLimit(tr)
+	chunkSize := limit
+	if limit > 0 {
+		chunkSize = limit - partOverhead
+		if chunkSize < limit/2 {
+			chunkSize = limit / 2
+		}
+	}
+	parts := chunkText(out.Text, chunkSize)
+	if len(parts) > 1 {
+		for i := range parts {
+			parts[i] = fmt.Sprintf("(%d/%d) %s", i+1, len(parts), parts[i])
+		}
+	}
+
+	maxParts := r.maxReplyParts
+	if maxParts < 1 {
+		maxParts = 1
+	}
+	send, rest := parts, []string(nil)
+	if len(parts) > maxParts {
+		send, rest = parts[:maxParts], parts[maxParts:]
+	}
+	key := pagerKey(out)
+	if r.pager != nil {
+		if err := r.pager.SavePages(key, rest); err != nil {
+			log.Warn("save reply pages failed", slog.String("err", err.Error()))
+			rest = nil
+		}
+	}
+	if len(rest) > 0 {
+		last := len(send) - 1
+		if r.pager != nil {
+			send[last] += fmt.Sprintf("\n\n(%d more part(s); send /more)", len(rest))
+		} else {
+			send[last] += "\n\n(reply truncated)"
+		}
+	}
+	return r.sendParts(ctx, tr, out, send, log)
+}
+
+// sendMore delivers the next batch of stored parts for the conversation.
+func (r *Runner) sendMore(ctx context.Context, msg InboundMessage, log *slog.Logger) {
+	tr, ok := r.transportMap[msg.Transport]
+	if !ok {
+		return
+	}
+	out := OutboundMessage{Transport: msg.Transport, Recipient: msg.Sender, ThreadID: msg.ThreadID, Meta: msg.Meta}
+	if r.pager == nil {
+		r.sendSimple(ctx, msg.Transport, msg.Sender, msg.ThreadID, "Nothing more to show.")
+		return
+	}
+	maxParts := r.maxReplyParts
+	if maxParts < 1 {
+		maxParts = 1
+	}
+	parts, left, err := r.pager.NextPages(pagerKey(out), maxParts)
+	if err != nil {
+		r.sendSimple(ctx, msg.Transport, msg.Sender, msg.ThreadID, fmt.Sprintf("Failed to load more: %v", err))
+		return
+	}
+	if len(parts) == 0 {
+		r.sendSimple(ctx, msg.Transport, msg.Sender, msg.ThreadID, "Nothing more to show.")
+		return
+	}
+	if left > 0 {
+		parts[len(parts)-1] += fmt.Sprintf("\n\n(%d more part(s); send /more)", left)
+	}
+	if err := r.sendParts(ctx, tr, out, parts, log); err != nil {
+		log.Error("send error", slog.String("err", err.Error()))
+	}
+}
+
+// sendParts sends parts in order. When a part still fails after the inline
+// retries, it and the parts after it are handed to the outbox (if any) so they are
+// retried later in the same order. Permanent failures are not queued.
+// Attachments go with the last part.
+func (r *Runner) sendParts(ctx context.Context, tr Transport, out OutboundMessage, parts []string, log *slog.Logger) error {
+	for i, p := range parts {
+		msg := out
+		msg.Text = p
+		if i < len(parts)-1 {
+			msg.Attachments = nil
+		}
+		err := r.sendWithRetry(ctx, tr, msg, log)
+		if err == nil {
+			continue
+		}
+		if r.outbox == nil || IsPermanent(err) {
+			return err
+		}
+		for j, rest := range parts[i:] {
+			msg.Text = rest
+			if i+j == len(parts)-1 {
+				msg.Attachments = out.Attachments
+			}
+			if !r.queueOutbound(msg, err, log) {
+				return err
+			}
+		}
+		metrics.IncSendError()
+		return nil
+	}
+	return nil
+}
+
+// replyLong sends a possibly long command result (e.g. /shell output) to the sender.
+func (r *Runner) replyLong(ctx context.Context, msg InboundMessage, text string, log *slog.Logger) {
+	tr, ok := r.transportMap[msg.Transport]
+	if !ok {
+		return
+	}
+	out := OutboundMessage{Transport: msg.Transport, Recipient: msg.Sender, ThreadID: msg.ThreadID, Meta: msg.Meta, Text: text}
+	if err := r.sendReply(ctx, tr, out, log); err != nil {
+		log.Error("send error", slog.String("err", err.Error()))
+	}
+}
+
+func pagerKey(out OutboundMessage) store.Key {
+	return store.SenderKey(out.Transport, out.Recipient)
+}
+
+// chunkText splits text into parts of at most limit bytes, preferring paragraph,
+// line and word boundaries. A code fence left open at a split is closed at the end
+// of the part and reopened at the start of the next one.
+func chunkText(text string, limit int) []string {
+	if limit <= 0 || len(text) <= limit {
+		return []string{text}
+	}
+	var parts []string
+	rest := text
+	for len(rest) > limit {
+		cut := splitPoint(rest, limit-4) // keep room to close a fence
+		part := strings.TrimRight(rest[:cut], "\n")
+		rest = strings.TrimLeft(rest[cut:], "\n")
+		if fence, open := openFence(part); open {
+			part += "\n```"
+			if len(fence)+1 < limit/4 {
+				rest = fence + "\n" + rest
+			}
+		}
+		parts = append(parts, part)
+	}
+	if strings.TrimSpace(rest) != "" {
+		parts = append(parts, rest)
+	}
+	return parts
+}
+
+// splitPoint picks where to cut s so the head is at most max bytes.
+func splitPoint(s string, max int) int {
+	if max < 1 {
+		max = 1
+	}
+	window := s[:max]
+	for _, sep := range []string{"\n\n", "\n", " "} {
+		if i := strings.LastIndex(window, sep); i > max/2 {
+			return i + len(sep)
+		}
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	if cut == 0 {
+		cut = max
+	}
+	return cut
+}
+
+// openFence reports whether part ends inside a ``` block and returns the line that
+// opened it.
+func openFence(part string) (string, bool) {
+	var fence string
+	open := false
+	for _, line := range strings.Split(part, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			open = !open
+			if open {
+				fence = trimmed
+			}
+		}
+	}
+	return fence, open
+}
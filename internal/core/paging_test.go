@@ -0,0 +1,114 @@
+package core
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/joelklabo/buddy/internal/store"
+)
+
+// pagerStore is an in-memory PagerStore layered on memoryStore.
+type pagerStore struct {
+	memoryStore
+	pages map[store.Key][]string
+}
+
+func (p *pagerStore) SavePages(key store.Key, parts []string) error {
+	if p.pages == nil {
+		p.pages = map[store.Key][]string{}
+	}
+	if len(parts) == 0 {
+		delete(p.pages, key)
+		return nil
+	}
+	p.pages[key] = parts
+	return nil
+}
+
+func (p *pagerStore) NextPages(key store.Key, n int) ([]string, int, error) {
+	parts := p.pages[key]
+	if n > len(parts) {
+		n = len(parts)
+	}
+	out, rest := parts[:n], parts[n:]
+	_ = p.SavePages(key, rest)
+	return out, len(rest), nil
+}
+
+func TestChunkTextPrefersParagraphs(t *testing.T) {
+	text := strings.Repeat("a", 60) + "\n\n" + strings.Repeat("b", 60) + "\n\n" + strings.Repeat("c", 30)
+	parts := chunkText(text, 100)
+	if len(parts) != 2 {
+		t.Fatalf("expected 2 parts, got %d: %q", len(parts), parts)
+	}
+	if parts[0] != strings.Repeat("a", 60) || !strings.HasPrefix(parts[1], strings.Repeat("b", 60)+"\n\n") {
+		t.Fatalf("expected split at a paragraph break, got %q", parts)
+	}
+}
+
+func TestChunkTextReopensCodeFence(t *testing.T) {
+	var lines []string
+	for i := 0; i < 40; i++ {
+		lines = append(lines, "echo line")
+	}
+	text := "Run this:\n```sh\n" + strings.Join(lines, "\n") + "\n```\ndone"
+	parts := chunkText(text, 120)
+	if len(parts) < 2 {
+		t.Fatalf("expected several parts, got %d", len(parts))
+	}
+	for i, p := range parts {
+		if len(p) > 120 {
+			t.Fatalf("part %d exceeds limit: %d bytes", i, len(p))
+		}
+		if strings.Count(p, "```")%2 != 0 {
+			t.Fatalf("part %d has an unbalanced fence: %q", i, p)
+		}
+	}
+	if !strings.HasPrefix(parts[1], "```sh\n") {
+		t.Fatalf("fence not reopened: %q", parts[1])
+	}
+}
+
+func TestLongReplyPagedWithMore(t *testing.T) {
+	st := &pagerStore{}
+	reply := strings.TrimSpace(strings.Repeat("word ", 200)) // ~1000 chars
+	r := NewRunner(nil, &mockAgent{reply: reply}, nil, slog.Default(),
+		WithStore(st), WithMaxReplyChars(150), WithMaxReplyParts(2))
+	outCh := make(chan OutboundMessage, 32)
+	r.transportMap = map[string]Transport{"mock": &transportSpy{out: outCh}}
+
+	r.handleMessage(context.Background(), InboundMessage{Transport: "mock", Sender: "alice", Text: "hi"})
+	first := drain(outCh)
+	if len(first) != 2 {
+		t.Fatalf("expected 2 parts in first batch, got %d", len(first))
+	}
+	for _, m := range first {
+		if len(m) > 150 {
+			t.Fatalf("part exceeds limit: %d bytes", len(m))
+		}
+	}
+	if !strings.HasPrefix(first[0], "(1/") || !strings.Contains(first[1], "send /more") {
+		t.Fatalf("unexpected first batch %q", first)
+	}
+
+	var got []string
+	got = append(got, first...)
+	for i := 0; i < 10 && len(st.pages) > 0; i++ {
+		r.handleMessage(context.Background(), InboundMessage{Transport: "mock", Sender: "alice", Text: "/more"})
+		got = append(got, drain(outCh)...)
+	}
+	if len(st.pages) != 0 {
+		t.Fatalf("pages left after paging through: %v", st.pages)
+	}
+	last := got[len(got)-1]
+	if strings.Contains(last, "/more") {
+		t.Fatalf("last part should not ask for more: %q", last)
+	}
+
+	r.handleMessage(context.Background(), InboundMessage{Transport: "mock", Sender: "alice", Text: "/more"})
+	if msgs := drain(outCh); len(msgs) != 1 || msgs[0] != "Nothing more to show." {
+		t.Fatalf("unexpected reply when nothing is left: %q", msgs)
+	}
+}
@@ -0,0 +1,114 @@
+package core
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// AgentEvent is an intermediate update reported while an agent works, e.g. a
+// command it started or files it changed.
+type AgentEvent struct {
+	Kind string // reasoning, command or file_change
+	Text string // short human-readable summary
+}
+
+// StreamingAgent is implemented by agents that can report progress before their
+// final reply. emit may be called from any goroutine until GenerateStream returns.
+type StreamingAgent interface {
+	Agent
+	GenerateStream(ctx context.Context, req AgentRequest, emit func(AgentEvent)) (AgentResponse, error)
+}
+
+// WithProgressInterval sets the minimum gap between progress messages sent while a
+// streaming agent runs. Zero or negative disables progress messages.
+func WithProgressInterval(d time.Duration) RunnerOption {
+	return func(r *Runner) { r.progressInterval = d }
+}
+
+type progressKey struct{}
+
+// generate calls the agent, streaming progress when both the agent and ctx
+// support it.
+func (r *Runner) generate(ctx context.Context, req AgentRequest) (AgentResponse, error) {
+	agent := r.agentFor(ctx)
+	if sa, ok := agent.(StreamingAgent); ok {
+		if emit, ok := ctx.Value(progressKey{}).(func(AgentEvent)); ok {
+			return sa.GenerateStream(ctx, req, emit)
+		}
+	}
+	return agent.Generate(ctx, req)
+}
+
+// progressBacklog is how many progress updates wait for a slow transport; older
+// ones are dropped first, since only the latest is worth sending.
+const progressBacklog = 4
+
+// withProgress attaches a throttled progress reporter for msg to ctx. At most one
+// message is sent per interval, the first no sooner than one interval into the
+// run, so quick replies stay quiet. Updates are sent from a separate goroutine so
+// a slow transport never stalls the agent's output; the returned func stops it,
+// drops unsent updates and waits for a send in progress, and must be called
+// before the reply goes out.
+func (r *Runner) withProgress(ctx context.Context, msg InboundMessage, log *slog.Logger) (context.Context, func()) {
+	if r.progressInterval <= 0 {
+		return ctx, func() {}
+	}
+	var (
+		mu       sync.Mutex
+		lastSent = time.Now()
+		lastText string
+
+		updates  = make(chan string, progressBacklog)
+		quit     = make(chan struct{})
+		finished = make(chan struct{})
+		stopOnce sync.Once
+	)
+	go func() {
+		defer close(finished)
+		for {
+			select {
+			case <-quit:
+				return
+			case text := <-updates:
+				select {
+				case <-quit:
+					return
+				default:
+				}
+				r.sendSimple(ctx, msg.Transport, msg.Sender, msg.ThreadID, text)
+			}
+		}
+	}()
+	emit := func(ev AgentEvent) {
+		if ev.Text == "" {
+			return
+		}
+		mu.Lock()
+		if ev.Text == lastText || time.Since(lastSent) < r.progressInterval {
+			mu.Unlock()
+			return
+		}
+		lastSent, lastText = time.Now(), ev.Text
+		mu.Unlock()
+		log.Debug("progress", slog.String("kind", ev.Kind), slog.String("text", ev.Text))
+		text := snippet(ev.Text, 200)
+		for {
+			select {
+			case updates <- text:
+				return
+			default:
+			}
+			select {
+			case <-updates: // drop the oldest
+			default:
+			}
+		}
+	}
+	stop := func() {
+		stopOnce.Do(func() { close(quit) })
+		<-finished
+	}
+	return context.WithValue(ctx, progressKey{}, emit), stop
+}
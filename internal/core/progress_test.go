@@ -0,0 +1,113 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// streamAgent emits events with a pause between them before replying.
+type streamAgent struct {
+	events []AgentEvent
+	pause  time.Duration
+}
+
+func (s *streamAgent) Generate(ctx context.Context, req AgentRequest) (AgentResponse, error) {
+	return AgentResponse{Reply: "done"}, nil
+}
+
+func (s *streamAgent) GenerateStream(ctx context.Context, req AgentRequest, emit func(AgentEvent)) (AgentResponse, error) {
+	for _, ev := range s.events {
+		time.Sleep(s.pause)
+		emit(ev)
+	}
+	return s.Generate(ctx, req)
+}
+
+func TestProgressMessagesAreThrottled(t *testing.T) {
+	agent := &streamAgent{pause: 15 * time.Millisecond, events: []AgentEvent{
+		{Kind: "command", Text: "running: go build ./..."},
+		{Kind: "command", Text: "running: go vet ./..."},
+		{Kind: "command", Text: "running: go test ./..."},
+		{Kind: "command", Text: "running: go test ./..."},
+	}}
+	r := NewRunner(nil, agent, nil, slog.Default(), WithProgressInterval(25*time.Millisecond))
+	outCh := make(chan OutboundMessage, 16)
+	r.transportMap = map[string]Transport{"mock": &transportSpy{out: outCh}}
+
+	r.handleMessage(context.Background(), InboundMessage{Transport: "mock", Sender: "alice", Text: "build it"})
+	msgs := drain(outCh)
+	if len(msgs) < 2 || msgs[len(msgs)-1] != "done" {
+		t.Fatalf("expected progress then reply, got %q", msgs)
+	}
+	progress := msgs[:len(msgs)-1]
+	if len(progress) >= len(agent.events) {
+		t.Fatalf("progress not throttled: %q", progress)
+	}
+	for _, p := range progress {
+		if !strings.HasPrefix(p, "running: ") {
+			t.Fatalf("unexpected progress message %q", p)
+		}
+	}
+}
+
+func TestProgressDisabled(t *testing.T) {
+	agent := &streamAgent{events: []AgentEvent{{Kind: "command", Text: "running: ls"}}}
+	r := NewRunner(nil, agent, nil, slog.Default(), WithProgressInterval(0))
+	outCh := make(chan OutboundMessage, 4)
+	r.transportMap = map[string]Transport{"mock": &transportSpy{out: outCh}}
+
+	r.handleMessage(context.Background(), InboundMessage{Transport: "mock", Sender: "alice", Text: "hi"})
+	if msgs := drain(outCh); len(msgs) != 1 || msgs[0] != "done" {
+		t.Fatalf("expected only the reply, got %q", msgs)
+	}
+}
+
+// slowTransport blocks every send until release is closed.
+type slowTransport struct {
+	transportSpy
+	release chan struct{}
+}
+
+func (s *slowTransport) Send(ctx context.Context, msg OutboundMessage) error {
+	<-s.release
+	return s.transportSpy.Send(ctx, msg)
+}
+
+func TestSlowProgressSendDoesNotStallAgent(t *testing.T) {
+	var events []AgentEvent
+	for i := 0; i < 20; i++ {
+		events = append(events, AgentEvent{Kind: "command", Text: fmt.Sprintf("running: step %d", i)})
+	}
+	agent := &streamAgent{pause: 2 * time.Millisecond, events: events}
+	r := NewRunner(nil, agent, nil, slog.Default(), WithProgressInterval(time.Millisecond))
+	outCh := make(chan OutboundMessage, 32)
+	tr := &slowTransport{transportSpy: transportSpy{out: outCh}, release: make(chan struct{})}
+	r.transportMap = map[string]Transport{"mock": tr}
+
+	ctx, stop := r.withProgress(context.Background(), InboundMessage{Transport: "mock", Sender: "alice"}, slog.Default())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = r.generate(ctx, AgentRequest{})
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("agent stalled behind a blocked progress send")
+	}
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		stop()
+	}()
+	time.Sleep(10 * time.Millisecond) // let stop begin while a send is blocked
+	close(tr.release)
+	<-stopped
+	if msgs := drain(outCh); len(msgs) > 1 {
+		t.Fatalf("expected queued progress to be dropped on stop, got %q", msgs)
+	}
+}
@@ -0,0 +1,120 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// Project is a workspace a sender can switch to with /project.
+type Project struct {
+	ID   string
+	Name string
+	Path string
+}
+
+// WithProjects sets the projects senders can pick with /project. A sender's
+// active project becomes the working directory of CLI agents and the root for
+// shell and filesystem actions.
+func WithProjects(projects []Project) RunnerOption {
+	return func(r *Runner) { r.projects = projects }
+}
+
+type workdirKey struct{}
+
+// WithWorkdir returns a context that tells agents and actions to work in dir
+// instead of their configured directory.
+func WithWorkdir(ctx context.Context, dir string) context.Context {
+	return context.WithValue(ctx, workdirKey{}, dir)
+}
+
+// WorkdirFrom reports the working directory set with WithWorkdir, if any.
+func WorkdirFrom(ctx context.Context) (string, bool) {
+	dir, ok := ctx.Value(workdirKey{}).(string)
+	return dir, ok && dir != ""
+}
+
+func (r *Runner) project(id string) (Project, bool) {
+	for _, p := range r.projects {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return Project{}, false
+}
+
+// withProject applies the sender's active project, if any, to ctx.
+func (r *Runner) withProject(ctx context.Context, msg InboundMessage, log *slog.Logger) context.Context {
+	if len(r.projects) == 0 {
+		return ctx
+	}
+	if p, ok := r.project(r.loadPrefs(msg, log).Project); ok {
+		return WithWorkdir(ctx, p.Path)
+	}
+	return ctx
+}
+
+func (r *Runner) projectList() string {
+	ids := make([]string, 0, len(r.projects))
+	for _, p := range r.projects {
+		ids = append(ids, p.ID)
+	}
+	return strings.Join(ids, ", ")
+}
+
+// handleProjectsCommand implements /projects.
+func (r *Runner) handleProjectsCommand(ctx context.Context, msg InboundMessage, log *slog.Logger) {
+	if len(r.projects) == 0 {
+		r.sendSimple(ctx, msg.Transport, msg.Sender, msg.ThreadID, "No projects are configured.")
+		return
+	}
+	active := r.loadPrefs(msg, log).Project
+	lines := []string{"Projects:"}
+	for _, p := range r.projects {
+		mark := ""
+		if p.ID == active {
+			mark = " (active)"
+		}
+		lines = append(lines, fmt.Sprintf("- %s: %s — %s%s", p.ID, p.Name, p.Path, mark))
+	}
+	lines = append(lines, "Use /project <id> to switch.")
+	r.sendSimple(ctx, msg.Transport, msg.Sender, msg.ThreadID, strings.Join(lines, "\n"))
+}
+
+// handleProjectCommand implements /project [id]. Switching clears the sender's
+// sessions, since an agent session belongs to the directory it ran in.
+func (r *Runner) handleProjectCommand(ctx context.Context, msg InboundMessage, arg string, log *slog.Logger) {
+	reply := func(text string) { r.sendSimple(ctx, msg.Transport, msg.Sender, msg.ThreadID, text) }
+	if len(r.projects) == 0 {
+		reply("No projects are configured.")
+		return
+	}
+	prefs := r.loadPrefs(msg, log)
+	id := strings.TrimSpace(arg)
+	if id == "" {
+		if p, ok := r.project(prefs.Project); ok {
+			reply(fmt.Sprintf("Project: %s (%s)", p.ID, p.Path))
+		} else {
+			reply(fmt.Sprintf("No project selected. Available: %s", r.projectList()))
+		}
+		return
+	}
+	p, ok := r.project(id)
+	if !ok {
+		reply(fmt.Sprintf("Unknown project %q. Available: %s", id, r.projectList()))
+		return
+	}
+	if prefs.Project == p.ID {
+		reply(fmt.Sprintf("Already on project %s (%s).", p.ID, p.Path))
+		return
+	}
+	prefs.Project = p.ID
+	if err := r.savePrefs(msg, prefs); err != nil {
+		log.Warn("save sender prefs failed", slog.String("err", err.Error()))
+		reply(fmt.Sprintf("Failed to switch project: %v", err))
+		return
+	}
+	r.clearSessions(msg)
+	reply(fmt.Sprintf("Switched to project %s (%s). Starting a fresh session.", p.ID, p.Path))
+}
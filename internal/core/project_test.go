@@ -0,0 +1,58 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// workdirAction is a /shell action that records the working directory its
+// context carried.
+type workdirAction struct {
+	shellAction
+	dir string
+}
+
+func (w *workdirAction) Invoke(ctx context.Context, args json.RawMessage) (json.RawMessage, error) {
+	w.dir, _ = WorkdirFrom(ctx)
+	return []byte(`"ok"`), nil
+}
+
+func TestProjectCommandSetsWorkdir(t *testing.T) {
+	agent := &mockAgent{reply: "done"}
+	act := &workdirAction{}
+	st := &memoryStore{}
+	r := NewRunner(nil, agent, []Action{act}, slog.Default(), WithStore(st), WithProjects([]Project{
+		{ID: "site", Name: "Website", Path: "/srv/site"},
+		{ID: "api", Name: "API", Path: "/srv/api"},
+	}))
+	outCh := make(chan OutboundMessage, 8)
+	r.transportMap = map[string]Transport{"mock": &transportSpy{out: outCh}}
+	send := func(text string) string {
+		r.handleMessage(context.Background(), InboundMessage{Transport: "mock", Sender: "alice", Text: text})
+		return strings.Join(drain(outCh), "\n")
+	}
+
+	if got := send("/project blog"); !strings.Contains(got, `Unknown project "blog". Available: site, api`) {
+		t.Fatalf("unexpected reply %q", got)
+	}
+	if got := send("/project api"); !strings.Contains(got, "Switched to project api (/srv/api)") {
+		t.Fatalf("unexpected reply %q", got)
+	}
+	send("deploy it")
+	if len(agent.calls) != 1 || agent.calls[0].WorkingDir != "/srv/api" {
+		t.Fatalf("agent not run in project dir: %+v", agent.calls)
+	}
+	send("/shell ls")
+	if act.dir != "/srv/api" {
+		t.Fatalf("shell not run in project dir, got %q", act.dir)
+	}
+	if got := send("/projects"); !strings.Contains(got, "- api: API — /srv/api (active)") {
+		t.Fatalf("unexpected /projects reply %q", got)
+	}
+	if got := send("/status"); !strings.Contains(got, "Project: api (/srv/api)") {
+		t.Fatalf("status does not show project: %q", got)
+	}
+}
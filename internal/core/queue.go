@@ -0,0 +1,125 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/joelklabo/buddy/internal/store"
+)
+
+// InboundQueue persists inbound messages from receipt until they are handled, so
+// a crash or restart does not lose them. store.Store satisfies it; WithStore picks
+// it up automatically.
+type InboundQueue interface {
+	EnqueueInbound(m store.QueuedMessage) (string, error)
+	MarkInboundRunning(id string) error
+	CompleteInbound(id string) error
+	PendingInbound() ([]store.QueuedMessage, error)
+}
+
+// maxInboundAttempts stops resuming a message that keeps getting interrupted.
+const maxInboundAttempts = 3
+
+// WithResumeInterrupted makes the runner re-run messages whose handling was
+// interrupted by a crash or restart. By default the sender is asked to resend.
+func WithResumeInterrupted(resume bool) RunnerOption {
+	return func(r *Runner) { r.resumeInterrupted = resume }
+}
+
+// enqueueInbound persists msg before it is dispatched, records it as seen and
+// acks it to the transport. The queue records the dedupe key in the same write,
+// so a message is never marked seen without being queued. Without a queue msg
+// is handled in memory; if the write fails it is handled in memory too but
+// left unrecorded and nacked, so the transport's redelivery still runs.
+func (r *Runner) enqueueInbound(msg InboundMessage) InboundMessage {
+	if r.inboundQueue == nil {
+		r.markSeen(msg)
+		msg.ack(nil)
+		return msg
+	}
+	id, err := r.inboundQueue.EnqueueInbound(store.QueuedMessage{
+		Transport: msg.Transport,
+		Sender:    msg.Sender,
+		Text:      msg.Text,
+		ThreadID:  msg.ThreadID,
+		Meta:      msg.Meta,
+		DedupeKey: r.dedupeKey(msg),
+
+		Attachments: toStoreAttachments(msg.Attachments),
+	})
+	if err != nil {
+		r.logger.Warn("enqueue inbound failed", slog.String("transport", msg.Transport), slog.String("err", err.Error()))
+		msg.ack(err)
+		return msg
+	}
+	if any(r.dedupe) != any(r.inboundQueue) {
+		r.markSeen(msg) // the queue is not the dedupe store, so it did not record it
+	}
+	msg.queueID = id
+	msg.ack(nil)
+	return msg
+}
+
+// handleQueued runs msg and removes it from the durable queue once handled.
+// Messages reached after shutdown began are left queued for the next start.
+func (r *Runner) handleQueued(ctx context.Context, msg InboundMessage) {
+	if msg.queueID == "" {
+		r.handleMessage(ctx, msg)
+		if ctx.Err() != nil {
+			r.notifyAborted(msg)
+		}
+		return
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	if err := r.inboundQueue.MarkInboundRunning(msg.queueID); err != nil {
+		r.logger.Warn("mark inbound running failed", slog.String("err", err.Error()))
+	}
+	r.handleMessage(ctx, msg)
+	if ctx.Err() != nil {
+		r.notifyAborted(msg)
+		return
+	}
+	if err := r.inboundQueue.CompleteInbound(msg.queueID); err != nil {
+		r.logger.Warn("complete inbound failed", slog.String("err", err.Error()))
+	}
+}
+
+// recoverInbound re-dispatches messages left in the queue by a previous process.
+// Messages that never started are handled normally; interrupted ones are resumed
+// when enabled (up to maxInboundAttempts) or the sender is asked to resend. The
+// transports may not be running yet, so that notice goes through the outbox.
+func (r *Runner) recoverInbound(ctx context.Context, d *dispatcher) {
+	if r.inboundQueue == nil {
+		return
+	}
+	queued, err := r.inboundQueue.PendingInbound()
+	if err != nil {
+		r.logger.Warn("load inbound queue failed", slog.String("err", err.Error()))
+		return
+	}
+	for _, q := range queued {
+		msg := InboundMessage{Transport: q.Transport, Sender: q.Sender, Text: q.Text, ThreadID: q.ThreadID, Meta: q.Meta, Attachments: fromStoreAttachments(q.Attachments), queueID: q.ID}
+		log := r.logger.With(slog.String("transport", q.Transport), slog.String("sender", q.Sender), slog.String("queue_id", q.ID))
+		if q.State == store.InboundPending || (r.resumeInterrupted && q.Attempts < maxInboundAttempts) {
+			log.Info("resuming queued message", slog.String("state", q.State), slog.Int("attempts", q.Attempts))
+			d.submit(msg)
+			continue
+		}
+		log.Info("queued message was interrupted", slog.Int("attempts", q.Attempts))
+		notice := OutboundMessage{Transport: q.Transport, Recipient: q.Sender, ThreadID: q.ThreadID, Meta: q.Meta,
+			Text: fmt.Sprintf("Your request was interrupted by a restart: %q. Resend it?", snippet(q.Text, 80))}
+		if !r.queueNotice(notice, log) {
+			if tr, ok := r.transportMap[q.Transport]; ok {
+				if err := r.sendWithRetry(ctx, tr, notice, log); err != nil {
+					log.Warn("interrupted notice not sent", slog.String("err", err.Error()))
+				}
+			}
+		}
+		if err := r.inboundQueue.CompleteInbound(q.ID); err != nil {
+			log.Warn("complete inbound failed", slog.String("err", err.Error()))
+		}
+	}
+}
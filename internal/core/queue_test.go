@@ -0,0 +1,224 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joelklabo/buddy/internal/store"
+)
+
+// queueStore is an in-memory InboundQueue layered on memoryStore.
+type queueStore struct {
+	memoryStore
+	mu    sync.Mutex
+	seq   int
+	items []store.QueuedMessage
+}
+
+func (q *queueStore) EnqueueInbound(m store.QueuedMessage) (string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.seq++
+	m.ID = fmt.Sprintf("%016x", q.seq)
+	m.State = store.InboundPending
+	q.items = append(q.items, m)
+	return m.ID, nil
+}
+
+func (q *queueStore) MarkInboundRunning(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i := range q.items {
+		if q.items[i].ID == id {
+			q.items[i].State = store.InboundRunning
+			q.items[i].Attempts++
+		}
+	}
+	return nil
+}
+
+func (q *queueStore) CompleteInbound(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i := range q.items {
+		if q.items[i].ID == id {
+			q.items = append(q.items[:i], q.items[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (q *queueStore) PendingInbound() ([]store.QueuedMessage, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]store.QueuedMessage(nil), q.items...), nil
+}
+
+func TestQueuedMessageCompletedAfterHandling(t *testing.T) {
+	st := &queueStore{}
+	r := NewRunner(nil, &mockAgent{reply: "ok"}, nil, slog.Default(), WithStore(st))
+	outCh := make(chan OutboundMessage, 4)
+	r.transportMap = map[string]Transport{"mock": &transportSpy{out: outCh}}
+
+	msg := r.enqueueInbound(InboundMessage{Transport: "mock", Sender: "alice", Text: "hi"})
+	if len(st.items) != 1 || msg.queueID == "" {
+		t.Fatalf("message not persisted before dispatch")
+	}
+	r.handleQueued(context.Background(), msg)
+	if len(st.items) != 0 {
+		t.Fatalf("handled message left in queue: %+v", st.items)
+	}
+
+	// A message reached after shutdown began stays queued for the next start.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r.handleQueued(ctx, r.enqueueInbound(InboundMessage{Transport: "mock", Sender: "alice", Text: "later"}))
+	if len(st.items) != 1 || st.items[0].State != store.InboundPending {
+		t.Fatalf("expected pending message kept, got %+v", st.items)
+	}
+}
+
+func TestEnqueueInboundAcksAfterPersisting(t *testing.T) {
+	st := &queueStore{}
+	r := NewRunner(nil, &mockAgent{}, nil, slog.Default(), WithStore(st))
+	var persisted int
+	acked := false
+	r.enqueueInbound(InboundMessage{Transport: "mock", Sender: "alice", Text: "hi", Ack: func(err error) {
+		acked = err == nil
+		persisted = len(st.items)
+	}})
+	if !acked || persisted != 1 {
+		t.Fatalf("ack should follow the queue write: acked=%v queued=%d", acked, persisted)
+	}
+}
+
+func TestRecoverInboundAfterRestart(t *testing.T) {
+	st := &queueStore{}
+	pendingID, _ := st.EnqueueInbound(store.QueuedMessage{Transport: "mock", Sender: "alice", Text: "never started"})
+	runningID, _ := st.EnqueueInbound(store.QueuedMessage{Transport: "mock", Sender: "bob", Text: "deploy the site"})
+	_ = st.MarkInboundRunning(runningID)
+
+	agent := &mockAgent{reply: "ok"}
+	r := NewRunner(nil, agent, nil, slog.Default(), WithStore(st))
+	outCh := make(chan OutboundMessage, 8)
+	r.transportMap = map[string]Transport{"mock": &transportSpy{out: outCh}}
+	d := newDispatcher(1, r.runKey, func(msg InboundMessage) { r.handleQueued(context.Background(), msg) })
+	r.recoverInbound(context.Background(), d)
+	d.wait()
+
+	if len(agent.calls) != 1 || !strings.Contains(agent.calls[0].Prompt, "never started") {
+		t.Fatalf("pending message %s not resumed: %+v", pendingID, agent.calls)
+	}
+	msgs := strings.Join(drain(outCh), "\n")
+	if !strings.Contains(msgs, `interrupted by a restart: "deploy the site". Resend it?`) {
+		t.Fatalf("sender not told about interrupted request: %q", msgs)
+	}
+	if len(st.items) != 0 {
+		t.Fatalf("queue not drained: %+v", st.items)
+	}
+}
+
+func TestRecoverInboundResumesInterruptedWhenEnabled(t *testing.T) {
+	st := &queueStore{}
+	id, _ := st.EnqueueInbound(store.QueuedMessage{Transport: "mock", Sender: "bob", Text: "deploy the site"})
+	_ = st.MarkInboundRunning(id)
+
+	agent := &mockAgent{reply: "ok"}
+	r := NewRunner(nil, agent, nil, slog.Default(), WithStore(st), WithResumeInterrupted(true))
+	r.transportMap = map[string]Transport{"mock": &transportSpy{out: make(chan OutboundMessage, 4)}}
+	d := newDispatcher(1, r.runKey, func(msg InboundMessage) { r.handleQueued(context.Background(), msg) })
+	r.recoverInbound(context.Background(), d)
+	d.wait()
+
+	if len(agent.calls) != 1 || len(st.items) != 0 {
+		t.Fatalf("interrupted message not resumed: calls=%d queue=%+v", len(agent.calls), st.items)
+	}
+}
+
+// queueOutboxStore has both a durable inbound queue and an outbox.
+type queueOutboxStore struct {
+	queueStore
+	outbox outboxStore
+}
+
+func (s *queueOutboxStore) EnqueueOutbox(e store.OutboxEntry) (string, error) {
+	return s.outbox.EnqueueOutbox(e)
+}
+func (s *queueOutboxStore) PendingOutbox() ([]store.OutboxEntry, error) {
+	return s.outbox.PendingOutbox()
+}
+func (s *queueOutboxStore) UpdateOutbox(e store.OutboxEntry) error { return s.outbox.UpdateOutbox(e) }
+func (s *queueOutboxStore) DeleteOutbox(id string) error           { return s.outbox.DeleteOutbox(id) }
+func (s *queueOutboxStore) DeadLetter(e store.OutboxEntry) error   { return s.outbox.DeadLetter(e) }
+
+func TestRecoverInboundQueuesNoticeInOutbox(t *testing.T) {
+	st := &queueOutboxStore{}
+	id, _ := st.EnqueueInbound(store.QueuedMessage{Transport: "mock", Sender: "bob", Text: "deploy the site"})
+	_ = st.MarkInboundRunning(id)
+
+	tr := &downTransport{}
+	r := NewRunner([]Transport{tr}, &mockAgent{reply: "ok"}, nil, slog.Default(), WithStore(st))
+	d := newDispatcher(1, r.runKey, func(msg InboundMessage) { r.handleQueued(context.Background(), msg) })
+	r.recoverInbound(context.Background(), d)
+	d.wait()
+
+	if len(tr.sent) != 0 || len(st.outbox.entries) != 1 || !strings.Contains(st.outbox.entries[0].Text, "interrupted by a restart") {
+		t.Fatalf("notice should wait in the outbox for the transport: sent=%v outbox=%+v", tr.sent, st.outbox.entries)
+	}
+	tr.up = true
+	r.flushOutbox(context.Background())
+	if len(tr.sent) != 1 || len(st.outbox.entries) != 0 {
+		t.Fatalf("queued notice not delivered: sent=%v outbox=%+v", tr.sent, st.outbox.entries)
+	}
+}
+
+// flakyQueue fails its first enqueue.
+type flakyQueue struct {
+	queueStore
+	failed bool
+}
+
+func (f *flakyQueue) EnqueueInbound(m store.QueuedMessage) (string, error) {
+	if !f.failed {
+		f.failed = true
+		return "", errors.New("disk full")
+	}
+	return f.queueStore.EnqueueInbound(m)
+}
+
+func TestRedeliveryAfterFailedEnqueueStillRuns(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	agent := &mockAgent{reply: "ok"}
+	tr := &mockTransport{id: "mock"}
+	r := NewRunner([]Transport{tr}, agent, nil, slog.Default(), WithStore(&flakyQueue{}), WithDedupeTTL(time.Hour))
+	go func() { _ = r.Start(ctx) }()
+
+	inCh := waitForChannel(t, tr.inboundChan)
+	acks := make(chan error, 2)
+	deliver := func() {
+		inCh <- InboundMessage{Transport: "mock", Sender: "alice", Text: "hi", MessageID: "SM1", Ack: func(err error) { acks <- err }}
+	}
+	deliver()
+	if err := <-acks; err == nil {
+		t.Fatalf("failed enqueue should be nacked")
+	}
+	deliver() // the transport redelivers
+	if err := <-acks; err != nil {
+		t.Fatalf("redelivery dropped or nacked: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(tr.sentMessages()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if sent := tr.sentMessages(); len(sent) != 2 {
+		t.Fatalf("expected the in-memory run and the redelivery to both reply, got %d", len(sent))
+	}
+}
@@ -0,0 +1,177 @@
+package core
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/joelklabo/buddy/internal/metrics"
+	"github.com/joelklabo/buddy/internal/store"
+)
+
+// LimitStore persists per-sender rate-limit usage so a restart does not reset it.
+// store.Store satisfies it; WithStore picks it up automatically.
+type LimitStore interface {
+	LimitState(key store.Key) (store.LimitState, bool, error)
+	SaveLimitState(key store.Key, st store.LimitState) error
+}
+
+// RateLimit bounds what a single sender may consume, and how many runs a
+// transport may have going at once. Zero fields are unlimited.
+type RateLimit struct {
+	MessagesPerMinute       int           // token bucket refill rate; also the burst size
+	ConcurrentRuns          int           // agent runs a sender may have in flight at once
+	TransportConcurrentRuns int           // agent runs in flight at once on the transport, across senders
+	DailyAgentTime          time.Duration // agent run time per UTC day
+}
+
+// WithRateLimits applies def to every sender, with per-transport overrides
+// replacing its non-zero fields.
+func WithRateLimits(def RateLimit, perTransport map[string]RateLimit) RunnerOption {
+	return func(r *Runner) {
+		r.rateLimit = def
+		r.transportRateLimits = perTransport
+	}
+}
+
+func (r *Runner) rateLimitFor(transport string) RateLimit {
+	l := r.rateLimit
+	if o, ok := r.transportRateLimits[transport]; ok {
+		if o.MessagesPerMinute != 0 {
+			l.MessagesPerMinute = o.MessagesPerMinute
+		}
+		if o.ConcurrentRuns != 0 {
+			l.ConcurrentRuns = o.ConcurrentRuns
+		}
+		if o.TransportConcurrentRuns != 0 {
+			l.TransportConcurrentRuns = o.TransportConcurrentRuns
+		}
+		if o.DailyAgentTime != 0 {
+			l.DailyAgentTime = o.DailyAgentTime
+		}
+	}
+	return l
+}
+
+// loadLimitState and saveLimitState must be called with limitMu held.
+func (r *Runner) loadLimitState(key store.Key, log *slog.Logger) store.LimitState {
+	if r.limitStore != nil {
+		st, _, err := r.limitStore.LimitState(key)
+		if err != nil {
+			log.Warn("load rate limit state failed", slog.String("err", err.Error()))
+		}
+		return st
+	}
+	return r.limitStates[key]
+}
+
+func (r *Runner) saveLimitState(key store.Key, st store.LimitState, log *slog.Logger) {
+	if r.limitStore != nil {
+		if err := r.limitStore.SaveLimitState(key, st); err != nil {
+			log.Warn("save rate limit state failed", slog.String("err", err.Error()))
+		}
+		return
+	}
+	if r.limitStates == nil {
+		r.limitStates = map[store.Key]store.LimitState{}
+	}
+	r.limitStates[key] = st
+}
+
+// allowMessage takes one token from the sender's message bucket. It returns how
+// long to wait when the bucket is empty.
+func (r *Runner) allowMessage(msg InboundMessage, log *slog.Logger) (time.Duration, bool) {
+	limit := r.rateLimitFor(msg.Transport)
+	if limit.MessagesPerMinute <= 0 {
+		return 0, true
+	}
+	capacity := float64(limit.MessagesPerMinute)
+	perSec := capacity / 60
+	key := r.senderKey(msg)
+	now := time.Now().UTC()
+
+	r.limitMu.Lock()
+	defer r.limitMu.Unlock()
+	st := r.loadLimitState(key, log)
+	if st.RefilledAt.IsZero() {
+		st.Tokens = capacity
+	} else if elapsed := now.Sub(st.RefilledAt).Seconds(); elapsed > 0 {
+		st.Tokens = math.Min(capacity, st.Tokens+elapsed*perSec)
+	}
+	st.RefilledAt = now
+	if st.Tokens < 1 {
+		r.saveLimitState(key, st, log)
+		return time.Duration((1 - st.Tokens) / perSec * float64(time.Second)), false
+	}
+	st.Tokens--
+	r.saveLimitState(key, st, log)
+	return 0, true
+}
+
+// acquireRun reserves an agent run slot for the sender and on the message's
+// transport, and checks the sender's daily agent-time budget. On success the
+// returned func releases the slots and charges the elapsed run time; otherwise
+// it returns the message to send back. A sender's runs are counted across all
+// its conversations, since the dispatcher already runs one message per
+// conversation at a time.
+func (r *Runner) acquireRun(msg InboundMessage, log *slog.Logger) (func(), string) {
+	limit := r.rateLimitFor(msg.Transport)
+	key := r.senderKey(msg)
+	now := time.Now().UTC()
+	today := now.Format("2006-01-02")
+
+	r.limitMu.Lock()
+	if limit.ConcurrentRuns > 0 && r.senderRuns[key] >= limit.ConcurrentRuns {
+		r.limitMu.Unlock()
+		r.rejectRate(msg, "concurrent_runs", log)
+		return nil, fmt.Sprintf("Rate limited: %d run(s) already in progress; retry when one finishes or send /cancel.", limit.ConcurrentRuns)
+	}
+	if limit.TransportConcurrentRuns > 0 && r.runsInFlight[msg.Transport] >= limit.TransportConcurrentRuns {
+		r.limitMu.Unlock()
+		r.rejectRate(msg, "transport_concurrent_runs", log)
+		return nil, fmt.Sprintf("Rate limited: %d run(s) already in progress on %s; retry in a moment.", limit.TransportConcurrentRuns, msg.Transport)
+	}
+	if limit.DailyAgentTime > 0 {
+		st := r.loadLimitState(key, log)
+		if st.Day == today && st.AgentSeconds >= limit.DailyAgentTime.Seconds() {
+			r.limitMu.Unlock()
+			r.rejectRate(msg, "daily_quota", log)
+			midnight := now.Truncate(24 * time.Hour).Add(24 * time.Hour)
+			return nil, fmt.Sprintf("Daily agent quota of %s used up; retry in %d s.", limit.DailyAgentTime, int(math.Ceil(midnight.Sub(now).Seconds())))
+		}
+	}
+	if r.runsInFlight == nil {
+		r.runsInFlight = map[string]int{}
+		r.senderRuns = map[store.Key]int{}
+	}
+	r.runsInFlight[msg.Transport]++
+	r.senderRuns[key]++
+	r.limitMu.Unlock()
+
+	start := time.Now()
+	return func() {
+		r.limitMu.Lock()
+		defer r.limitMu.Unlock()
+		if r.runsInFlight[msg.Transport]--; r.runsInFlight[msg.Transport] <= 0 {
+			delete(r.runsInFlight, msg.Transport)
+		}
+		if r.senderRuns[key]--; r.senderRuns[key] <= 0 {
+			delete(r.senderRuns, key)
+		}
+		if limit.DailyAgentTime <= 0 {
+			return
+		}
+		st := r.loadLimitState(key, log)
+		if day := time.Now().UTC().Format("2006-01-02"); st.Day != day {
+			st.Day, st.AgentSeconds = day, 0
+		}
+		st.AgentSeconds += time.Since(start).Seconds()
+		r.saveLimitState(key, st, log)
+	}, ""
+}
+
+func (r *Runner) rejectRate(msg InboundMessage, reason string, log *slog.Logger) {
+	log.Warn("rate limited", slog.String("reason", reason))
+	metrics.IncRateLimited(msg.Transport, reason)
+}
@@ -0,0 +1,161 @@
+package core
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joelklabo/buddy/internal/store"
+)
+
+// limitStore is an in-memory LimitStore layered on memoryStore.
+type limitStore struct {
+	memoryStore
+	states map[store.Key]store.LimitState
+}
+
+func (l *limitStore) LimitState(key store.Key) (store.LimitState, bool, error) {
+	st, ok := l.states[key]
+	return st, ok, nil
+}
+
+func (l *limitStore) SaveLimitState(key store.Key, st store.LimitState) error {
+	if l.states == nil {
+		l.states = map[store.Key]store.LimitState{}
+	}
+	l.states[key] = st
+	return nil
+}
+
+func newLimitedRunner(st *limitStore, def RateLimit, perTransport map[string]RateLimit) (*Runner, *mockAgent, chan OutboundMessage) {
+	agent := &mockAgent{reply: "ok"}
+	r := NewRunner(nil, agent, nil, slog.Default(), WithStore(st), WithRateLimits(def, perTransport))
+	outCh := make(chan OutboundMessage, 16)
+	r.transportMap = map[string]Transport{"mock": &transportSpy{out: outCh}}
+	return r, agent, outCh
+}
+
+func TestMessageRateLimitPersistsAcrossRestart(t *testing.T) {
+	st := &limitStore{}
+	r, agent, outCh := newLimitedRunner(st, RateLimit{MessagesPerMinute: 2}, nil)
+	msg := InboundMessage{Transport: "mock", Sender: "alice", Text: "hi"}
+
+	r.handleMessage(context.Background(), msg)
+	r.handleMessage(context.Background(), msg)
+	r.handleMessage(context.Background(), msg)
+	if len(agent.calls) != 2 {
+		t.Fatalf("expected 2 agent calls, got %d", len(agent.calls))
+	}
+	msgs := drain(outCh)
+	if last := msgs[len(msgs)-1]; !strings.HasPrefix(last, "Rate limited, retry in ") {
+		t.Fatalf("expected rate limit reply, got %q", last)
+	}
+
+	// A fresh runner on the same store keeps the empty bucket.
+	r2, agent2, outCh2 := newLimitedRunner(st, RateLimit{MessagesPerMinute: 2}, nil)
+	r2.handleMessage(context.Background(), msg)
+	if len(agent2.calls) != 0 || !strings.HasPrefix(strings.Join(drain(outCh2), ""), "Rate limited") {
+		t.Fatalf("limit was reset by restart")
+	}
+
+	// /cancel is never rate limited.
+	r2.handleMessage(context.Background(), InboundMessage{Transport: "mock", Sender: "alice", Text: "/cancel"})
+	if got := drain(outCh2); len(got) != 1 || got[0] != "Nothing is running." {
+		t.Fatalf("unexpected /cancel reply %q", got)
+	}
+}
+
+func TestTransportOverrideAndDailyQuota(t *testing.T) {
+	st := &limitStore{}
+	r, agent, outCh := newLimitedRunner(st, RateLimit{MessagesPerMinute: 1}, map[string]RateLimit{
+		"mock": {MessagesPerMinute: 100, DailyAgentTime: time.Minute},
+	})
+	msg := InboundMessage{Transport: "mock", Sender: "alice", Text: "hi"}
+
+	r.handleMessage(context.Background(), msg)
+	r.handleMessage(context.Background(), msg)
+	if len(agent.calls) != 2 {
+		t.Fatalf("transport override not applied: %d calls", len(agent.calls))
+	}
+	_ = drain(outCh)
+
+	today := time.Now().UTC().Format("2006-01-02")
+	state := st.states[mockAlice]
+	if state.Day != today {
+		t.Fatalf("agent time not recorded: %+v", state)
+	}
+	state.AgentSeconds = 60
+	st.states[mockAlice] = state
+
+	r.handleMessage(context.Background(), msg)
+	if len(agent.calls) != 2 {
+		t.Fatalf("run allowed past daily quota")
+	}
+	if got := strings.Join(drain(outCh), ""); !strings.Contains(got, "Daily agent quota") || !strings.Contains(got, "retry in") {
+		t.Fatalf("unexpected quota reply %q", got)
+	}
+}
+
+func TestConcurrentRunsLimitCapsTransport(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	agent := funcAgent(func(ctx context.Context, req AgentRequest) (AgentResponse, error) {
+		close(started)
+		<-release
+		return AgentResponse{Reply: "ok"}, nil
+	})
+	r := NewRunner(nil, agent, nil, slog.Default(), WithRateLimits(RateLimit{TransportConcurrentRuns: 1}, nil))
+	outCh := make(chan OutboundMessage, 16)
+	r.transportMap = map[string]Transport{"mock": &transportSpy{out: outCh}, "other": &transportSpy{out: outCh}}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.handleMessage(context.Background(), InboundMessage{Transport: "mock", Sender: "alice", Text: "hi"})
+	}()
+	<-started
+
+	// bob's conversation is separate, so the dispatcher would run it in parallel.
+	r.handleMessage(context.Background(), InboundMessage{Transport: "mock", Sender: "bob", Text: "hi"})
+	if got := strings.Join(drain(outCh), ""); !strings.Contains(got, "already in progress on mock") {
+		t.Fatalf("second run on the transport should be refused, got %q", got)
+	}
+	if again, _ := r.acquireRun(InboundMessage{Transport: "other", Sender: "bob"}, slog.Default()); again == nil {
+		t.Fatalf("another transport should have its own cap")
+	} else {
+		again()
+	}
+
+	close(release)
+	<-done
+	if again, _ := r.acquireRun(InboundMessage{Transport: "mock", Sender: "bob"}, slog.Default()); again == nil {
+		t.Fatalf("run should be allowed after release")
+	}
+}
+
+func TestConcurrentRunsLimitCapsSender(t *testing.T) {
+	r := &Runner{rateLimit: RateLimit{ConcurrentRuns: 1, TransportConcurrentRuns: 2}}
+	// Two threads are two conversations, so both could reach acquireRun at once.
+	first := InboundMessage{Transport: "mock", Sender: "alice", ThreadID: "t1"}
+	release, _ := r.acquireRun(first, slog.Default())
+	if release == nil {
+		t.Fatalf("first run should be allowed")
+	}
+	if again, text := r.acquireRun(InboundMessage{Transport: "mock", Sender: "Alice", ThreadID: "t2"}, slog.Default()); again != nil || !strings.Contains(text, "send /cancel") {
+		t.Fatalf("second run for the sender should be refused, got %q", text)
+	}
+	bob, _ := r.acquireRun(InboundMessage{Transport: "mock", Sender: "bob"}, slog.Default())
+	if bob == nil {
+		t.Fatalf("another sender should have its own cap")
+	}
+	// Both caps hold at once: the transport is now full for carol too.
+	if carol, text := r.acquireRun(InboundMessage{Transport: "mock", Sender: "carol"}, slog.Default()); carol != nil || !strings.Contains(text, "on mock") {
+		t.Fatalf("transport cap should refuse carol, got %q", text)
+	}
+	release()
+	bob()
+	if again, _ := r.acquireRun(InboundMessage{Transport: "mock", Sender: "alice", ThreadID: "t2"}, slog.Default()); again == nil {
+		t.Fatalf("run should be allowed after release")
+	}
+}
@@ -2,46 +2,137 @@ package core
 
 import (
 	"context"
+	"errors"
+	"io/fs"
 	"math/rand"
+	"net/http"
+	"os/exec"
 	"time"
 )
 
-// retry executes fn up to attempts with exponential backoff. It stops early on context cancellation.
-func retry(ctx context.Context, attempts int, fn func() error) error {
-	if attempts < 1 {
-		attempts = 1
-	}
-	for i := 0; i < attempts; i++ {
-		if err := fn(); err != nil {
-			if ctx.Err() != nil {
-				return err
-			}
-			if i == attempts-1 {
-				return err
-			}
-			delay := backoffDuration(i)
-			timer := time.NewTimer(delay)
-			select {
-			case <-ctx.Done():
-				timer.Stop()
-				return ctx.Err()
-			case <-timer.C:
-			}
-			continue
+// RetryPolicy controls inline retries of agent calls and sends.
+type RetryPolicy struct {
+	Attempts  int           // total tries, including the first
+	BaseDelay time.Duration // delay after the first failure; doubles per attempt
+	MaxDelay  time.Duration // cap on the delay
+	Jitter    float64       // random spread as a fraction of the delay, 0..1
+}
+
+var defaultRetryPolicy = RetryPolicy{Attempts: 3, BaseDelay: 100 * time.Millisecond, MaxDelay: 2 * time.Second, Jitter: 0.5}
+
+// WithRetryPolicy sets the retry policy for agent calls and sends. Zero
+// attempts or delays keep their defaults (3 attempts, 100ms doubling to 2s);
+// zero jitter means none.
+func WithRetryPolicy(p RetryPolicy) RunnerOption {
+	return func(r *Runner) { r.retryPolicy = p }
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.Attempts < 1 {
+		p.Attempts = defaultRetryPolicy.Attempts
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = defaultRetryPolicy.BaseDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = defaultRetryPolicy.MaxDelay
+	}
+	if p.Jitter < 0 {
+		p.Jitter = 0
+	}
+	if p.Jitter > 1 {
+		p.Jitter = 1
+	}
+	return p
+}
+
+// delay returns the wait after the given failed attempt (0-based).
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 0; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if spread := int64(float64(d) * p.Jitter); spread > 0 {
+		d += time.Duration(rand.Int63n(2*spread+1) - spread)
+	}
+	return d
+}
+
+// retry executes fn up to p.Attempts times with exponential backoff. It stops
+// early on context cancellation and on permanent errors.
+func retry(ctx context.Context, p RetryPolicy, fn func() error) error {
+	p = p.withDefaults()
+	for i := 0; ; i++ {
+		err := fn()
+		if err == nil {
+			return nil
 		}
+		if ctx.Err() != nil || IsPermanent(err) || i == p.Attempts-1 {
+			return err
+		}
+		timer := time.NewTimer(p.delay(i))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// permanentError marks a failure that will not go away on retry.
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// retryableError marks a failure worth retrying even if it looks permanent.
+type retryableError struct{ err error }
+
+func (e *retryableError) Error() string { return e.err.Error() }
+func (e *retryableError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying, e.g. an empty prompt or a
+// rejected recipient. Agents and transports return it so the runner fails
+// fast instead of retrying a deterministic failure.
+func Permanent(err error) error {
+	if err == nil {
 		return nil
 	}
-	return nil
+	return &permanentError{err: err}
+}
+
+// Retryable marks err as transient, overriding the default classification.
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &retryableError{err: err}
+}
+
+// IsPermanent reports whether err should not be retried. Errors marked with
+// Permanent or Retryable are classified by the outermost mark; unmarked errors
+// are retryable unless they come from a missing binary or file.
+func IsPermanent(err error) bool {
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		switch e.(type) {
+		case *permanentError:
+			return true
+		case *retryableError:
+			return false
+		}
+	}
+	return errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission)
 }
 
-func backoffDuration(attempt int) time.Duration {
-	// attempt 0 -> 100ms, then x2 with jitter, capped ~2s
-	base := 100 * time.Millisecond
-	d := base << attempt
-	if d > 2*time.Second {
-		d = 2 * time.Second
+// HTTPError classifies a failed HTTP response: client errors are permanent,
+// except timeouts (408) and rate limiting (429); everything else is retryable.
+func HTTPError(status int, err error) error {
+	if status >= 400 && status < 500 && status != http.StatusRequestTimeout && status != http.StatusTooManyRequests {
+		return Permanent(err)
 	}
-	// jitter +/- 50%
-	jitter := rand.Int63n(int64(d)) - int64(d)/2
-	return time.Duration(int64(d) + jitter)
+	return err
 }
@@ -3,19 +3,21 @@ package core
 import (
 	"context"
 	"errors"
+	"fmt"
+	"os/exec"
 	"testing"
 	"time"
 )
 
 func TestRetrySuccessFirst(t *testing.T) {
-	err := retry(context.Background(), 3, func() error { return nil })
+	err := retry(context.Background(), RetryPolicy{Attempts: 3}, func() error { return nil })
 	if err != nil {
 		t.Fatalf("unexpected err %v", err)
 	}
 }
 
 func TestRetryExhaust(t *testing.T) {
-	err := retry(context.Background(), 2, func() error { return errors.New("fail") })
+	err := retry(context.Background(), RetryPolicy{Attempts: 2}, func() error { return errors.New("fail") })
 	if err == nil {
 		t.Fatalf("expected error")
 	}
@@ -24,8 +26,49 @@ func TestRetryExhaust(t *testing.T) {
 func TestRetryCancel(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
 	defer cancel()
-	err := retry(ctx, 5, func() error { return errors.New("fail") })
+	err := retry(ctx, RetryPolicy{Attempts: 5}, func() error { return errors.New("fail") })
 	if err == nil {
 		t.Fatalf("expected error on cancel")
 	}
 }
+
+func TestRetryStopsOnPermanentError(t *testing.T) {
+	calls := 0
+	err := retry(context.Background(), RetryPolicy{Attempts: 5}, func() error {
+		calls++
+		return fmt.Errorf("codex: %w", Permanent(errors.New("prompt is empty")))
+	})
+	if calls != 1 || !IsPermanent(err) {
+		t.Fatalf("expected one call and a permanent error, got %d calls, %v", calls, err)
+	}
+}
+
+func TestErrorClassification(t *testing.T) {
+	cases := []struct {
+		err       error
+		permanent bool
+	}{
+		{errors.New("connection reset"), false},
+		{&exec.Error{Name: "codex", Err: exec.ErrNotFound}, true},
+		{Retryable(&exec.Error{Name: "codex", Err: exec.ErrNotFound}), false},
+		{HTTPError(400, errors.New("bad recipient")), true},
+		{HTTPError(429, errors.New("slow down")), false},
+		{HTTPError(503, errors.New("unavailable")), false},
+	}
+	for _, tc := range cases {
+		if got := IsPermanent(tc.err); got != tc.permanent {
+			t.Fatalf("IsPermanent(%v) = %v, want %v", tc.err, got, tc.permanent)
+		}
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second, Jitter: 0.2}.withDefaults()
+	for attempt, want := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		for i := 0; i < 20; i++ {
+			if d := p.delay(attempt); d < want*8/10 || d > want*12/10 {
+				t.Fatalf("attempt %d: delay %v outside %v ±20%%", attempt, d, want)
+			}
+		}
+	}
+}
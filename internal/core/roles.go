@@ -0,0 +1,172 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// Role limits what its senders may do. "*" in Actions or Commands allows
+// everything; otherwise only the listed names are allowed.
+type Role struct {
+	Name           string
+	Actions        []string // action names the agent may invoke for these senders
+	Commands       []string // slash commands without the slash, e.g. "shell", "use"
+	ShellAllowlist []string // command prefixes allowed for the shell action; empty defers to the action
+	Sandbox        string   // agent sandbox level, e.g. "read-only"; empty keeps the agent default
+}
+
+// alwaysAllowedCommands stay available to every role.
+var alwaysAllowedCommands = map[string]struct{}{"help": {}, "cancel": {}, "more": {}}
+
+// WithRoles assigns roles to senders (npub/hex pubkey, phone number or email
+// address). Senders without an entry get fallback; a nil fallback leaves them
+// unrestricted.
+func WithRoles(senders map[string]Role, fallback *Role) RunnerOption {
+	return func(r *Runner) {
+		r.roles = make(map[string]Role, len(senders))
+		for s, role := range senders {
+			r.roles[normalizeSender(s)] = role
+		}
+		r.defaultRole = fallback
+	}
+}
+
+// normalizeSender strips transport prefixes such as "whatsapp:" and lowercases.
+func normalizeSender(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	return strings.TrimPrefix(s, "whatsapp:")
+}
+
+// roleFor returns the sender's role, or nil when the sender is unrestricted. A
+// role given to the linked user ("user:<id>") wins over one given to the sender.
+func (r *Runner) roleFor(msg InboundMessage) *Role {
+	if role, ok := r.roles[r.principal(msg)]; ok {
+		return &role
+	}
+	if role, ok := r.roles[normalizeSender(msg.Sender)]; ok {
+		return &role
+	}
+	return r.defaultRole
+}
+
+func listAllows(list []string, name string) bool {
+	for _, n := range list {
+		if n == "*" || n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (role *Role) allowsAction(name string) bool {
+	return role == nil || listAllows(role.Actions, name)
+}
+
+func (role *Role) allowsCommand(name string) bool {
+	if role == nil {
+		return true
+	}
+	if _, ok := alwaysAllowedCommands[name]; ok {
+		return true
+	}
+	return listAllows(role.Commands, name)
+}
+
+// shellMetachars are refused in commands checked against a role allowlist: the
+// shell action runs them with bash, so they would let an allowed prefix chain,
+// pipe, substitute or redirect into something else.
+var shellMetachars = []string{";", "&", "|", "`", "$(", ">", "<", "\n", "\r"}
+
+// allowsShell checks a shell command line against the role's allowlist. The
+// command must be a single simple command whose leading words match an entry
+// word for word, so "git status" allows "git status -s" but not
+// "git statusx" or "git status; rm -rf ~".
+func (role *Role) allowsShell(command string) bool {
+	if role == nil || len(role.ShellAllowlist) == 0 {
+		return true
+	}
+	for _, m := range shellMetachars {
+		if strings.Contains(command, m) {
+			return false
+		}
+	}
+	words := strings.Fields(command)
+	for _, prefix := range role.ShellAllowlist {
+		if hasWordPrefix(words, strings.Fields(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasWordPrefix(words, prefix []string) bool {
+	if len(prefix) > len(words) {
+		return false
+	}
+	for i, w := range prefix {
+		if words[i] != w {
+			return false
+		}
+	}
+	return true
+}
+
+func (role *Role) name() string {
+	if role == nil {
+		return ""
+	}
+	return role.Name
+}
+
+func (role *Role) sandbox() string {
+	if role == nil {
+		return ""
+	}
+	return role.Sandbox
+}
+
+// authorizeAction applies the sender's role to an action call before it runs.
+// Denials are audited.
+func (r *Runner) authorizeAction(msg InboundMessage, call ActionCall, log *slog.Logger) error {
+	role := r.roleFor(msg)
+	if !role.allowsAction(call.Name) {
+		log.Warn("action denied by role", slog.String("action", call.Name), slog.String("role", role.name()))
+		r.logAudit(call.Name, r.principal(msg), "denied", 0)
+		return fmt.Errorf("action %s not allowed for role %s", call.Name, role.name())
+	}
+	if call.Name == "shell" && !role.allowsShell(shellCommand(call.Args)) {
+		log.Warn("shell command denied by role", slog.String("role", role.name()))
+		r.logAudit(call.Name, r.principal(msg), "denied", 0)
+		return errors.New("command not allowed for role " + role.name())
+	}
+	return nil
+}
+
+// authorizeCommand applies the sender's role to a slash command. Denials are
+// audited under the command name (e.g. "/use").
+func (r *Runner) authorizeCommand(msg InboundMessage, name string, log *slog.Logger) bool {
+	role := r.roleFor(msg)
+	if role.allowsCommand(name) {
+		return true
+	}
+	log.Warn("command denied by role", slog.String("command", name), slog.String("role", role.name()))
+	r.logAudit("/"+name, r.principal(msg), "denied", 0)
+	return false
+}
+
+// shellCommand extracts the command line from shell action args, which are
+// either {"command": "..."} or a bare JSON string.
+func shellCommand(args json.RawMessage) string {
+	var payload struct {
+		Command string `json:"command"`
+	}
+	if json.Unmarshal(args, &payload) == nil && payload.Command != "" {
+		return payload.Command
+	}
+	var s string
+	_ = json.Unmarshal(args, &s)
+	return s
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func newRoleRunner(agent Agent, act Action, audit *auditRecorder) (*Runner, chan OutboundMessage) {
+	viewer := Role{Name: "viewer", Actions: []string{"readfile"}, Commands: []string{"status"}, Sandbox: "read-only"}
+	ops := Role{Name: "ops", Actions: []string{"*"}, Commands: []string{"*"}, ShellAllowlist: []string{"git status"}}
+	r := NewRunner(nil, agent, []Action{act}, slog.Default(), WithAuditLogger(audit),
+		WithRoles(map[string]Role{"Viewer@example.com": viewer, "whatsapp:+15550001": ops}, nil))
+	outCh := make(chan OutboundMessage, 8)
+	r.transportMap = map[string]Transport{"mock": &transportSpy{out: outCh}}
+	return r, outCh
+}
+
+func TestRoleDeniesActionsAndCommands(t *testing.T) {
+	audit := &auditRecorder{}
+	act := &pipeAction{name: "shell"}
+	agent := &scriptedAgent{call: ActionCall{Name: "shell", Args: []byte(`{"command":"ls"}`)}}
+	r, outCh := newRoleRunner(agent, act, audit)
+
+	r.handleMessage(context.Background(), InboundMessage{Transport: "mock", Sender: "viewer@example.com", Text: "list files"})
+	if act.calls != 0 {
+		t.Fatalf("viewer must not reach the shell action")
+	}
+	if got := strings.Join(drain(outCh), ""); !strings.Contains(got, "not allowed for role viewer") {
+		t.Fatalf("expected role denial in reply, got %q", got)
+	}
+
+	r.handleMessage(context.Background(), InboundMessage{Transport: "mock", Sender: "viewer@example.com", Text: "/shell ls"})
+	if got := drain(outCh); len(got) != 1 || got[0] != "/shell is not allowed for your role." {
+		t.Fatalf("unexpected /shell reply %q", got)
+	}
+	if got := strings.Join(audit.snapshot(), ","); got != "shell:denied,/shell:denied" {
+		t.Fatalf("unexpected audit trail %s", got)
+	}
+}
+
+func TestRoleShellAllowlistAndSandbox(t *testing.T) {
+	audit := &auditRecorder{}
+	act := &pipeAction{name: "shell"}
+	r, outCh := newRoleRunner(&mockAgent{reply: "ok"}, act, audit)
+	ops := InboundMessage{Transport: "mock", Sender: "+15550001", Text: "/shell rm -rf /"}
+
+	r.handleMessage(context.Background(), ops)
+	if act.calls != 0 {
+		t.Fatalf("command outside the role allowlist ran")
+	}
+	if got := strings.Join(drain(outCh), ""); !strings.Contains(got, "not allowed for role ops") {
+		t.Fatalf("unexpected reply %q", got)
+	}
+	ops.Text = "/shell git status"
+	r.handleMessage(context.Background(), ops)
+	if act.calls != 1 {
+		t.Fatalf("allowlisted command did not run")
+	}
+	_ = drain(outCh)
+
+	agent := &mockAgent{reply: "ok"}
+	r.agent = agent
+	r.handleMessage(context.Background(), InboundMessage{Transport: "mock", Sender: "viewer@example.com", Text: "hi"})
+	if len(agent.calls) != 1 || agent.calls[0].Sandbox != "read-only" {
+		t.Fatalf("expected read-only sandbox in request, got %+v", agent.calls)
+	}
+	r.handleMessage(context.Background(), InboundMessage{Transport: "mock", Sender: "stranger", Text: "hi"})
+	if agent.calls[1].Sandbox != "" {
+		t.Fatalf("unlisted sender should keep the agent default")
+	}
+}
+
+func TestRoleShellAllowlistRejectsChaining(t *testing.T) {
+	role := &Role{ShellAllowlist: []string{"git status", "ls"}}
+	for cmd, want := range map[string]bool{
+		"git status":             true,
+		"  git   status -s ":     true,
+		"ls -la":                 true,
+		"git statusx":            false,
+		"lsof":                   false,
+		"git status; rm -rf ~":   false,
+		"git status && rm -rf ~": false,
+		"ls | sh":                false,
+		"ls `rm -rf ~`":          false,
+		"ls $(rm -rf ~)":         false,
+		"ls > /etc/passwd":       false,
+		"ls < /dev/zero":         false,
+		"ls & rm -rf ~":          false,
+		"ls\nrm -rf ~":           false,
+	} {
+		if got := role.allowsShell(cmd); got != want {
+			t.Errorf("allowsShell(%q) = %v, want %v", cmd, got, want)
+		}
+	}
+}
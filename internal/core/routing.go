@@ -0,0 +1,205 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/joelklabo/buddy/internal/store"
+)
+
+// PrefsStore persists per-conversation choices such as the /agent override.
+// store.Store satisfies it; WithStore picks it up automatically.
+type PrefsStore interface {
+	SenderPrefs(key store.Key) (store.SenderPrefs, bool, error)
+	SaveSenderPrefs(key store.Key, p store.SenderPrefs) error
+}
+
+// Route sends messages matching every non-empty field to the named agent.
+type Route struct {
+	Agent     string
+	Transport string // transport ID
+	Sender    string
+	Prefix    string // case-insensitive; stripped from the prompt
+	Project   string // the sender's active project ID
+}
+
+// WithAgents registers named agents and the routes that pick between them.
+// Routes are tried in order; unmatched messages go to the agent passed to
+// NewRunner, which is listed under defaultName.
+func WithAgents(defaultName string, agents map[string]Agent, routes []Route) RunnerOption {
+	return func(r *Runner) {
+		r.defaultAgent = defaultName
+		r.namedAgents = agents
+		r.routes = routes
+	}
+}
+
+// agentChoice is the agent picked for one message.
+type agentChoice struct {
+	name   string
+	agent  Agent
+	prefix string // route prefix to strip from the prompt
+	reason string // override, route or default
+}
+
+type agentChoiceKey struct{}
+
+func (rt Route) matches(msg InboundMessage, prompt, project string) bool {
+	if rt.Transport != "" && rt.Transport != msg.Transport {
+		return false
+	}
+	if rt.Sender != "" && normalizeSender(rt.Sender) != normalizeSender(msg.Sender) {
+		return false
+	}
+	if rt.Prefix != "" && !strings.HasPrefix(strings.ToLower(prompt), strings.ToLower(rt.Prefix)) {
+		return false
+	}
+	if rt.Project != "" && rt.Project != project {
+		return false
+	}
+	return true
+}
+
+// chooseAgent picks the agent for msg: the sender's /agent override, then the
+// first matching route, then the default agent.
+func (r *Runner) chooseAgent(msg InboundMessage, prompt string, log *slog.Logger) agentChoice {
+	def := agentChoice{name: r.defaultAgent, agent: r.agent, reason: "default"}
+	if len(r.namedAgents) == 0 {
+		return def
+	}
+	prefs := r.loadPrefs(msg, log)
+	if a, ok := r.namedAgents[prefs.Agent]; ok {
+		return agentChoice{name: prefs.Agent, agent: a, reason: "override"}
+	}
+	for _, rt := range r.routes {
+		if !rt.matches(msg, prompt, prefs.Project) {
+			continue
+		}
+		if a, ok := r.namedAgents[rt.Agent]; ok {
+			return agentChoice{name: rt.Agent, agent: a, prefix: rt.Prefix, reason: "route"}
+		}
+	}
+	return def
+}
+
+// strip removes the matched route prefix from prompt.
+func (c agentChoice) strip(prompt string) string {
+	if c.prefix == "" || len(prompt) < len(c.prefix) {
+		return prompt
+	}
+	return strings.TrimSpace(prompt[len(c.prefix):])
+}
+
+func agentChoiceFrom(ctx context.Context) agentChoice {
+	c, _ := ctx.Value(agentChoiceKey{}).(agentChoice)
+	return c
+}
+
+// agentFor returns the agent chosen for the run carried by ctx.
+func (r *Runner) agentFor(ctx context.Context) Agent {
+	if c := agentChoiceFrom(ctx); c.agent != nil {
+		return c.agent
+	}
+	return r.agent
+}
+
+// sessionKey scopes stored sessions per conversation (see sessionBase) and per
+// agent, since one agent cannot resume another's session. The default agent
+// keeps the bare conversation key.
+func (r *Runner) sessionKey(msg InboundMessage, agentName string) store.Key {
+	key := r.sessionBase(msg)
+	if agentName != r.defaultAgent {
+		key.Agent = agentName
+	}
+	return key
+}
+
+// sessionKeyFor is sessionKey for the run carried by ctx.
+func (r *Runner) sessionKeyFor(ctx context.Context, msg InboundMessage) store.Key {
+	return r.sessionKey(msg, agentChoiceFrom(ctx).name)
+}
+
+// prefsKey is where msg's /agent and /project choices live: with the session,
+// so under the thread scopes each thread keeps its own, else with the sender
+// or linked user.
+func (r *Runner) prefsKey(msg InboundMessage) store.Key {
+	if base := r.sessionBase(msg); base.Thread != "" {
+		return base
+	}
+	return r.senderKey(msg)
+}
+
+func (r *Runner) loadPrefs(msg InboundMessage, log *slog.Logger) store.SenderPrefs {
+	if r.prefsStore != nil {
+		p, _, err := r.prefsStore.SenderPrefs(r.prefsKey(msg))
+		if err != nil {
+			log.Warn("load sender prefs failed", slog.String("err", err.Error()))
+		}
+		return p
+	}
+	r.prefsMu.Lock()
+	defer r.prefsMu.Unlock()
+	return r.prefs[r.prefsKey(msg)]
+}
+
+func (r *Runner) savePrefs(msg InboundMessage, p store.SenderPrefs) error {
+	if r.prefsStore != nil {
+		return r.prefsStore.SaveSenderPrefs(r.prefsKey(msg), p)
+	}
+	r.prefsMu.Lock()
+	defer r.prefsMu.Unlock()
+	if r.prefs == nil {
+		r.prefs = map[store.Key]store.SenderPrefs{}
+	}
+	r.prefs[r.prefsKey(msg)] = p
+	return nil
+}
+
+// agentNames lists every selectable agent, sorted.
+func (r *Runner) agentNames() []string {
+	names := make([]string, 0, len(r.namedAgents))
+	for n := range r.namedAgents {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// handleAgentCommand implements /agent [name|auto].
+func (r *Runner) handleAgentCommand(ctx context.Context, msg InboundMessage, arg string, log *slog.Logger) {
+	reply := func(text string) { r.sendSimple(ctx, msg.Transport, msg.Sender, msg.ThreadID, text) }
+	if len(r.namedAgents) == 0 {
+		reply("Only one agent is configured.")
+		return
+	}
+	available := strings.Join(r.agentNames(), ", ")
+	name := strings.TrimSpace(arg)
+	prefs := r.loadPrefs(msg, log)
+	switch {
+	case name == "":
+		c := r.chooseAgent(msg, "", log)
+		reply(fmt.Sprintf("Agent: %s (%s). Available: %s. Use /agent <name> to switch or /agent auto for routing.", c.name, c.reason, available))
+		return
+	case strings.EqualFold(name, "auto"):
+		prefs.Agent = ""
+	default:
+		if _, ok := r.namedAgents[name]; !ok {
+			reply(fmt.Sprintf("Unknown agent %q. Available: %s", name, available))
+			return
+		}
+		prefs.Agent = name
+	}
+	if err := r.savePrefs(msg, prefs); err != nil {
+		log.Warn("save sender prefs failed", slog.String("err", err.Error()))
+		reply(fmt.Sprintf("Failed to switch agent: %v", err))
+		return
+	}
+	if prefs.Agent == "" {
+		reply("Agent routing restored.")
+		return
+	}
+	reply(fmt.Sprintf("Using agent %s for your messages. /agent auto restores routing.", prefs.Agent))
+}
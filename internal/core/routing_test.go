@@ -0,0 +1,96 @@
+package core
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func newRoutingRunner() (*Runner, *mockAgent, *mockAgent, chan OutboundMessage) {
+	coder := &mockAgent{reply: "patched"}
+	quick := &mockAgent{reply: "sunny"}
+	r := NewRunner(nil, coder, nil, slog.Default(),
+		WithAgents("coder", map[string]Agent{"coder": coder, "quick": quick}, []Route{
+			{Agent: "quick", Prefix: "?"},
+			{Agent: "quick", Transport: "sms"},
+		}))
+	outCh := make(chan OutboundMessage, 8)
+	r.transportMap = map[string]Transport{"mock": &transportSpy{out: outCh}}
+	return r, coder, quick, outCh
+}
+
+func TestRoutesPickAgent(t *testing.T) {
+	r, coder, quick, outCh := newRoutingRunner()
+	send := func(text string) {
+		r.handleMessage(context.Background(), InboundMessage{Transport: "mock", Sender: "alice", Text: text})
+	}
+
+	send("fix the flaky test")
+	send("? weather in Oakland")
+	if len(coder.calls) != 1 || len(quick.calls) != 1 {
+		t.Fatalf("expected one call each, coder=%d quick=%d", len(coder.calls), len(quick.calls))
+	}
+	if quick.calls[0].Prompt != "weather in Oakland" {
+		t.Fatalf("route prefix not stripped: %q", quick.calls[0].Prompt)
+	}
+	if got := drain(outCh); len(got) != 2 || got[1] != "sunny" {
+		t.Fatalf("unexpected replies %q", got)
+	}
+}
+
+func TestAgentCommandOverridesRoute(t *testing.T) {
+	r, coder, quick, outCh := newRoutingRunner()
+	send := func(text string) string {
+		r.handleMessage(context.Background(), InboundMessage{Transport: "mock", Sender: "alice", Text: text})
+		return strings.Join(drain(outCh), "\n")
+	}
+
+	if got := send("/agent nope"); !strings.Contains(got, `Unknown agent "nope". Available: coder, quick`) {
+		t.Fatalf("unexpected reply %q", got)
+	}
+	send("/agent quick")
+	send("fix the flaky test")
+	if len(quick.calls) != 1 || len(coder.calls) != 0 {
+		t.Fatalf("override ignored: coder=%d quick=%d", len(coder.calls), len(quick.calls))
+	}
+	if got := send("/status"); !strings.Contains(got, "Agent: quick (override)") {
+		t.Fatalf("status does not show active agent: %q", got)
+	}
+
+	send("/agent auto")
+	send("fix the flaky test")
+	if len(coder.calls) != 1 {
+		t.Fatalf("routing not restored")
+	}
+	if got := send("/status"); !strings.Contains(got, "Agent: coder (default)") {
+		t.Fatalf("unexpected status %q", got)
+	}
+}
+
+func TestAgentOverrideFollowsThreadScope(t *testing.T) {
+	r, coder, quick, outCh := newRoutingRunner()
+	r.sessionScope = ScopeSenderThread
+	send := func(thread, text string) {
+		r.handleMessage(context.Background(), InboundMessage{Transport: "mock", Sender: "alice", ThreadID: thread, Text: text})
+		drain(outCh)
+	}
+
+	send("t1", "/agent quick")
+	send("t1", "fix the flaky test")
+	send("t2", "fix the flaky test")
+	if len(quick.calls) != 1 || len(coder.calls) != 1 {
+		t.Fatalf("override leaked across threads: coder=%d quick=%d", len(coder.calls), len(quick.calls))
+	}
+}
+
+func TestSessionKeyPerAgent(t *testing.T) {
+	r, _, _, _ := newRoutingRunner()
+	msg := InboundMessage{Transport: "mock", Sender: "alice"}
+	if got := r.sessionKey(msg, "coder"); got != mockAlice {
+		t.Fatalf("default agent should keep the sender key, got %+v", got)
+	}
+	if got := r.sessionKey(msg, "quick"); got.String() != "mock/alice//quick" {
+		t.Fatalf("unexpected session key %q", got)
+	}
+}
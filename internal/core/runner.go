@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"math"
 	"strings"
 	"sync"
 	"time"
@@ -19,22 +20,89 @@ type Runner struct {
 	transports   []Transport
 	transportMap map[string]Transport
 	agent        Agent
+	defaultAgent string
+	namedAgents  map[string]Agent
+	fallbacks    map[string][]string
+	routes       []Route
+	projects     []Project
+	spool        *Spool
 	actions      map[string]Action
 	actionSpecs  []ActionSpec
 	logger       *slog.Logger
 
+	commands       *commands.Registry
+	actionCommands map[string]CommandAction // command name -> action, for /shell and friends
+	strictCommands bool
+
 	reqTimeout    time.Duration
 	actionTimeout time.Duration
 
 	allowedActions map[string]struct{}
 	allowedSenders map[string]struct{}
+	users          map[string]string // transport:sender -> user ID
+	roles          map[string]Role
+	defaultRole    *Role
 
 	auditStore AuditLogger
 
 	store          store.StoreAPI
+	history        HistoryStore
+	approvals      ApprovalStore
+	pager          PagerStore
+	inboundQueue   InboundQueue
+	outbox         Outbox
+	outboxPolicy   OutboxPolicy
+	approvalPolicy ApprovalPolicy
 	sessionTimeout time.Duration
 	initialPrompt  string
+
+	sessionScope    SessionScope
+	transportScopes map[string]SessionScope
+
 	maxReplyChars  int
+	maxReplyParts  int
+	maxSteps       int
+	maxConcurrency int
+
+	progressInterval  time.Duration
+	resumeInterrupted bool
+
+	transportLimits map[string]int
+
+	rateLimit           RateLimit
+	transportRateLimits map[string]RateLimit
+	limitStore          LimitStore
+	limitMu             sync.Mutex
+	limitStates         map[store.Key]store.LimitState // used when no LimitStore is configured
+	runsInFlight        map[string]int                 // by transport
+	senderRuns          map[store.Key]int
+
+	dedupe    DedupeStore
+	dedupeTTL time.Duration
+	dedupeMu  sync.Mutex
+	seen      map[string]time.Time // used when no DedupeStore is configured
+
+	prefsStore PrefsStore
+	prefsMu    sync.Mutex
+	prefs      map[store.Key]store.SenderPrefs // used when no PrefsStore is configured
+
+	inflightMu sync.Mutex
+	inflight   map[string]*inflightRun
+
+	retryPolicy   RetryPolicy
+	breakerPolicy BreakerPolicy
+	breakerMu     sync.Mutex
+	breakers      map[string]*breaker
+
+	restartPolicy   RestartPolicy
+	shutdownGrace   time.Duration
+	noticeCtx       context.Context // set by Start; bounds shutdown notices
+	transportMu     sync.Mutex
+	transportStates map[string]*TransportState
+
+	historyTurns     int
+	historyMaxChars  int
+	historyMaxTokens int
 }
 
 // AuditLogger records action executions.
@@ -78,9 +146,40 @@ func WithAuditLogger(a AuditLogger) RunnerOption {
 	return func(r *Runner) { r.auditStore = a }
 }
 
-// WithStore provides a store for session/cursor management.
+// WithStore provides a store for session/cursor management. Stores that also
+// implement HistoryStore, ApprovalStore, PagerStore, LimitStore, InboundQueue,
+// Outbox, PrefsStore or DedupeStore are used for conversation history, pending
+// approvals, /more paging, rate-limit usage, the durable inbound queue,
+// retrying failed sends, per-sender choices such as /agent and dropping
+// redelivered messages.
 func WithStore(st store.StoreAPI) RunnerOption {
-	return func(r *Runner) { r.store = st }
+	return func(r *Runner) {
+		r.store = st
+		if h, ok := st.(HistoryStore); ok {
+			r.history = h
+		}
+		if a, ok := st.(ApprovalStore); ok {
+			r.approvals = a
+		}
+		if p, ok := st.(PagerStore); ok {
+			r.pager = p
+		}
+		if l, ok := st.(LimitStore); ok {
+			r.limitStore = l
+		}
+		if q, ok := st.(InboundQueue); ok {
+			r.inboundQueue = q
+		}
+		if o, ok := st.(Outbox); ok {
+			r.outbox = o
+		}
+		if p, ok := st.(PrefsStore); ok {
+			r.prefsStore = p
+		}
+		if d, ok := st.(DedupeStore); ok {
+			r.dedupe = d
+		}
+	}
 }
 
 func WithSessionTimeout(d time.Duration) RunnerOption {
@@ -92,7 +191,8 @@ func WithInitialPrompt(p string) RunnerOption {
 	return func(r *Runner) { r.initialPrompt = p }
 }
 
-// WithMaxReplyChars limits reply text length.
+// WithMaxReplyChars limits the size of each outbound message; longer replies are
+// split into numbered parts.
 func WithMaxReplyChars(n int) RunnerOption {
 	return func(r *Runner) { r.maxReplyChars = n }
 }
@@ -119,18 +219,28 @@ func NewRunner(transports []Transport, agent Agent, actions []Action, logger *sl
 	}
 
 	r := &Runner{
-		transports:    transports,
-		transportMap:  tmap,
-		agent:         agent,
-		actions:       amap,
-		actionSpecs:   specs,
-		logger:        logger,
-		reqTimeout:    15 * time.Minute,
-		actionTimeout: 2 * time.Minute,
+		transports:       transports,
+		transportMap:     tmap,
+		agent:            agent,
+		actions:          amap,
+		actionSpecs:      specs,
+		logger:           logger,
+		reqTimeout:       15 * time.Minute,
+		actionTimeout:    2 * time.Minute,
+		historyTurns:     20,
+		maxReplyParts:    3,
+		progressInterval: 30 * time.Second,
+		maxSteps:         5,
+		maxConcurrency:   4,
+		retryPolicy:      defaultRetryPolicy,
+		restartPolicy:    RestartPolicy{BaseDelay: time.Second, MaxDelay: time.Minute},
+		shutdownGrace:    30 * time.Second,
+		dedupeTTL:        24 * time.Hour,
 	}
 	for _, opt := range opts {
 		opt(r)
 	}
+	r.buildCommands()
 	return r
 }
 
@@ -140,46 +250,86 @@ func (r *Runner) Transports() []Transport {
 }
 
 // Start launches transports and processes inbound messages until ctx is done.
+// Shutdown then runs in phases: transports stop, queued messages stay in the
+// durable queue, in-flight runs get the shutdown grace period to finish before
+// they are cancelled, their senders are told, and pending sends are flushed.
 func (r *Runner) Start(ctx context.Context) error {
-	inbound := make(chan InboundMessage, 128)
-	var wg sync.WaitGroup
-	errCh := make(chan error, len(r.transports))
+	// Unbuffered so a transport's hand-off returns only once the runner has taken
+	// the message; InboundMessage.Ack reports when it has been persisted.
+	inbound := make(chan InboundMessage)
+	var wg, transportsWG sync.WaitGroup
 
+	// A failing transport is restarted on its own; it never ends the runner.
 	for _, t := range r.transports {
-		wg.Add(1)
+		transportsWG.Add(1)
 		go func(tr Transport) {
-			defer wg.Done()
-			if err := tr.Start(ctx, inbound); err != nil {
-				errCh <- fmt.Errorf("transport %s: %w", tr.ID(), err)
-			}
+			defer transportsWG.Done()
+			r.superviseTransport(ctx, tr, inbound)
 		}(t)
 	}
+	stopped := make(chan struct{})
+	go func() {
+		transportsWG.Wait()
+		close(stopped)
+	}()
 
-	// Processor loop
+	// Runs outlive ctx by up to the grace period; shutdown notices get a little
+	// longer so senders of cancelled runs still hear about it.
+	runCtx, cancelRuns := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelRuns()
+	noticeCtx, cancelNotices := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelNotices()
+	r.noticeCtx = noticeCtx
+	d := newDispatcher(r.maxConcurrency, r.runKey, func(msg InboundMessage) {
+		if ctx.Err() != nil && r.parse(msg.Text).Name != "cancel" {
+			r.deferInbound(msg)
+			return
+		}
+		r.handleQueued(runCtx, msg)
+	})
+	r.recoverInbound(ctx, d)
+	wg.Add(2)
 	go func() {
-		<-ctx.Done()
-		close(inbound)
+		defer wg.Done()
+		r.runOutbox(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		r.runDedupePrune(ctx)
 	}()
 
-	for msg := range inbound {
-		metrics.IncInbound()
-		r.handleMessage(ctx, msg)
+	// Processor loop
+	for done := false; !done; {
+		select {
+		case msg := <-inbound:
+			metrics.IncInbound()
+			if r.duplicate(msg) {
+				r.markSeen(msg) // refresh, so long-lived redeliveries stay dropped
+				r.dropDuplicate(msg)
+				msg.ack(nil)
+				continue
+			}
+			if r.parse(msg.Text).Name == "cancel" {
+				// /cancel must not wait behind the run it is meant to stop.
+				r.markSeen(msg)
+				msg.ack(nil)
+				d.bypass(msg)
+				continue
+			}
+			d.submit(r.enqueueInbound(msg))
+		case <-stopped:
+			done = true
+		}
 	}
 
+	r.drain(d, cancelRuns, cancelNotices)
 	wg.Wait()
+	r.flushOnShutdown(ctx)
 
-	select {
-	case err := <-errCh:
-		if errors.Is(err, context.Canceled) {
-			return nil
-		}
-		return err
-	default:
-		if errors.Is(ctx.Err(), context.Canceled) {
-			return nil
-		}
-		return ctx.Err()
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return nil
 	}
+	return ctx.Err()
 }
 
 func (r *Runner) handleMessage(parent context.Context, msg InboundMessage) {
@@ -189,17 +339,32 @@ func (r *Runner) handleMessage(parent context.Context, msg InboundMessage) {
 		slog.String("thread", msg.ThreadID),
 	)
 
-	if !r.senderAllowed(log, msg.Sender) {
+	if !r.senderAllowed(log, msg) {
 		return
 	}
 
+	if r.parse(msg.Text).Name != "cancel" {
+		if wait, ok := r.allowMessage(msg, log); !ok {
+			r.rejectRate(msg, "messages", log)
+			r.sendSimple(parent, msg.Transport, msg.Sender, msg.ThreadID,
+				fmt.Sprintf("Rate limited, retry in %d s.", int(math.Ceil(wait.Seconds()))))
+			return
+		}
+	}
+
+	parent = r.withProject(parent, msg, log)
 	if r.handleCommand(parent, msg, log) {
 		return
 	}
 
-	cmd := commands.Parse(msg.Text)
-	prompt, sessionID := r.preparePrompt(cmd, msg.Sender)
-	if strings.TrimSpace(prompt) == "" {
+	cmd := r.parse(msg.Text)
+	choice := r.chooseAgent(msg, promptText(cmd), log)
+	prompt, sessionID := r.preparePrompt(cmd, r.sessionKey(msg, choice.name))
+	prompt = choice.strip(prompt)
+	if choice.name != "" {
+		log = log.With(slog.String("agent", choice.name))
+	}
+	if strings.TrimSpace(prompt) == "" && len(msg.Attachments) == 0 {
 		r.sendSimple(parent, msg.Transport, msg.Sender, msg.ThreadID, "No prompt detected. Send text or /help for commands.")
 		return
 	}
@@ -211,73 +376,73 @@ func (r *Runner) handleMessage(parent context.Context, msg InboundMessage) {
 		defer cancel()
 	}
 
+	release, rejection := r.acquireRun(msg, log)
+	if release == nil {
+		r.sendSimple(parent, msg.Transport, msg.Sender, msg.ThreadID, rejection)
+		return
+	}
+	defer release()
+
+	userPrompt := prompt
+	reqCtx, done := r.trackRun(reqCtx, msg, "agent run", userPrompt)
+	defer done()
+	reqCtx = context.WithValue(reqCtx, agentChoiceKey{}, choice)
+	reqCtx, unstage := WithAttachmentStaging(reqCtx)
+	defer unstage()
 	if sessionID == "" && strings.TrimSpace(r.initialPrompt) != "" {
 		prompt = r.initialPrompt + "\n\n" + prompt
 	}
 
+	workdir, _ := WorkdirFrom(reqCtx)
 	req := AgentRequest{
 		Prompt:     prompt,
-		History:    nil,
+		SessionID:  sessionID,
+		Sandbox:    r.roleFor(msg).sandbox(),
+		WorkingDir: workdir,
+		History:    r.loadHistory(msg, log),
 		Actions:    r.actionSpecs,
 		SenderMeta: msg.Meta,
+
+		Attachments: msg.Attachments,
 	}
 
 	start := time.Now()
-	resp, err := r.callAgentWithRetry(reqCtx, req, log)
+	progressCtx, stopProgress := r.withProgress(reqCtx, msg, log)
+	finalText, atts, err := r.runAgentLoop(progressCtx, msg, req, log)
+	stopProgress()
 	if err != nil {
-		log.Error("agent error", slog.String("err", err.Error()))
-		metrics.IncAgentError()
-		return
-	}
-	log.Info("agent reply", slog.Duration("ms", time.Since(start)))
-
-	// Execute actions if any
-	var actionResults []string
-	for _, call := range resp.ActionCalls {
-		if len(r.allowedActions) > 0 {
-			if _, ok := r.allowedActions[call.Name]; !ok {
-				log.Warn("action not allowed", slog.String("action", call.Name))
-				r.logAudit(call.Name, msg.Sender, "denied", 0)
-				continue
-			}
+		if runCancelled(reqCtx) {
+			log.Info("agent run cancelled", slog.Duration("ms", time.Since(start)))
+			r.logAudit("agent", r.principal(msg), "cancelled", time.Since(start))
+			return
 		}
-		act, ok := r.actions[call.Name]
-		if !ok {
-			log.Warn("unknown action", slog.String("action", call.Name))
-			continue
+		var open *CircuitOpenError
+		if errors.As(err, &open) {
+			log.Warn("agent circuit open", slog.String("agent", open.Agent))
+			r.sendSimple(parent, msg.Transport, msg.Sender, msg.ThreadID, circuitMessage(open))
+			return
 		}
-		aCtx := reqCtx
-		if r.actionTimeout > 0 {
-			var cancel context.CancelFunc
-			aCtx, cancel = context.WithTimeout(reqCtx, r.actionTimeout)
-			defer cancel()
-		}
-		aStart := time.Now()
-		out, err := act.Invoke(aCtx, call.Args)
-		if err != nil {
-			log.Error("action error", slog.String("action", call.Name), slog.String("err", err.Error()))
-			r.logAudit(call.Name, msg.Sender, "error", time.Since(aStart))
-			metrics.IncAction(call.Name, "error")
-			continue
-		}
-		log.Info("action ok", slog.String("action", call.Name), slog.Duration("ms", time.Since(aStart)))
-		r.logAudit(call.Name, msg.Sender, "ok", time.Since(aStart))
-		metrics.IncAction(call.Name, "ok")
-		if len(out) > 0 {
-			actionResults = append(actionResults, fmt.Sprintf("[%s]\n%s", call.Name, string(out)))
+		log.Error("agent error", slog.String("err", err.Error()), slog.Bool("permanent", IsPermanent(err)))
+		metrics.IncAgentError()
+		if parent.Err() == nil { // on shutdown the sender gets the shutdown notice instead
+			r.sendSimple(parent, msg.Transport, msg.Sender, msg.ThreadID, agentFailedMessage(err))
 		}
+		return
 	}
 
-	finalText := resp.Reply
-	if len(actionResults) > 0 {
-		finalText = finalText + "\n\n" + joinStrings(actionResults, "\n\n")
-	}
+	r.recordTurns(msg, log,
+		MessageTurn{Role: "user", Text: userPrompt},
+		MessageTurn{Role: "agent", Text: finalText},
+	)
 
 	outMsg := OutboundMessage{
 		Transport: msg.Transport,
 		Recipient: msg.Sender,
 		Text:      finalText,
 		ThreadID:  msg.ThreadID,
+		Meta:      msg.Meta,
+
+		Attachments: atts,
 	}
 
 	tr, ok := r.transportMap[msg.Transport]
@@ -285,7 +450,7 @@ func (r *Runner) handleMessage(parent context.Context, msg InboundMessage) {
 		log.Error("no transport for outbound", slog.String("transport", msg.Transport))
 		return
 	}
-	if err := r.sendWithRetry(reqCtx, tr, outMsg, log); err != nil {
+	if err := r.sendReply(reqCtx, tr, outMsg, log); err != nil {
 		log.Error("send error", slog.String("err", err.Error()))
 		metrics.IncSendError()
 	}
@@ -308,15 +473,27 @@ func joinStrings(parts []string, sep string) string {
 func (r *Runner) callAgentWithRetry(ctx context.Context, req AgentRequest, log *slog.Logger) (AgentResponse, error) {
 	var resp AgentResponse
 	var agentErr error
-	err := retry(ctx, 3, func() error {
+	agent := agentChoiceFrom(ctx).name
+	if agent == "" {
+		agent = "default"
+	}
+	if err := r.breakerAllow(agent); err != nil {
+		return resp, err
+	}
+	err := retry(ctx, r.retryPolicy, func() error {
 		var err error
-		resp, err = r.agent.Generate(ctx, req)
+		resp, err = r.generate(ctx, req)
 		if err != nil {
 			agentErr = err
 			log.Warn("agent retry", slog.String("err", err.Error()))
 		}
 		return err
 	})
+	if ctx.Err() == nil {
+		r.breakerRecord(agent, agentErr)
+	} else {
+		r.breakerRelease(agent)
+	}
 	if err != nil {
 		return resp, agentErr
 	}
@@ -325,7 +502,7 @@ func (r *Runner) callAgentWithRetry(ctx context.Context, req AgentRequest, log *
 
 func (r *Runner) sendWithRetry(ctx context.Context, tr Transport, msg OutboundMessage, log *slog.Logger) error {
 	var sendErr error
-	err := retry(ctx, 3, func() error {
+	err := retry(ctx, r.retryPolicy, func() error {
 		err := tr.Send(ctx, msg)
 		if err != nil {
 			sendErr = err
@@ -360,19 +537,20 @@ func (r *Runner) sendSimple(ctx context.Context, transportID, recipient, threadI
 	_ = tr.Send(ctx, msg)
 }
 
-func helpText() string {
-	return "Commands: /help, /status, /new [prompt], /use <session-id>, action commands (see below). Anything else runs as prompt."
-}
-
 func machineGreeting() string {
 	return "Starting fresh session."
 }
 
-func (r *Runner) senderAllowed(log *slog.Logger, sender string) bool {
+// senderAllowed applies the runner allowlist. Without one every sender the
+// transport let through is accepted; with one, linked users pass as well.
+func (r *Runner) senderAllowed(log *slog.Logger, msg InboundMessage) bool {
 	if len(r.allowedSenders) == 0 {
 		return true
 	}
-	if _, ok := r.allowedSenders[strings.ToLower(sender)]; ok {
+	if _, ok := r.allowedSenders[strings.ToLower(msg.Sender)]; ok {
+		return true
+	}
+	if r.userID(msg) != "" {
 		return true
 	}
 	log.Warn("sender not allowed")
@@ -380,88 +558,152 @@ func (r *Runner) senderAllowed(log *slog.Logger, sender string) bool {
 }
 
 func (r *Runner) handleCommand(ctx context.Context, msg InboundMessage, log *slog.Logger) bool {
-	cmd := commands.Parse(msg.Text)
+	cmd := r.parse(msg.Text)
+	if cmd.Name != "run" && !r.authorizeCommand(msg, cmd.Name, log) {
+		r.sendSimple(ctx, msg.Transport, msg.Sender, msg.ThreadID, fmt.Sprintf("/%s is not allowed for your role.", cmd.Name))
+		return true
+	}
+	if cmd.Err != "" {
+		r.sendSimple(ctx, msg.Transport, msg.Sender, msg.ThreadID, cmd.Err)
+		return true
+	}
+	if act, ok := r.actionCommands[cmd.Name]; ok {
+		r.runActionCommand(ctx, msg, act, cmd, log)
+		return true
+	}
 	switch cmd.Name {
 	case "help":
 		r.sendSimple(ctx, msg.Transport, msg.Sender, msg.ThreadID, r.renderHelp())
 		return true
 	case "status":
-		if r.store != nil {
-			if st, ok, _ := r.store.Active(msg.Sender); ok {
-				r.sendSimple(ctx, msg.Transport, msg.Sender, msg.ThreadID, fmt.Sprintf("Active session: %s (updated %s)", st.SessionID, st.UpdatedAt.Format(time.RFC3339)))
-			} else {
-				r.sendSimple(ctx, msg.Transport, msg.Sender, msg.ThreadID, "No active session. Send a prompt to start one or /new to reset.")
-			}
-			return true
+		if r.store == nil && len(r.namedAgents) == 0 && len(r.projects) == 0 {
+			return false
 		}
+		r.sendSimple(ctx, msg.Transport, msg.Sender, msg.ThreadID, r.statusText(msg, log))
+		return true
+	case "agent":
+		r.handleAgentCommand(ctx, msg, cmd.Args, log)
+		return true
+	case "project":
+		r.handleProjectCommand(ctx, msg, cmd.Args, log)
+		return true
+	case "projects":
+		r.handleProjectsCommand(ctx, msg, log)
+		return true
 	case "use":
 		if r.store == nil {
 			return false
 		}
-		if strings.TrimSpace(cmd.Args) == "" {
-			r.sendSimple(ctx, msg.Transport, msg.Sender, msg.ThreadID, "Usage: /use <session-id>")
-			return true
-		}
-		if err := r.store.SaveActive(msg.Sender, cmd.Args); err != nil {
+		id := cmd.Words[0]
+		key := r.sessionKey(msg, r.chooseAgent(msg, "", log).name)
+		if err := r.store.SaveActive(key, id); err != nil {
 			r.sendSimple(ctx, msg.Transport, msg.Sender, msg.ThreadID, fmt.Sprintf("Failed to set active session: %v", err))
 			return true
 		}
-		r.sendSimple(ctx, msg.Transport, msg.Sender, msg.ThreadID, fmt.Sprintf("Switched to session %s", cmd.Args))
+		r.sendSimple(ctx, msg.Transport, msg.Sender, msg.ThreadID, fmt.Sprintf("Switched to session %s", id))
 		return true
 	case "new":
-		if r.store != nil {
-			_ = r.store.ClearActive(msg.Sender)
+		r.clearSessions(msg)
+		if r.history != nil {
+			_ = r.history.ClearHistory(r.historyKey(msg))
 		}
 		r.sendSimple(ctx, msg.Transport, msg.Sender, msg.ThreadID, machineGreeting())
 		return cmd.Args == ""
-	case "shell":
-		if strings.TrimSpace(cmd.Args) == "" {
-			r.sendSimple(ctx, msg.Transport, msg.Sender, msg.ThreadID, "Usage: /shell <command> (requires shell action enabled)")
-			return true
-		}
-		if act, ok := r.actions["shell"]; ok {
-			payload := fmt.Sprintf(`{"command":%q}`, cmd.Args)
-			out, err := act.Invoke(ctx, []byte(payload))
-			if err != nil {
-				r.sendSimple(ctx, msg.Transport, msg.Sender, msg.ThreadID, fmt.Sprintf("shell error: %v", err))
-			} else {
-				r.sendSimple(ctx, msg.Transport, msg.Sender, msg.ThreadID, string(out))
-			}
+	case "more":
+		r.sendMore(ctx, msg, log)
+		return true
+	case "approve", "deny":
+		r.resolveApproval(ctx, msg, cmd.Name == "approve", cmd.Words[0], log)
+		return true
+	case "cancel":
+		if text, ok := r.cancelRun(msg); ok {
+			log.Info("run cancelled by sender")
+			r.sendSimple(ctx, msg.Transport, msg.Sender, msg.ThreadID, text)
 		} else {
-			r.sendSimple(ctx, msg.Transport, msg.Sender, msg.ThreadID, "shell action not available")
+			r.sendSimple(ctx, msg.Transport, msg.Sender, msg.ThreadID, "Nothing is running.")
 		}
 		return true
 	}
 	return false
 }
 
-func (r *Runner) preparePrompt(cmd commands.Command, sender string) (string, string) {
-	prompt := cmd.Args
+// promptText is the part of cmd sent to the agent.
+func promptText(cmd commands.Command) string {
 	if cmd.Name != "run" && cmd.Name != "new" && cmd.Name != "shell" {
-		prompt = cmd.Raw
+		return cmd.Raw
 	}
+	return cmd.Args
+}
 
-	sessionID := ""
-	if r.store != nil {
-		if st, ok, _ := r.store.Active(sender); ok {
-			if r.sessionTimeout > 0 && time.Since(st.UpdatedAt) > r.sessionTimeout {
-				_ = r.store.ClearActive(sender)
-			} else {
-				sessionID = st.SessionID
-			}
-		}
+// preparePrompt returns the prompt for cmd and the session stored under key.
+func (r *Runner) preparePrompt(cmd commands.Command, key store.Key) (string, string) {
+	return promptText(cmd), r.activeSession(key)
+}
+
+// activeSession returns the session stored under key, dropping it if it has
+// been idle longer than the session timeout.
+func (r *Runner) activeSession(key store.Key) string {
+	if r.store == nil {
+		return ""
+	}
+	st, ok, _ := r.store.Active(key)
+	if !ok {
+		return ""
 	}
-	return prompt, sessionID
+	if r.sessionTimeout > 0 && time.Since(st.UpdatedAt) > r.sessionTimeout {
+		_ = r.store.ClearActive(key)
+		return ""
+	}
+	return st.SessionID
 }
 
-func (r *Runner) renderHelp() string {
-	lines := []string{helpText()}
-	for _, spec := range r.actionSpecs {
-		if act, ok := r.actions[spec.Name]; ok {
-			if h := act.Help(); strings.TrimSpace(h) != "" {
-				lines = append(lines, h)
-			}
+// clearSessions drops the stored sessions of msg's conversation (the sender or
+// thread, depending on the session scope) for every agent.
+func (r *Runner) clearSessions(msg InboundMessage) {
+	if r.store == nil {
+		return
+	}
+	_ = r.store.ClearActive(r.sessionBase(msg))
+	for _, name := range r.agentNames() {
+		_ = r.store.ClearActive(r.sessionKey(msg, name))
+	}
+}
+
+// saveSession persists the session the agent used so the next message resumes it.
+// Agents that do not report a session keep the previous one alive.
+func (r *Runner) saveSession(key store.Key, previous, current string, log *slog.Logger) {
+	if r.store == nil {
+		return
+	}
+	sid := current
+	if sid == "" {
+		sid = previous
+	}
+	if sid == "" {
+		return
+	}
+	if err := r.store.SaveActive(key, sid); err != nil {
+		log.Warn("save session failed", slog.String("err", err.Error()))
+	}
+}
+
+// statusText describes the sender's session and, with named agents, the agent
+// their messages currently go to.
+func (r *Runner) statusText(msg InboundMessage, log *slog.Logger) string {
+	choice := r.chooseAgent(msg, "", log)
+	var lines []string
+	if r.store != nil {
+		if st, ok, _ := r.store.Active(r.sessionKey(msg, choice.name)); ok {
+			lines = append(lines, fmt.Sprintf("Active session: %s (updated %s)", st.SessionID, st.UpdatedAt.Format(time.RFC3339)))
+		} else {
+			lines = append(lines, "No active session. Send a prompt to start one or /new to reset.")
 		}
 	}
+	if len(r.namedAgents) > 0 {
+		lines = append(lines, fmt.Sprintf("Agent: %s (%s)", choice.name, choice.reason))
+	}
+	if p, ok := r.project(r.loadPrefs(msg, log).Project); ok {
+		lines = append(lines, fmt.Sprintf("Project: %s (%s)", p.ID, p.Path))
+	}
 	return strings.Join(lines, "\n")
 }
@@ -16,13 +16,13 @@ type memoryStoreWithTime struct{ memoryStore }
 func TestPreparePromptClearsExpiredSession(t *testing.T) {
 	st := &memoryStoreWithTime{}
 	old := time.Now().Add(-2 * time.Minute)
-	st.active = map[string]store.SessionState{"alice": {SessionID: "old", UpdatedAt: old}}
+	st.active = map[store.Key]store.SessionState{mockAlice: {SessionID: "old", UpdatedAt: old}}
 	r := NewRunner(nil, &mockAgent{reply: "hi"}, nil, slog.Default(), WithStore(st), WithSessionTimeout(time.Minute))
-	_, sess := r.preparePrompt(commands.Command{Name: "run", Args: "prompt", Raw: "prompt"}, "alice")
+	_, sess := r.preparePrompt(commands.Command{Name: "run", Args: "prompt", Raw: "prompt"}, mockAlice)
 	if sess != "" {
 		t.Fatalf("expected session to be cleared, got %s", sess)
 	}
-	if _, ok := st.active["alice"]; ok {
+	if _, ok := st.active[mockAlice]; ok {
 		t.Fatalf("session not cleared from store")
 	}
 }
@@ -45,3 +45,37 @@ func TestInitialPromptPrepended(t *testing.T) {
 		t.Fatalf("expected outbound message")
 	}
 }
+
+type sessionAgent struct {
+	calls []AgentRequest
+}
+
+func (s *sessionAgent) Generate(ctx context.Context, req AgentRequest) (AgentResponse, error) {
+	s.calls = append(s.calls, req)
+	return AgentResponse{Reply: "ok", SessionID: "sess-new"}, nil
+}
+
+func TestSessionPersistedAndResumed(t *testing.T) {
+	st := &memoryStore{}
+	ag := &sessionAgent{}
+	r := NewRunner(nil, ag, nil, slog.Default(), WithStore(st))
+	outCh := make(chan OutboundMessage, 2)
+	r.transportMap = map[string]Transport{"mock": &transportSpy{out: outCh}}
+
+	msg := InboundMessage{Transport: "mock", Sender: "alice", Text: "hello", ThreadID: "t"}
+	r.handleMessage(context.Background(), msg)
+	if got := st.active[mockAlice].SessionID; got != "sess-new" {
+		t.Fatalf("expected returned session persisted, got %q", got)
+	}
+
+	r.handleMessage(context.Background(), msg)
+	if len(ag.calls) != 2 {
+		t.Fatalf("expected 2 agent calls, got %d", len(ag.calls))
+	}
+	if ag.calls[0].SessionID != "" {
+		t.Fatalf("first call should start a new session, got %q", ag.calls[0].SessionID)
+	}
+	if ag.calls[1].SessionID != "sess-new" {
+		t.Fatalf("second call should resume session, got %q", ag.calls[1].SessionID)
+	}
+}
@@ -3,11 +3,13 @@ package core
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/joelklabo/buddy/internal/commands"
 	"github.com/joelklabo/buddy/internal/store"
 )
 
@@ -22,23 +24,36 @@ func (s *shellAction) Invoke(ctx context.Context, args json.RawMessage) (json.Ra
 	return json.RawMessage(`"ok"`), nil
 }
 
+func (s *shellAction) Command() commands.Spec {
+	return commands.Spec{Name: "shell", Usage: "<cmd>", Help: "mock shell", Bare: true, RawArgs: true}
+}
+
+func (s *shellAction) CommandArgs(cmd commands.Command) (json.RawMessage, error) {
+	if strings.TrimSpace(cmd.Args) == "" {
+		return nil, errors.New("Usage: /shell <command>")
+	}
+	return json.Marshal(map[string]string{"command": cmd.Args})
+}
+
 // mock store for status/use/new
-type memoryStore struct{ active map[string]store.SessionState }
+type memoryStore struct {
+	active map[store.Key]store.SessionState
+}
 
-func (m *memoryStore) Active(sender string) (store.SessionState, bool, error) {
+func (m *memoryStore) Active(sender store.Key) (store.SessionState, bool, error) {
 	if st, ok := m.active[sender]; ok {
 		return st, true, nil
 	}
 	return store.SessionState{}, false, nil
 }
-func (m *memoryStore) SaveActive(sender, sessionID string) error {
+func (m *memoryStore) SaveActive(sender store.Key, sessionID string) error {
 	if m.active == nil {
-		m.active = map[string]store.SessionState{}
+		m.active = map[store.Key]store.SessionState{}
 	}
 	m.active[sender] = store.SessionState{SessionID: sessionID, UpdatedAt: time.Now()}
 	return nil
 }
-func (m *memoryStore) ClearActive(sender string) error {
+func (m *memoryStore) ClearActive(sender store.Key) error {
 	delete(m.active, sender)
 	return nil
 }
@@ -49,13 +64,14 @@ func (m *memoryStore) AppendAudit(action, sender, outcome string, dur time.Durat
 }
 
 // extra methods to satisfy StoreAPI (no-ops for tests)
-func (m *memoryStore) LastCursor(pubkey string) (time.Time, error)   { return time.Time{}, nil }
-func (m *memoryStore) SaveCursor(pubkey string, ts time.Time) error  { return nil }
-func (m *memoryStore) AlreadyProcessed(eventID string) (bool, error) { return false, nil }
-func (m *memoryStore) MarkProcessed(eventID string) error            { return nil }
-func (m *memoryStore) RecentMessageSeen(pubkey, message string, window time.Duration) (bool, error) {
+func (m *memoryStore) LastCursor(pubkey store.Key) (time.Time, error)  { return time.Time{}, nil }
+func (m *memoryStore) SaveCursor(pubkey store.Key, ts time.Time) error { return nil }
+func (m *memoryStore) Processed(eventID string) (bool, error)          { return false, nil }
+func (m *memoryStore) MarkProcessed(eventID string) error              { return nil }
+func (m *memoryStore) MessageSeen(pubkey store.Key, message string, window time.Duration) (bool, error) {
 	return false, nil
 }
+func (m *memoryStore) RecordMessage(pubkey store.Key, message string) error { return nil }
 
 func TestRunnerHelpIncludesActionHelp(t *testing.T) {
 	act := &shellAction{}
@@ -77,8 +93,36 @@ func TestRunnerShellCommandInvokesAction(t *testing.T) {
 	}
 }
 
+func TestRunnerShellCommandUsesActionPolicy(t *testing.T) {
+	msg := InboundMessage{Transport: "mock", Sender: "alice", Text: "/shell ls", ThreadID: "t1"}
+
+	denied := &shellAction{}
+	audit := &auditRecorder{}
+	r := NewRunner(nil, &mockAgent{reply: "hi"}, []Action{denied}, slog.Default(), WithAuditLogger(audit), WithAllowedActions([]string{"other"}))
+	if out := captureSend(r, msg); !contains(out, "not allowed") {
+		t.Fatalf("expected allow-list refusal, got %q", out)
+	}
+	if denied.invoked {
+		t.Fatalf("shell ran despite the allow list")
+	}
+	if got := strings.Join(audit.snapshot(), ","); got != "shell:denied" {
+		t.Fatalf("unexpected audit trail %s", got)
+	}
+
+	allowed := &shellAction{}
+	audit = &auditRecorder{}
+	r = NewRunner(nil, &mockAgent{reply: "hi"}, []Action{allowed}, slog.Default(), WithAuditLogger(audit), WithAllowedActions([]string{"shell"}))
+	_ = captureSend(r, msg)
+	if !allowed.invoked {
+		t.Fatalf("shell action not invoked")
+	}
+	if got := strings.Join(audit.snapshot(), ","); got != "shell:ok" {
+		t.Fatalf("unexpected audit trail %s", got)
+	}
+}
+
 func TestRunnerStatusAndUse(t *testing.T) {
-	st := &memoryStore{active: map[string]store.SessionState{"alice": {SessionID: "sess1", UpdatedAt: time.Now()}}}
+	st := &memoryStore{active: map[store.Key]store.SessionState{mockAlice: {SessionID: "sess1", UpdatedAt: time.Now()}}}
 	r := NewRunner(nil, &mockAgent{reply: "hi"}, nil, slog.Default(), WithStore(st))
 	msg := InboundMessage{Transport: "mock", Sender: "alice", Text: "/status", ThreadID: "t1"}
 	out := captureSend(r, msg)
@@ -87,17 +131,17 @@ func TestRunnerStatusAndUse(t *testing.T) {
 	}
 	msg2 := InboundMessage{Transport: "mock", Sender: "alice", Text: "/use sess2", ThreadID: "t1"}
 	_ = captureSend(r, msg2)
-	if st.active["alice"].SessionID != "sess2" {
+	if st.active[mockAlice].SessionID != "sess2" {
 		t.Fatalf("use did not update active")
 	}
 }
 
 func TestRunnerNewClearsSession(t *testing.T) {
-	st := &memoryStore{active: map[string]store.SessionState{"alice": {SessionID: "sess1", UpdatedAt: time.Now()}}}
+	st := &memoryStore{active: map[store.Key]store.SessionState{mockAlice: {SessionID: "sess1", UpdatedAt: time.Now()}}}
 	r := NewRunner(nil, &mockAgent{reply: "hi"}, nil, slog.Default(), WithStore(st))
 	msg := InboundMessage{Transport: "mock", Sender: "alice", Text: "/new", ThreadID: "t1"}
 	_ = captureSend(r, msg)
-	if _, ok := st.active["alice"]; ok {
+	if _, ok := st.active[mockAlice]; ok {
 		t.Fatalf("expected active cleared")
 	}
 }
@@ -129,3 +173,32 @@ func (t *transportSpy) Send(ctx context.Context, msg OutboundMessage) error {
 	t.out <- msg
 	return nil
 }
+
+func TestRunnerCommandsRespectGrammar(t *testing.T) {
+	st := &memoryStore{}
+	r := NewRunner(nil, &mockAgent{reply: "hi"}, nil, slog.Default(), WithStore(st))
+	if out := captureSend(r, InboundMessage{Transport: "mock", Sender: "alice", Text: "/use a b"}); out != "too many arguments. Usage: /use <session-id>" {
+		t.Fatalf("unexpected usage reply %q", out)
+	}
+	if out := captureSend(r, InboundMessage{Transport: "mock", Sender: "alice", Text: "use the staging db"}); out != "" {
+		t.Fatalf("prose ran as /use: %q", out)
+	}
+	if _, ok := st.active[mockAlice]; ok {
+		t.Fatalf("prose changed the active session")
+	}
+}
+
+func TestRunnerStrictCommands(t *testing.T) {
+	st := &memoryStore{active: map[store.Key]store.SessionState{mockAlice: {SessionID: "sess1", UpdatedAt: time.Now()}}}
+	r := NewRunner(nil, &mockAgent{reply: "hi"}, []Action{&shellAction{}}, slog.Default(), WithStore(st), WithStrictCommands(true))
+	if out := captureSend(r, InboundMessage{Transport: "mock", Sender: "alice", Text: "status"}); out != "" {
+		t.Fatalf("bare status handled in strict mode: %q", out)
+	}
+	help := captureSend(r, InboundMessage{Transport: "mock", Sender: "alice", Text: "/help"})
+	if !contains(help, "/shell <cmd>") || contains(help, "without the slash") {
+		t.Fatalf("unexpected strict help %q", help)
+	}
+}
+
+// mockAlice is the session key of sender "alice" on the mock transport.
+var mockAlice = store.SenderKey("mock", "alice")
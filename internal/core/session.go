@@ -0,0 +1,68 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/joelklabo/buddy/internal/store"
+)
+
+// SessionScope decides which messages share an agent session.
+type SessionScope string
+
+const (
+	// ScopeSender gives each sender one session across all their threads.
+	ScopeSender SessionScope = "sender"
+	// ScopeThread gives each thread its own session, shared by everyone in it.
+	ScopeThread SessionScope = "thread"
+	// ScopeSenderThread gives each sender a separate session per thread.
+	ScopeSenderThread SessionScope = "sender+thread"
+)
+
+// ParseSessionScope validates a configured scope; empty means ScopeSender.
+func ParseSessionScope(s string) (SessionScope, error) {
+	switch SessionScope(strings.ToLower(strings.TrimSpace(s))) {
+	case "", ScopeSender:
+		return ScopeSender, nil
+	case ScopeThread:
+		return ScopeThread, nil
+	case ScopeSenderThread:
+		return ScopeSenderThread, nil
+	}
+	return "", fmt.Errorf("unknown session scope %q (want sender, thread or sender+thread)", s)
+}
+
+// WithSessionScope sets the session scope, optionally overridden per transport
+// ID (e.g. sender for WhatsApp, whose messages carry no stable thread).
+func WithSessionScope(scope SessionScope, perTransport map[string]SessionScope) RunnerOption {
+	return func(r *Runner) {
+		r.sessionScope = scope
+		r.transportScopes = perTransport
+	}
+}
+
+func (r *Runner) scopeFor(transport string) SessionScope {
+	if s, ok := r.transportScopes[transport]; ok && s != "" {
+		return s
+	}
+	if r.sessionScope == "" {
+		return ScopeSender
+	}
+	return r.sessionScope
+}
+
+// sessionBase is the store key of msg's conversation under the transport's
+// scope. Sender scope keys sessions by the sender on its transport, or by the
+// linked user; messages without a ThreadID fall back to that under every scope.
+func (r *Runner) sessionBase(msg InboundMessage) store.Key {
+	if msg.ThreadID == "" {
+		return r.ownerKey(msg)
+	}
+	switch r.scopeFor(msg.Transport) {
+	case ScopeThread:
+		return store.Key{Transport: msg.Transport, Thread: msg.ThreadID}
+	case ScopeSenderThread:
+		return store.Key{Transport: msg.Transport, Sender: r.principal(msg), Thread: msg.ThreadID}
+	}
+	return r.ownerKey(msg)
+}
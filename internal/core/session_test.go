@@ -0,0 +1,126 @@
+package core
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/joelklabo/buddy/internal/store"
+)
+
+// scopeAgent hands out a new session per request without one and records the
+// sessions it was asked to resume.
+type scopeAgent struct {
+	n       int
+	resumed []string
+}
+
+func (a *scopeAgent) Generate(ctx context.Context, req AgentRequest) (AgentResponse, error) {
+	a.resumed = append(a.resumed, req.SessionID)
+	if req.SessionID != "" {
+		return AgentResponse{Reply: "ok", SessionID: req.SessionID}, nil
+	}
+	a.n++
+	return AgentResponse{Reply: "ok", SessionID: string(rune('a' + a.n - 1))}, nil
+}
+
+func runScoped(t *testing.T, scope SessionScope, msgs ...InboundMessage) []string {
+	t.Helper()
+	agent := &scopeAgent{}
+	r := NewRunner(nil, agent, nil, slog.Default(), WithStore(&memoryStore{}), WithSessionScope(scope, nil))
+	outCh := make(chan OutboundMessage, len(msgs)+1)
+	r.transportMap = map[string]Transport{"mock": &transportSpy{out: outCh}}
+	for _, m := range msgs {
+		m.Transport = "mock"
+		r.handleMessage(context.Background(), m)
+	}
+	return agent.resumed
+}
+
+func TestSessionScopes(t *testing.T) {
+	msgs := []InboundMessage{
+		{Sender: "alice", ThreadID: "t1", Text: "one"},
+		{Sender: "alice", ThreadID: "t2", Text: "two"},
+		{Sender: "alice", ThreadID: "t1", Text: "three"},
+		{Sender: "bob", ThreadID: "t1", Text: "four"},
+	}
+	cases := []struct {
+		scope SessionScope
+		want  []string
+	}{
+		{ScopeSender, []string{"", "a", "a", ""}},
+		{ScopeThread, []string{"", "", "a", "a"}},
+		{ScopeSenderThread, []string{"", "", "a", ""}},
+	}
+	for _, tc := range cases {
+		got := runScoped(t, tc.scope, msgs...)
+		if len(got) != len(tc.want) {
+			t.Fatalf("%s: got %v", tc.scope, got)
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Fatalf("%s: resumed %v, want %v", tc.scope, got, tc.want)
+			}
+		}
+	}
+}
+
+func TestSessionScopePerTransportAndMissingThread(t *testing.T) {
+	r := NewRunner(nil, &mockAgent{}, nil, slog.Default(),
+		WithSessionScope(ScopeThread, map[string]SessionScope{"whatsapp": ScopeSender}))
+	if got := r.sessionBase(InboundMessage{Transport: "whatsapp", Sender: "+1", ThreadID: "SM1"}); got != store.SenderKey("whatsapp", "+1") {
+		t.Fatalf("transport override ignored: %+v", got)
+	}
+	if got := r.sessionBase(InboundMessage{Transport: "email", Sender: "a@x", ThreadID: "<m1>"}); got != (store.Key{Transport: "email", Thread: "<m1>"}) {
+		t.Fatalf("unexpected thread key %+v", got)
+	}
+	if got := r.sessionBase(InboundMessage{Transport: "email", Sender: "a@x"}); got != store.SenderKey("email", "a@x") {
+		t.Fatalf("message without thread should use the sender, got %+v", got)
+	}
+}
+
+func TestWhatsAppKeepsSenderConversationUnderThreadScope(t *testing.T) {
+	r := NewRunner(nil, &mockAgent{}, nil, slog.Default(), WithSessionScope(ScopeThread, nil))
+	// WhatsApp delivers each message with its own MessageSid and no ThreadID.
+	first := InboundMessage{Transport: "whatsapp", Sender: "+1", Text: "build it", MessageID: "SM1"}
+	second := InboundMessage{Transport: "whatsapp", Sender: "+1", Text: "/cancel", MessageID: "SM2"}
+	if r.sessionBase(first) != store.SenderKey("whatsapp", "+1") || r.sessionBase(first) != r.sessionBase(second) {
+		t.Fatalf("messages got separate sessions: %+v %+v", r.sessionBase(first), r.sessionBase(second))
+	}
+	if r.runKey(first) != r.runKey(second) {
+		t.Fatalf("messages got separate run keys, so they are not ordered")
+	}
+	ctx, done := r.trackRun(context.Background(), first, "agent", first.Text)
+	defer done()
+	if _, ok := r.cancelRun(second); !ok || ctx.Err() == nil {
+		t.Fatalf("/cancel did not find the running job")
+	}
+}
+
+func TestNewClearsOnlyCurrentThread(t *testing.T) {
+	st := &memoryStore{}
+	r := NewRunner(nil, &mockAgent{}, nil, slog.Default(), WithStore(st), WithSessionScope(ScopeSenderThread, nil))
+	t1 := InboundMessage{Transport: "mock", Sender: "alice", ThreadID: "t1"}
+	t2 := InboundMessage{Transport: "mock", Sender: "alice", ThreadID: "t2"}
+	_ = st.SaveActive(r.sessionBase(t1), "s1")
+	_ = st.SaveActive(r.sessionBase(t2), "s2")
+	r.clearSessions(t1)
+	if _, ok, _ := st.Active(r.sessionBase(t1)); ok {
+		t.Fatalf("t1 session not cleared")
+	}
+	if s, ok, _ := st.Active(r.sessionBase(t2)); !ok || s.SessionID != "s2" {
+		t.Fatalf("t2 session lost")
+	}
+}
+
+func TestParseSessionScope(t *testing.T) {
+	if s, err := ParseSessionScope(""); err != nil || s != ScopeSender {
+		t.Fatalf("default scope %q %v", s, err)
+	}
+	if s, err := ParseSessionScope("Sender+Thread"); err != nil || s != ScopeSenderThread {
+		t.Fatalf("parse %q %v", s, err)
+	}
+	if _, err := ParseSessionScope("channel"); err == nil {
+		t.Fatalf("expected error for unknown scope")
+	}
+}
@@ -0,0 +1,93 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// WithShutdownGrace sets how long in-flight runs may keep going once shutdown
+// starts before they are cancelled. Zero cancels them right away.
+func WithShutdownGrace(d time.Duration) RunnerOption {
+	return func(r *Runner) { r.shutdownGrace = d }
+}
+
+// shutdownSendTimeout bounds the shutdown notices sent after runs are cancelled,
+// and the final outbox flush.
+const shutdownSendTimeout = 10 * time.Second
+
+// drain waits for dispatched work to finish, cancelling in-flight runs through
+// cancelRuns if the grace period runs out first. Notices to the senders of those
+// runs then have shutdownSendTimeout before cancelNotices cuts them off.
+func (r *Runner) drain(d *dispatcher, cancelRuns, cancelNotices context.CancelFunc) {
+	idle := make(chan struct{})
+	go func() {
+		d.wait()
+		close(idle)
+	}()
+	select {
+	case <-idle:
+		return
+	default:
+	}
+	r.logger.Info("shutting down; waiting for in-flight runs", slog.Duration("grace", r.shutdownGrace))
+	timer := time.NewTimer(r.shutdownGrace)
+	defer timer.Stop()
+	select {
+	case <-idle:
+		return
+	case <-timer.C:
+	}
+	r.logger.Warn("shutdown grace period elapsed; cancelling in-flight runs")
+	cancelRuns()
+	cutoff := time.AfterFunc(shutdownSendTimeout, cancelNotices)
+	defer cutoff.Stop()
+	<-idle
+}
+
+// deferInbound handles a message that had not started when shutdown began.
+// Queued messages stay pending for the next start; others are bounced.
+func (r *Runner) deferInbound(msg InboundMessage) {
+	if msg.queueID != "" {
+		r.logger.Info("left message queued for next start", slog.String("transport", msg.Transport), slog.String("queue_id", msg.queueID))
+		return
+	}
+	r.shutdownNotice(msg, fmt.Sprintf("Shutting down before I got to %q. Resend it once I'm back.", snippet(msg.Text, 80)))
+}
+
+// notifyAborted tells the sender their run was cancelled by shutdown. Unless the
+// run will be resumed on the next start, it is removed from the queue so the
+// sender is not asked a second time by recoverInbound.
+func (r *Runner) notifyAborted(msg InboundMessage) {
+	text := fmt.Sprintf("Shutting down: stopped %q before it finished. Resend it once I'm back.", snippet(msg.Text, 80))
+	if msg.queueID != "" {
+		if r.resumeInterrupted {
+			text = fmt.Sprintf("Shutting down: stopped %q before it finished. I'll pick it up again after the restart.", snippet(msg.Text, 80))
+		} else if err := r.inboundQueue.CompleteInbound(msg.queueID); err != nil {
+			r.logger.Warn("complete inbound failed", slog.String("err", err.Error()))
+		}
+	}
+	r.shutdownNotice(msg, text)
+}
+
+func (r *Runner) shutdownNotice(msg InboundMessage, text string) {
+	parent := r.noticeCtx
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(parent, shutdownSendTimeout)
+	defer cancel()
+	r.sendSimple(ctx, msg.Transport, msg.Sender, msg.ThreadID, text)
+}
+
+// flushOnShutdown makes a last delivery attempt for everything in the outbox,
+// including entries not yet due, so replies cut off by shutdown still go out.
+func (r *Runner) flushOnShutdown(parent context.Context) {
+	if r.outbox == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(parent), shutdownSendTimeout)
+	defer cancel()
+	r.flushOutboxDue(ctx, time.Now().UTC().Add(r.outboxPolicy.MaxDelay))
+}
@@ -0,0 +1,76 @@
+package core
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// slowAgent replies after delay unless its context ends first.
+type slowAgent struct {
+	delay   time.Duration
+	started chan struct{}
+}
+
+func (s *slowAgent) Generate(ctx context.Context, req AgentRequest) (AgentResponse, error) {
+	close(s.started)
+	select {
+	case <-time.After(s.delay):
+		return AgentResponse{Reply: "done: " + req.Prompt}, nil
+	case <-ctx.Done():
+		return AgentResponse{}, ctx.Err()
+	}
+}
+
+func startAndShutDown(t *testing.T, ag *slowAgent, grace time.Duration) []OutboundMessage {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tr := &mockTransport{id: "mock"}
+	r := NewRunner([]Transport{tr}, ag, nil, nil, WithShutdownGrace(grace))
+	done := make(chan struct{})
+	go func() {
+		_ = r.Start(ctx)
+		close(done)
+	}()
+
+	inCh := waitForChannel(t, tr.inboundChan)
+	inCh <- InboundMessage{Transport: "mock", Sender: "alice", Text: "fix the build", ThreadID: "t"}
+	select {
+	case <-ag.started:
+	case <-time.After(time.Second):
+		t.Fatal("agent never started")
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("runner did not shut down")
+	}
+	return tr.sentMessages()
+}
+
+func TestShutdownLetsRunFinishWithinGrace(t *testing.T) {
+	sent := startAndShutDown(t, &slowAgent{delay: 50 * time.Millisecond, started: make(chan struct{})}, time.Second)
+	if len(sent) != 1 || sent[0].Text != "done: fix the build" {
+		t.Fatalf("expected reply delivered during shutdown, got %+v", sent)
+	}
+}
+
+func TestShutdownCancelsRunAfterGraceAndNotifies(t *testing.T) {
+	sent := startAndShutDown(t, &slowAgent{delay: time.Minute, started: make(chan struct{})}, 20*time.Millisecond)
+	var notice string
+	for _, m := range sent {
+		if strings.HasPrefix(m.Text, "Shutting down") {
+			notice = m.Text
+		}
+	}
+	if !strings.Contains(notice, `stopped "fix the build" before it finished`) {
+		t.Fatalf("sender not told about aborted run: %+v", sent)
+	}
+	if len(sent) != 1 {
+		t.Fatalf("expected only the shutdown notice, got %+v", sent)
+	}
+}
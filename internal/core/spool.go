@@ -0,0 +1,500 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/joelklabo/buddy/internal/store"
+)
+
+// ErrAttachmentTooLarge is returned by Spool.Save when a file exceeds the
+// per-file limit.
+var ErrAttachmentTooLarge = Permanent(errors.New("attachment too large"))
+
+// Spool stores attachment files on disk. Each file lives in its own
+// subdirectory under its original (sanitized) name. When the total size exceeds
+// the cap, the oldest files are removed, except those still in use. A nil
+// Spool rejects every file.
+type Spool struct {
+	dir      string
+	maxTotal int64
+	maxFile  int64
+
+	mu    sync.Mutex
+	inUse func() (map[string]bool, error) // paths trim must keep
+}
+
+// NewSpool creates dir if needed. maxTotal caps the spool size and maxFile a
+// single file; zero or negative means no limit.
+func NewSpool(dir string, maxTotal, maxFile int64) (*Spool, error) {
+	if dir == "" {
+		return nil, errors.New("spool dir required")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	// Paths are compared with resolved ones when trimming and when checking
+	// agent attachments, so the spool keeps its own resolved.
+	if real, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = real
+	}
+	return &Spool{dir: dir, maxTotal: maxTotal, maxFile: maxFile}, nil
+}
+
+// WithSpool tells the runner where inbound attachments are stored. Files an
+// agent sends back must lie in the spool or the run's working directory, and
+// the spool keeps files that queued messages still refer to.
+func WithSpool(s *Spool) RunnerOption {
+	return func(r *Runner) {
+		r.spool = s
+		if s != nil {
+			s.mu.Lock()
+			s.inUse = r.queuedAttachments
+			s.mu.Unlock()
+		}
+	}
+}
+
+// queuedAttachments reports the files that queued inbound messages and outbox
+// entries refer to.
+func (r *Runner) queuedAttachments() (map[string]bool, error) {
+	paths := map[string]bool{}
+	if r.inboundQueue != nil {
+		msgs, err := r.inboundQueue.PendingInbound()
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range msgs {
+			for _, a := range m.Attachments {
+				paths[a.Path] = true
+			}
+		}
+	}
+	if r.outbox != nil {
+		entries, err := r.outbox.PendingOutbox()
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			for _, a := range e.Attachments {
+				paths[a.Path] = true
+			}
+		}
+	}
+	return paths, nil
+}
+
+// Dir returns the spool directory.
+func (s *Spool) Dir() string {
+	if s == nil {
+		return ""
+	}
+	return s.dir
+}
+
+// Save copies r into the spool and returns the stored attachment. An empty
+// mimeType is guessed from the name, then from the content.
+func (s *Spool) Save(name, mimeType string, r io.Reader) (Attachment, error) {
+	if s == nil {
+		return Attachment{}, errors.New("attachments are disabled")
+	}
+	sub, err := os.MkdirTemp(s.dir, "att-")
+	if err != nil {
+		return Attachment{}, err
+	}
+	att, err := s.save(sub, attachmentName(name), mimeType, r)
+	if err != nil {
+		_ = os.RemoveAll(sub)
+	}
+	return att, err
+}
+
+// SaveAs is Save into a directory named after key, such as the provider's
+// message ID, so a redelivered message finds its files with Saved instead of
+// fetching them again.
+func (s *Spool) SaveAs(key, name, mimeType string, r io.Reader) (Attachment, error) {
+	if s == nil {
+		return Attachment{}, errors.New("attachments are disabled")
+	}
+	sub := s.keyDir(key)
+	if err := os.MkdirAll(sub, 0o700); err != nil {
+		return Attachment{}, err
+	}
+	return s.save(sub, attachmentName(name), mimeType, r)
+}
+
+// Saved returns the file stored by SaveAs under key and name, if it exists.
+func (s *Spool) Saved(key, name, mimeType string) (Attachment, bool) {
+	if s == nil {
+		return Attachment{}, false
+	}
+	path := filepath.Join(s.keyDir(key), attachmentName(name))
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return Attachment{}, false
+	}
+	if mimeType == "" {
+		mimeType = sniffMIME(path)
+	}
+	return Attachment{Name: filepath.Base(path), MIMEType: mimeType, Size: info.Size(), Path: path}, true
+}
+
+func (s *Spool) keyDir(key string) string {
+	return filepath.Join(s.dir, "msg-"+attachmentName(key))
+}
+
+// save writes r to sub/name through a temporary file, so Saved never sees a
+// partial download.
+func (s *Spool) save(sub, name, mimeType string, r io.Reader) (Attachment, error) {
+	f, err := os.CreateTemp(sub, ".part-")
+	if err != nil {
+		return Attachment{}, err
+	}
+	tmp := f.Name()
+	src := r
+	if s.maxFile > 0 {
+		src = io.LimitReader(r, s.maxFile+1)
+	}
+	n, err := io.Copy(f, src)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && s.maxFile > 0 && n > s.maxFile {
+		err = fmt.Errorf("%w: %s exceeds %d bytes", ErrAttachmentTooLarge, name, s.maxFile)
+	}
+	path := filepath.Join(sub, name)
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return Attachment{}, err
+	}
+	if mimeType == "" {
+		mimeType = sniffMIME(path)
+	}
+	s.trim(sub)
+	return Attachment{Name: name, MIMEType: mimeType, Size: n, Path: path}, nil
+}
+
+// trim removes the oldest entries until the spool fits maxTotal. keep and
+// entries holding files still in use are never removed.
+func (s *Spool) trim(keep string) {
+	if s.maxTotal <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	type entry struct {
+		path string
+		size int64
+		mod  int64
+	}
+	dirs, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+	var entries []entry
+	var total int64
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		e := entry{path: filepath.Join(s.dir, d.Name())}
+		_ = filepath.WalkDir(e.path, func(_ string, fd os.DirEntry, err error) error {
+			if err != nil || fd.IsDir() {
+				return nil
+			}
+			if info, err := fd.Info(); err == nil {
+				e.size += info.Size()
+				e.mod = max(e.mod, info.ModTime().UnixNano())
+			}
+			return nil
+		})
+		total += e.size
+		entries = append(entries, e)
+	}
+	if total <= s.maxTotal {
+		return
+	}
+	held := map[string]bool{keep: true}
+	if s.inUse != nil {
+		paths, err := s.inUse()
+		if err != nil {
+			return // better over the cap than losing a queued message's files
+		}
+		for p := range paths {
+			held[filepath.Dir(p)] = true
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].mod < entries[j].mod })
+	for _, e := range entries {
+		if total <= s.maxTotal {
+			return
+		}
+		if held[e.path] {
+			continue
+		}
+		if os.RemoveAll(e.path) == nil {
+			total -= e.size
+		}
+	}
+}
+
+// agentAttachments keeps the files an agent returned that resolve, symlinks
+// followed, to a regular file in the spool or the run's working directory.
+// Anything else is dropped so an agent cannot send arbitrary host files.
+func (r *Runner) agentAttachments(ctx context.Context, atts []Attachment, log *slog.Logger) []Attachment {
+	if len(atts) == 0 {
+		return nil
+	}
+	workdir, _ := WorkdirFrom(ctx)
+	roots := []string{r.spool.Dir(), workdir}
+	kept := make([]Attachment, 0, len(atts))
+	for _, a := range atts {
+		path := a.Path
+		if !filepath.IsAbs(path) && workdir != "" {
+			path = filepath.Join(workdir, path)
+		}
+		real, err := containedFile(path, roots)
+		if err != nil {
+			log.Warn("dropping agent attachment", slog.String("path", a.Path), slog.String("err", err.Error()))
+			continue
+		}
+		a.Path = real
+		kept = append(kept, a)
+	}
+	return kept
+}
+
+// containedFile resolves path and returns it if it is a regular file under one
+// of roots; empty roots are ignored.
+func containedFile(path string, roots []string) (string, error) {
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	if real, err = filepath.Abs(real); err != nil {
+		return "", err
+	}
+	info, err := os.Stat(real)
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", errors.New("not a regular file")
+	}
+	for _, root := range roots {
+		if root == "" {
+			continue
+		}
+		dir, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			continue
+		}
+		if dir, err = filepath.Abs(dir); err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(dir, real); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return real, nil
+		}
+	}
+	return "", errors.New("outside the spool and working directory")
+}
+
+// attachmentName reduces name to a safe base file name.
+func attachmentName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '/' || r == ':' {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.TrimLeft(strings.TrimSpace(name), ".")
+	if name == "" {
+		return "attachment"
+	}
+	if len(name) > 128 {
+		ext := filepath.Ext(name)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		name = name[:128-len(ext)] + ext
+	}
+	return name
+}
+
+func sniffMIME(path string) string {
+	if t := mime.TypeByExtension(filepath.Ext(path)); t != "" {
+		return t
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "application/octet-stream"
+	}
+	defer func() { _ = f.Close() }()
+	buf := make([]byte, 512)
+	n, _ := io.ReadFull(f, buf)
+	return http.DetectContentType(buf[:n])
+}
+
+type stagingKey struct{}
+
+// staging holds the attachment copies made for one message, per working
+// directory, so retries, loop steps and fallback agents reuse them.
+type staging struct {
+	mu     sync.Mutex
+	dirs   []string                // run directories to remove
+	staged map[string][]Attachment // working dir -> copies
+}
+
+// WithAttachmentStaging makes StageAttachments calls under the returned context
+// share one set of copies. The runner sets it up per message; cleanup removes
+// the copies once the run has ended.
+func WithAttachmentStaging(ctx context.Context) (context.Context, func()) {
+	st := &staging{staged: map[string][]Attachment{}}
+	return context.WithValue(ctx, stagingKey{}, st), func() {
+		st.mu.Lock()
+		defer st.mu.Unlock()
+		for _, d := range st.dirs {
+			_ = os.RemoveAll(d)
+		}
+		st.dirs, st.staged = nil, map[string][]Attachment{}
+	}
+}
+
+// StageAttachments copies atts into a per-run directory under
+// dir/.buddy/attachments so agents confined to their working directory can read
+// them, and returns the staged copies. Under WithAttachmentStaging the copies
+// are made once per dir and reused; without it every call makes new copies that
+// are left behind. A .gitignore keeps .buddy out of version control.
+func StageAttachments(ctx context.Context, dir string, atts []Attachment) ([]Attachment, error) {
+	if len(atts) == 0 {
+		return nil, nil
+	}
+	st, _ := ctx.Value(stagingKey{}).(*staging)
+	if st == nil {
+		st = &staging{staged: map[string][]Attachment{}}
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if staged, ok := st.staged[dir]; ok {
+		return staged, nil
+	}
+	root := filepath.Join(dir, ".buddy")
+	if err := os.MkdirAll(filepath.Join(root, "attachments"), 0o700); err != nil {
+		return nil, err
+	}
+	ignore := filepath.Join(root, ".gitignore")
+	if _, err := os.Stat(ignore); errors.Is(err, os.ErrNotExist) {
+		if err := os.WriteFile(ignore, []byte("*\n"), 0o600); err != nil {
+			return nil, err
+		}
+	}
+	dest, err := os.MkdirTemp(filepath.Join(root, "attachments"), "run-")
+	if err != nil {
+		return nil, err
+	}
+	st.dirs = append(st.dirs, dest)
+	staged := make([]Attachment, 0, len(atts))
+	for _, a := range atts {
+		path, err := copyUnique(a.Path, dest, attachmentName(a.Name))
+		if err != nil {
+			return staged, fmt.Errorf("stage %s: %w", a.Name, err)
+		}
+		a.Path = path
+		staged = append(staged, a)
+	}
+	st.staged[dir] = staged
+	return staged, nil
+}
+
+// copyUnique copies src into dir as name, adding a numeric suffix if a file of
+// that name already exists.
+func copyUnique(src, dir, name string) (string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = in.Close() }()
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for i := 0; ; i++ {
+		path := filepath.Join(dir, name)
+		if i > 0 {
+			path = filepath.Join(dir, fmt.Sprintf("%s-%d%s", stem, i, ext))
+		}
+		out, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o600)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(out, in)
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			_ = os.Remove(path)
+			return "", err
+		}
+		return path, nil
+	}
+}
+
+// AttachmentsPrompt describes atts for agents that take a plain-text prompt.
+func AttachmentsPrompt(atts []Attachment) string {
+	if len(atts) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\n\nAttached files:")
+	for _, a := range atts {
+		fmt.Fprintf(&b, "\n- %s (%s, %d bytes): %s", a.Name, a.MIMEType, a.Size, a.Path)
+	}
+	return b.String()
+}
+
+func toStoreAttachments(atts []Attachment) []store.Attachment {
+	if len(atts) == 0 {
+		return nil
+	}
+	out := make([]store.Attachment, len(atts))
+	for i, a := range atts {
+		out[i] = store.Attachment(a)
+	}
+	return out
+}
+
+func fromStoreAttachments(atts []store.Attachment) []Attachment {
+	if len(atts) == 0 {
+		return nil
+	}
+	out := make([]Attachment, len(atts))
+	for i, a := range atts {
+		out[i] = Attachment(a)
+	}
+	return out
+}
+
+// attachmentNames is the text shown in place of attachments on transports that
+// cannot send files.
+func attachmentNames(atts []Attachment) string {
+	names := make([]string, 0, len(atts))
+	for _, a := range atts {
+		names = append(names, a.Name)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,258 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joelklabo/buddy/internal/store"
+)
+
+func TestSpoolSaveSanitizesAndSniffs(t *testing.T) {
+	s, err := NewSpool(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatalf("new spool: %v", err)
+	}
+	att, err := s.Save("../../etc/passwd", "", strings.NewReader("%PDF-1.4 body"))
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if att.Name != "passwd" || filepath.Dir(filepath.Dir(att.Path)) != s.Dir() {
+		t.Fatalf("name not confined to the spool: %+v", att)
+	}
+	if att.MIMEType != "application/pdf" || att.Size != 13 {
+		t.Fatalf("unexpected attachment %+v", att)
+	}
+	if named, _ := s.Save("notes.txt", "", strings.NewReader("x")); !strings.HasPrefix(named.MIMEType, "text/plain") {
+		t.Fatalf("expected MIME type from extension, got %q", named.MIMEType)
+	}
+}
+
+func TestSpoolRejectsLargeFiles(t *testing.T) {
+	s, _ := NewSpool(t.TempDir(), 0, 4)
+	if _, err := s.Save("big.bin", "", strings.NewReader("12345")); !errors.Is(err, ErrAttachmentTooLarge) {
+		t.Fatalf("expected ErrAttachmentTooLarge, got %v", err)
+	}
+	if entries, _ := os.ReadDir(s.Dir()); len(entries) != 0 {
+		t.Fatalf("rejected file left in spool: %d entries", len(entries))
+	}
+}
+
+func TestSpoolEvictsOldestBeyondCap(t *testing.T) {
+	s, _ := NewSpool(t.TempDir(), 10, 0)
+	first, _ := s.Save("a.txt", "", strings.NewReader("123456"))
+	old := time.Now().Add(-time.Hour)
+	_ = os.Chtimes(first.Path, old, old)
+	second, err := s.Save("b.txt", "", strings.NewReader("abcdef"))
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if _, err := os.Stat(first.Path); !os.IsNotExist(err) {
+		t.Fatalf("oldest file not evicted: %v", err)
+	}
+	if _, err := os.Stat(second.Path); err != nil {
+		t.Fatalf("new file evicted: %v", err)
+	}
+}
+
+func TestSpoolKeepsQueuedFiles(t *testing.T) {
+	s, _ := NewSpool(t.TempDir(), 10, 0)
+	queued, _ := s.Save("in.txt", "", strings.NewReader("1234"))
+	pending, _ := s.Save("out.txt", "", strings.NewReader("5678"))
+	loose, _ := s.Save("loose.txt", "", strings.NewReader("90"))
+	for i, a := range []Attachment{loose, queued, pending} {
+		old := time.Now().Add(-time.Duration(3-i) * time.Hour)
+		_ = os.Chtimes(a.Path, old, old)
+	}
+	st := &queueOutboxStore{}
+	_, _ = st.EnqueueInbound(store.QueuedMessage{Attachments: toStoreAttachments([]Attachment{queued})})
+	_, _ = st.EnqueueOutbox(store.OutboxEntry{Attachments: toStoreAttachments([]Attachment{pending})})
+	NewRunner(nil, &mockAgent{}, nil, slog.Default(), WithStore(st), WithSpool(s))
+
+	fresh, err := s.Save("new.txt", "", strings.NewReader("abcdef"))
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	for _, a := range []Attachment{queued, pending, fresh} {
+		if _, err := os.Stat(a.Path); err != nil {
+			t.Fatalf("%s evicted: %v", a.Name, err)
+		}
+	}
+	if _, err := os.Stat(loose.Path); !os.IsNotExist(err) {
+		t.Fatalf("unreferenced file not evicted: %v", err)
+	}
+}
+
+func TestSpoolSaveAsIsFoundAgain(t *testing.T) {
+	s, _ := NewSpool(t.TempDir(), 0, 0)
+	if _, ok := s.Saved("SM1", "SM1-0.png", ""); ok {
+		t.Fatalf("nothing saved yet")
+	}
+	a, err := s.SaveAs("SM1", "SM1-0.png", "image/png", strings.NewReader("png"))
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	got, ok := s.Saved("SM1", "SM1-0.png", "image/png")
+	if !ok || got != a {
+		t.Fatalf("saved file not found: %+v, want %+v", got, a)
+	}
+}
+
+func TestNilSpoolRejects(t *testing.T) {
+	var s *Spool
+	if _, err := s.Save("a.txt", "", strings.NewReader("x")); err == nil {
+		t.Fatalf("expected nil spool to reject files")
+	}
+}
+
+func TestStageAttachmentsCopiesIntoWorkdir(t *testing.T) {
+	s, _ := NewSpool(t.TempDir(), 0, 0)
+	a, _ := s.Save("shot.png", "image/png", strings.NewReader("png"))
+	b, _ := s.Save("shot.png", "image/png", strings.NewReader("png2"))
+	work := t.TempDir()
+	ctx, cleanup := WithAttachmentStaging(context.Background())
+	staged, err := StageAttachments(ctx, work, []Attachment{a, b})
+	if err != nil {
+		t.Fatalf("stage: %v", err)
+	}
+	dir := filepath.Dir(staged[0].Path)
+	if filepath.Dir(dir) != filepath.Join(work, ".buddy", "attachments") ||
+		filepath.Base(staged[0].Path) != "shot.png" || staged[1].Path != filepath.Join(dir, "shot-1.png") {
+		t.Fatalf("unexpected staged paths %+v", staged)
+	}
+	if data, _ := os.ReadFile(staged[1].Path); string(data) != "png2" {
+		t.Fatalf("staged content %q", data)
+	}
+	if p := AttachmentsPrompt(staged); !strings.Contains(p, "shot.png (image/png, 3 bytes): "+staged[0].Path) {
+		t.Fatalf("unexpected prompt %q", p)
+	}
+	if data, _ := os.ReadFile(filepath.Join(work, ".buddy", ".gitignore")); string(data) != "*\n" {
+		t.Fatalf("staging dir not ignored by git: %q", data)
+	}
+
+	// Retries and later loop steps reuse the copies.
+	again, err := StageAttachments(ctx, work, []Attachment{a, b})
+	if err != nil || again[0].Path != staged[0].Path {
+		t.Fatalf("expected staged copies reused, got %+v (%v)", again, err)
+	}
+	cleanup()
+	if _, err := os.Stat(dir); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("staged copies left after the run: %v", err)
+	}
+}
+
+type attachAgent struct {
+	reqs  []AgentRequest
+	reply AgentResponse
+}
+
+func (a *attachAgent) Generate(ctx context.Context, req AgentRequest) (AgentResponse, error) {
+	a.reqs = append(a.reqs, req)
+	return a.reply, nil
+}
+
+type fileSpy struct{ transportSpy }
+
+func (f *fileSpy) SendsAttachments() bool { return true }
+
+func TestRunnerPassesAttachmentsBothWays(t *testing.T) {
+	spool, _ := NewSpool(t.TempDir(), 0, 0)
+	in := Attachment{Name: "shot.png", MIMEType: "image/png", Size: 3, Path: "/spool/shot.png"}
+	out, err := spool.Save("report.txt", "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	agent := &attachAgent{reply: AgentResponse{Reply: "done", Attachments: []Attachment{out}}}
+	r := NewRunner(nil, agent, nil, slog.Default(), WithSpool(spool))
+	outCh := make(chan OutboundMessage, 4)
+	r.transportMap = map[string]Transport{"mock": &fileSpy{transportSpy{out: outCh}}}
+
+	// An attachment with no text still reaches the agent.
+	r.handleMessage(context.Background(), InboundMessage{Transport: "mock", Sender: "alice", Attachments: []Attachment{in}})
+	if len(agent.reqs) != 1 || len(agent.reqs[0].Attachments) != 1 || agent.reqs[0].Attachments[0] != in {
+		t.Fatalf("attachments not passed to agent: %+v", agent.reqs)
+	}
+	select {
+	case msg := <-outCh:
+		if msg.Text != "done" || len(msg.Attachments) != 1 || msg.Attachments[0] != out {
+			t.Fatalf("unexpected outbound %+v", msg)
+		}
+	default:
+		t.Fatalf("no reply sent")
+	}
+}
+
+func TestRunnerNamesFilesTransportCannotSend(t *testing.T) {
+	spool, _ := NewSpool(t.TempDir(), 0, 0)
+	att, _ := spool.Save("report.txt", "", strings.NewReader("hello"))
+	agent := &attachAgent{reply: AgentResponse{Reply: "done", Attachments: []Attachment{att}}}
+	r := NewRunner(nil, agent, nil, slog.Default(), WithSpool(spool))
+	outCh := make(chan OutboundMessage, 4)
+	r.transportMap = map[string]Transport{"mock": &transportSpy{out: outCh}}
+
+	r.handleMessage(context.Background(), InboundMessage{Transport: "mock", Sender: "alice", Text: "hi"})
+	msg := <-outCh
+	if msg.Attachments != nil || msg.Text != "done\n\n(files not sent over mock: report.txt)" {
+		t.Fatalf("unexpected outbound %+v", msg)
+	}
+}
+
+func TestAgentAttachmentsStayInSpoolOrWorkdir(t *testing.T) {
+	spool, _ := NewSpool(t.TempDir(), 0, 0)
+	work, outside := t.TempDir(), t.TempDir()
+	inSpool, _ := spool.Save("a.txt", "", strings.NewReader("a"))
+	inWork := filepath.Join(work, "b.txt")
+	secret := filepath.Join(outside, "secret")
+	for _, p := range []string{inWork, secret} {
+		if err := os.WriteFile(p, []byte("x"), 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	escape := filepath.Join(work, "escape.txt")
+	if err := os.Symlink(secret, escape); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+	r := NewRunner(nil, &mockAgent{}, nil, slog.Default(), WithSpool(spool))
+	ctx := WithWorkdir(context.Background(), work)
+	got := r.agentAttachments(ctx, []Attachment{
+		inSpool,
+		{Name: "b.txt", Path: "b.txt"}, // relative to the working directory
+		{Name: "secret", Path: secret},
+		{Name: "escape.txt", Path: escape},
+		{Name: "up", Path: filepath.Join(work, "..", filepath.Base(outside), "secret")},
+		{Name: "dir", Path: work},
+		{Name: "passwd", Path: "/etc/passwd"},
+	}, slog.Default())
+	if len(got) != 2 || got[0].Path != inSpool.Path || got[1].Path != inWork {
+		t.Fatalf("unexpected attachments kept: %+v", got)
+	}
+}
+
+func TestSendPartsAttachesToLastPart(t *testing.T) {
+	r := NewRunner(nil, &mockAgent{}, nil, slog.Default(), WithMaxReplyChars(40), WithMaxReplyParts(5))
+	outCh := make(chan OutboundMessage, 8)
+	tr := &fileSpy{transportSpy{out: outCh}}
+	att := Attachment{Name: "a.txt", Path: "/spool/a.txt"}
+	long := strings.Repeat("word ", 30)
+	if err := r.sendReply(context.Background(), tr, OutboundMessage{Transport: "mock", Recipient: "alice", Text: long, Attachments: []Attachment{att}}, slog.Default()); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	close(outCh)
+	var msgs []OutboundMessage
+	for m := range outCh {
+		msgs = append(msgs, m)
+	}
+	if len(msgs) < 2 {
+		t.Fatalf("expected a split reply, got %d parts", len(msgs))
+	}
+	for i, m := range msgs {
+		if want := i == len(msgs)-1; (len(m.Attachments) == 1) != want {
+			t.Fatalf("part %d attachments %+v", i, m.Attachments)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package core
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"sort"
+	"time"
+
+	"github.com/joelklabo/buddy/internal/metrics"
+)
+
+// Transport supervisor states.
+const (
+	TransportStarting = "starting" // Start called, not yet up for startGrace
+	TransportRunning  = "running"
+	TransportFailing  = "failing" // Start returned an error; waiting to restart
+	TransportStopped  = "stopped" // Start returned nil or the runner is shutting down
+)
+
+// TransportState is a snapshot of one supervised transport.
+type TransportState struct {
+	ID        string    `json:"id"`
+	State     string    `json:"state"`
+	Restarts  int       `json:"restarts"`
+	LastError string    `json:"last_error,omitempty"`
+	Since     time.Time `json:"since"`
+}
+
+// RestartPolicy bounds transport restarts: the delay doubles from BaseDelay up to
+// MaxDelay with ±20% jitter, and resets once a transport stays up for MaxDelay.
+type RestartPolicy struct {
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// WithRestartPolicy overrides the transport restart backoff.
+func WithRestartPolicy(p RestartPolicy) RunnerOption {
+	return func(r *Runner) { r.restartPolicy = p }
+}
+
+// startGrace is how long Start must keep running before a transport counts as up.
+var startGrace = time.Second
+
+func (p RestartPolicy) delay(failures int) time.Duration {
+	base, max := p.BaseDelay, p.MaxDelay
+	if base <= 0 {
+		base = time.Second
+	}
+	if max < base {
+		max = base
+	}
+	d := base
+	for i := 1; i < failures && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	jitter := time.Duration(float64(d) * 0.2 * (2*rand.Float64() - 1))
+	return d + jitter
+}
+
+// TransportStates reports the supervisor state of every transport, sorted by ID.
+func (r *Runner) TransportStates() []TransportState {
+	r.transportMu.Lock()
+	defer r.transportMu.Unlock()
+	out := make([]TransportState, 0, len(r.transportStates))
+	for _, st := range r.transportStates {
+		out = append(out, *st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+func (r *Runner) setTransportState(id, state string, err error) {
+	r.transportMu.Lock()
+	if r.transportStates == nil {
+		r.transportStates = map[string]*TransportState{}
+	}
+	st, ok := r.transportStates[id]
+	if !ok {
+		st = &TransportState{ID: id}
+		r.transportStates[id] = st
+	}
+	if st.State != state {
+		st.Since = time.Now()
+	}
+	st.State = state
+	if err != nil {
+		st.LastError = err.Error()
+	}
+	if state == TransportFailing {
+		st.Restarts++
+	}
+	r.transportMu.Unlock()
+	metrics.SetTransportState(id, state)
+}
+
+// markTransportRunning promotes a transport that is still starting; a late timer
+// must not overwrite a failure recorded in the meantime.
+func (r *Runner) markTransportRunning(id string) {
+	r.transportMu.Lock()
+	st, ok := r.transportStates[id]
+	starting := ok && st.State == TransportStarting
+	r.transportMu.Unlock()
+	if starting {
+		r.setTransportState(id, TransportRunning, nil)
+	}
+}
+
+// superviseTransport runs tr.Start until ctx is done, restarting it with backoff
+// whenever it fails. A nil return means the transport finished on purpose.
+func (r *Runner) superviseTransport(ctx context.Context, tr Transport, inbound chan<- InboundMessage) {
+	id := tr.ID()
+	log := r.logger.With(slog.String("transport", id))
+	failures := 0
+	for {
+		r.setTransportState(id, TransportStarting, nil)
+		started := time.Now()
+		up := time.AfterFunc(startGrace, func() { r.markTransportRunning(id) })
+		err := tr.Start(ctx, inbound)
+		up.Stop()
+
+		if ctx.Err() != nil {
+			r.setTransportState(id, TransportStopped, nil)
+			return
+		}
+		if err == nil {
+			log.Info("transport stopped")
+			r.setTransportState(id, TransportStopped, nil)
+			return
+		}
+		if time.Since(started) >= r.restartPolicy.MaxDelay {
+			failures = 0 // it was healthy for a while; start backoff over
+		}
+		failures++
+		wait := r.restartPolicy.delay(failures)
+		log.Error("transport failed; restarting", slog.String("err", err.Error()), slog.Int("failures", failures), slog.Duration("backoff", wait))
+		r.setTransportState(id, TransportFailing, err)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			r.setTransportState(id, TransportStopped, nil)
+			return
+		case <-timer.C:
+		}
+	}
+}
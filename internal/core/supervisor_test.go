@@ -0,0 +1,83 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+// crashingTransport fails its first `failures` starts, then delivers one message.
+type crashingTransport struct {
+	mu       sync.Mutex
+	failures int
+	starts   int
+}
+
+func (f *crashingTransport) ID() string { return "flaky" }
+
+func (f *crashingTransport) Start(ctx context.Context, in chan<- InboundMessage) error {
+	f.mu.Lock()
+	f.starts++
+	fail := f.starts <= f.failures
+	f.mu.Unlock()
+	if fail {
+		return errors.New("connection reset")
+	}
+	select {
+	case in <- InboundMessage{Transport: "flaky", Sender: "alice", Text: "hi"}:
+	case <-ctx.Done():
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (f *crashingTransport) Send(context.Context, OutboundMessage) error { return nil }
+
+func TestSupervisorRestartsFailingTransport(t *testing.T) {
+	tr := &crashingTransport{failures: 2}
+	agent := &mockAgent{reply: "ok"}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	r := NewRunner([]Transport{tr}, agent, nil, logger,
+		WithRestartPolicy(RestartPolicy{BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- r.Start(ctx) }()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		states := r.TransportStates()
+		if len(states) == 1 && states[0].Restarts == 2 && states[0].State != TransportFailing {
+			if states[0].LastError != "connection reset" {
+				t.Fatalf("last error not recorded: %+v", states[0])
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("transport not restarted: %+v", states)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("runner ended with %v", err)
+	}
+	if st := r.TransportStates(); st[0].State != TransportStopped {
+		t.Fatalf("expected stopped after shutdown, got %+v", st[0])
+	}
+}
+
+func TestRestartPolicyDelayBounded(t *testing.T) {
+	p := RestartPolicy{BaseDelay: time.Second, MaxDelay: 8 * time.Second}
+	for failures, want := range map[int]time.Duration{1: time.Second, 3: 4 * time.Second, 10: 8 * time.Second} {
+		got := p.delay(failures)
+		if got < want*8/10 || got > want*12/10 {
+			t.Fatalf("delay(%d) = %s, want %s ±20%%", failures, got, want)
+		}
+	}
+}
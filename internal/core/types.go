@@ -16,11 +16,25 @@ type Transport interface {
 	Send(ctx context.Context, msg OutboundMessage) error
 }
 
+// AttachmentSender is implemented by transports that deliver
+// OutboundMessage.Attachments. For other transports the runner drops the files
+// and names them in the reply text instead.
+type AttachmentSender interface {
+	SendsAttachments() bool
+}
+
 // Agent produces model-driven replies and optional action calls.
 type Agent interface {
 	Generate(ctx context.Context, req AgentRequest) (AgentResponse, error)
 }
 
+// SandboxAgent is implemented by agents that run tools on the host.
+// EnforcesSandbox reports whether they apply AgentRequest.Sandbox; buddy refuses
+// to start when a role sets a sandbox and one of its agents reports false.
+type SandboxAgent interface {
+	EnforcesSandbox() bool
+}
+
 // Action exposes a callable capability (shell, fs, git, etc.).
 type Action interface {
 	Name() string
@@ -36,36 +50,82 @@ type InboundMessage struct {
 	Sender    string         `json:"sender"`
 	Text      string         `json:"text"`
 	ThreadID  string         `json:"thread_id"`
+	MessageID string         `json:"message_id,omitempty"` // stable per message; redeliveries with the same ID are dropped
 	Meta      map[string]any `json:"meta,omitempty"`
+
+	Attachments []Attachment `json:"attachments,omitempty"`
+
+	// Ack, when set by the transport, is called once the runner has taken the
+	// message: with nil after persisting it in the inbound queue (or dropping it
+	// as a redelivery), with the write error otherwise. Transports that track
+	// what they have delivered (cursors, processed IDs) should advance only on nil.
+	Ack func(error) `json:"-"`
+
+	queueID string // durable inbound queue entry, set by the runner
 }
 
-// OutboundMessage represents a message leaving the runner.
+func (m InboundMessage) ack(err error) {
+	if m.Ack != nil {
+		m.Ack(err)
+	}
+}
+
+// OutboundMessage represents a message leaving the runner. Replies carry the
+// Meta of the message they answer, so transports can thread them (email sets
+// In-Reply-To from Meta["message_id"]).
 type OutboundMessage struct {
 	Transport string         `json:"transport"`
 	Recipient string         `json:"recipient"`
 	Text      string         `json:"text"`
 	ThreadID  string         `json:"thread_id"`
 	Meta      map[string]any `json:"meta,omitempty"`
+
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+// Attachment is a file carried by a message. Path points at a local copy,
+// normally in the Spool; transports fill it in on receipt and read it on send.
+type Attachment struct {
+	Name     string `json:"name"`
+	MIMEType string `json:"mime_type,omitempty"`
+	Size     int64  `json:"size"`
+	Path     string `json:"path"`
 }
 
 // AgentRequest supplies the agent with prompt/context and available actions.
+// SessionID is the sender's active agent session (empty starts a new one); stateful
+// agents resume it and report the session they used back in AgentResponse.SessionID.
+// Sandbox, when set, is the sender's role sandbox level and overrides the agent's
+// configured default. Steps carries the agent and tool turns produced so far
+// while answering Prompt; an agent that returns no ActionCalls ends the loop with
+// its final reply. Attachments are the files sent with the message; CLI agents
+// read them from Path, multimodal agents may upload them.
 type AgentRequest struct {
 	Prompt     string         `json:"prompt"`
+	SessionID  string         `json:"session_id,omitempty"`
+	Sandbox    string         `json:"sandbox,omitempty"`
+	WorkingDir string         `json:"working_dir,omitempty"` // sender's active project path
 	History    []MessageTurn  `json:"history,omitempty"`
+	Steps      []MessageTurn  `json:"steps,omitempty"`
 	Actions    []ActionSpec   `json:"actions,omitempty"`
 	SenderMeta map[string]any `json:"sender_meta,omitempty"`
+
+	Attachments []Attachment `json:"attachments,omitempty"`
 }
 
-// AgentResponse is produced by the agent.
+// AgentResponse is produced by the agent. Attachments are files to send back
+// with the reply.
 type AgentResponse struct {
 	Reply       string       `json:"reply"`
 	SessionID   string       `json:"session_id,omitempty"`
 	ActionCalls []ActionCall `json:"action_calls,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"`
 }
 
 // MessageTurn represents one exchange in history.
 type MessageTurn struct {
-	Role string `json:"role"` // user or agent
+	Role string `json:"role"`           // user, agent or tool
+	Name string `json:"name,omitempty"` // action name for tool turns
 	Text string `json:"text"`
 }
 
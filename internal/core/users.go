@@ -0,0 +1,63 @@
+package core
+
+import (
+	"strings"
+
+	"github.com/joelklabo/buddy/internal/store"
+)
+
+// User is one person known to the runner, with the sender IDs they use on each
+// transport. Messages from any linked identity share the user's sessions,
+// preferences, rate limits, role and audit name.
+type User struct {
+	ID         string
+	Identities map[string][]string // transport ID -> sender IDs (npub/hex pubkey, phone number, email)
+}
+
+// WithUsers installs the user directory. Linked identities are allowed in
+// addition to WithAllowedSenders; the directory alone restricts no one.
+func WithUsers(users []User) RunnerOption {
+	return func(r *Runner) {
+		r.users = make(map[string]string)
+		for _, u := range users {
+			for transport, ids := range u.Identities {
+				for _, id := range ids {
+					r.users[transport+":"+normalizeSender(id)] = strings.ToLower(u.ID)
+				}
+			}
+		}
+	}
+}
+
+// userID returns the ID of the user msg's sender is linked to, or "" for
+// senders outside the directory.
+func (r *Runner) userID(msg InboundMessage) string {
+	return r.users[msg.Transport+":"+normalizeSender(msg.Sender)]
+}
+
+// principal names whoever sent msg: the linked user as "user:<id>", else the
+// raw sender. It keys roles and is what the audit log records.
+func (r *Runner) principal(msg InboundMessage) string {
+	if id := r.userID(msg); id != "" {
+		return "user:" + id
+	}
+	return msg.Sender
+}
+
+// ownerKey is the store key of state msg's sender owns: the linked user's,
+// or the sender's on its transport.
+func (r *Runner) ownerKey(msg InboundMessage) store.Key {
+	if id := r.userID(msg); id != "" {
+		return store.UserKey(id)
+	}
+	return store.SenderKey(msg.Transport, msg.Sender)
+}
+
+// senderKey scopes per-sender state (rate limits, preferences) like ownerKey,
+// ignoring the case of the sender ID.
+func (r *Runner) senderKey(msg InboundMessage) store.Key {
+	if id := r.userID(msg); id != "" {
+		return store.UserKey(id)
+	}
+	return store.SenderKey(msg.Transport, strings.ToLower(msg.Sender))
+}
@@ -0,0 +1,99 @@
+package core
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+var alice = User{ID: "alice", Identities: map[string][]string{
+	"nostr":    {"ABCDEF"},
+	"whatsapp": {"whatsapp:+15550001"},
+}}
+
+func TestUserContinuesSessionAcrossTransports(t *testing.T) {
+	agent := &scopeAgent{}
+	r := NewRunner(nil, agent, nil, slog.Default(), WithStore(&memoryStore{}), WithUsers([]User{alice}))
+	outCh := make(chan OutboundMessage, 4)
+	spy := &transportSpy{out: outCh}
+	r.transportMap = map[string]Transport{"nostr": spy, "whatsapp": spy}
+
+	r.handleMessage(context.Background(), InboundMessage{Transport: "nostr", Sender: "abcdef", Text: "start"})
+	r.handleMessage(context.Background(), InboundMessage{Transport: "whatsapp", Sender: "+15550001", Text: "continue"})
+	if len(agent.resumed) != 2 || agent.resumed[1] != "a" {
+		t.Fatalf("whatsapp message did not resume the nostr session: %v", agent.resumed)
+	}
+	if got := (<-outCh).Recipient; got != "abcdef" {
+		t.Fatalf("first reply went to %q", got)
+	}
+	if got := (<-outCh).Recipient; got != "+15550001" {
+		t.Fatalf("reply must go back over the sender's own transport, got %q", got)
+	}
+}
+
+func TestUsersExtendAllowlist(t *testing.T) {
+	r := NewRunner(nil, &mockAgent{}, nil, slog.Default(), WithAllowedSenders([]string{"owner"}), WithUsers([]User{alice}))
+	cases := []struct {
+		msg  InboundMessage
+		want bool
+	}{
+		{InboundMessage{Transport: "nostr", Sender: "owner"}, true},
+		{InboundMessage{Transport: "whatsapp", Sender: "+15550001"}, true},
+		{InboundMessage{Transport: "email", Sender: "+15550001"}, false}, // identities are per transport
+		{InboundMessage{Transport: "whatsapp", Sender: "+15559999"}, false},
+	}
+	for _, tc := range cases {
+		if got := r.senderAllowed(slog.Default(), tc.msg); got != tc.want {
+			t.Fatalf("%+v: allowed=%v, want %v", tc.msg, got, tc.want)
+		}
+	}
+	open := NewRunner(nil, &mockAgent{}, nil, slog.Default(), WithUsers([]User{alice}))
+	if !open.senderAllowed(slog.Default(), InboundMessage{Transport: "whatsapp", Sender: "+15559999"}) {
+		t.Fatalf("users without a runner allowlist must not lock out other senders")
+	}
+}
+
+func TestUserSharesQuotaRoleAndAudit(t *testing.T) {
+	audit := &senderAudit{}
+	r := NewRunner(nil, &mockAgent{}, nil, slog.Default(),
+		WithUsers([]User{alice}),
+		WithRateLimits(RateLimit{DailyAgentTime: time.Nanosecond}, nil),
+		WithRoles(map[string]Role{"user:alice": {Name: "admin", Commands: []string{"*"}}}, &Role{Name: "guest"}),
+		WithAuditLogger(audit))
+
+	nostrMsg := InboundMessage{Transport: "nostr", Sender: "abcdef"}
+	waMsg := InboundMessage{Transport: "whatsapp", Sender: "+15550001"}
+	if r.senderKey(nostrMsg) != r.senderKey(waMsg) || r.runKey(nostrMsg) != r.runKey(waMsg) {
+		t.Fatalf("identities not resolved to one user: %q %q", r.senderKey(nostrMsg), r.senderKey(waMsg))
+	}
+	release, _ := r.acquireRun(nostrMsg, slog.Default())
+	if release == nil {
+		t.Fatalf("first run rejected")
+	}
+	time.Sleep(time.Millisecond)
+	release()
+	if release, _ := r.acquireRun(waMsg, slog.Default()); release != nil {
+		t.Fatalf("daily quota not shared across the user's transports")
+	}
+
+	if got := r.roleFor(waMsg).name(); got != "admin" {
+		t.Fatalf("user role not applied, got %q", got)
+	}
+	if got := r.roleFor(InboundMessage{Transport: "whatsapp", Sender: "+1999"}).name(); got != "guest" {
+		t.Fatalf("unlinked sender should get the default role, got %q", got)
+	}
+
+	r.logAudit("agent", r.principal(waMsg), "ok", 0)
+	r.logAudit("agent", r.principal(InboundMessage{Sender: "bob"}), "ok", 0)
+	if len(audit.senders) != 2 || audit.senders[0] != "user:alice" || audit.senders[1] != "bob" {
+		t.Fatalf("unexpected audit senders %v", audit.senders)
+	}
+}
+
+type senderAudit struct{ senders []string }
+
+func (a *senderAudit) AppendAudit(action, sender, outcome string, dur time.Duration) error {
+	a.senders = append(a.senders, sender)
+	return nil
+}
@@ -7,11 +7,32 @@ import (
 	"net"
 	"net/http"
 	"time"
+
+	"github.com/joelklabo/buddy/internal/core"
 )
 
+// Option configures the health endpoint.
+type Option func(*server)
+
+type server struct {
+	transports func() []core.TransportState
+}
+
+// WithTransports adds per-transport supervisor state to the response. Any
+// failing transport reports the overall status as "degraded".
+func WithTransports(fn func() []core.TransportState) Option {
+	return func(s *server) { s.transports = fn }
+}
+
+type response struct {
+	Status     string                `json:"status"`
+	Version    string                `json:"version"`
+	Transports []core.TransportState `json:"transports,omitempty"`
+}
+
 // Start launches a simple /health endpoint. If addr is empty, it is a no-op.
 // It returns the actual listening address (useful if addr ends with :0).
-func Start(ctx context.Context, addr, version string, logger *slog.Logger) (string, error) {
+func Start(ctx context.Context, addr, version string, logger *slog.Logger, opts ...Option) (string, error) {
 	if addr == "" {
 		return "", nil
 	}
@@ -20,14 +41,15 @@ func Start(ctx context.Context, addr, version string, logger *slog.Logger) (stri
 		return "", err
 	}
 	actual := ln.Addr().String()
+	cfg := &server{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(map[string]string{
-			"status":  "ok",
-			"version": version,
-		})
+		_ = json.NewEncoder(w).Encode(cfg.report(version))
 	})
 
 	srv := &http.Server{
@@ -51,3 +73,17 @@ func Start(ctx context.Context, addr, version string, logger *slog.Logger) (stri
 	logger.Info("health server listening", slog.String("addr", actual))
 	return actual, nil
 }
+
+func (s *server) report(version string) response {
+	resp := response{Status: "ok", Version: version}
+	if s.transports == nil {
+		return resp
+	}
+	resp.Transports = s.transports()
+	for _, t := range resp.Transports {
+		if t.State == core.TransportFailing {
+			resp.Status = "degraded"
+		}
+	}
+	return resp
+}
@@ -2,12 +2,15 @@ package health
 
 import (
 	"context"
+	"encoding/json"
 	"io"
 	"net/http"
 	"testing"
 	"time"
 
 	"log/slog"
+
+	"github.com/joelklabo/buddy/internal/core"
 )
 
 func TestHealthServer(t *testing.T) {
@@ -56,3 +59,36 @@ func TestHealthServerStopsOnCancel(t *testing.T) {
 	}
 	t.Fatalf("health endpoint still responding after cancel")
 }
+
+func TestHealthReportsTransportStates(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	states := func() []core.TransportState {
+		return []core.TransportState{
+			{ID: "nostr", State: core.TransportRunning},
+			{ID: "slack", State: core.TransportFailing, Restarts: 2, LastError: "socket closed"},
+		}
+	}
+	addr, err := Start(ctx, "127.0.0.1:0", "testver", slog.Default(), WithTransports(states))
+	if err != nil {
+		t.Fatalf("start health: %v", err)
+	}
+
+	client := http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Get("http://" + addr + "/health")
+	if err != nil {
+		t.Fatalf("get health: %v", err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Status     string                `json:"status"`
+		Transports []core.TransportState `json:"transports"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Status != "degraded" || len(body.Transports) != 2 || body.Transports[1].Restarts != 2 {
+		t.Fatalf("unexpected health body: %+v", body)
+	}
+}
@@ -15,10 +15,25 @@ var (
 	agentErrors = prometheus.NewCounter(prometheus.CounterOpts{Name: "runner_agent_errors_total", Help: "Agent errors"})
 	actionCalls = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "runner_action_calls_total", Help: "Action invocations"}, []string{"action", "status"})
 	sendErrors  = prometheus.NewCounter(prometheus.CounterOpts{Name: "runner_send_errors_total", Help: "Transport send errors"})
+	queueDepth  = prometheus.NewGauge(prometheus.GaugeOpts{Name: "runner_queue_depth", Help: "Inbound messages waiting to be processed"})
+	deadLetters = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "runner_dead_letters_total", Help: "Outbound messages moved to the dead-letter bucket"}, []string{"transport"})
+	duplicates  = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "runner_duplicate_inbound_total", Help: "Inbound messages dropped as redeliveries"}, []string{"transport"})
+	rateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "runner_rate_limited_total", Help: "Messages rejected by rate limits or quotas"}, []string{"transport", "reason"})
+
+	transportState    = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "runner_transport_state", Help: "Supervisor state per transport (1 for the current state)"}, []string{"transport", "state"})
+	transportRestarts = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "runner_transport_restarts_total", Help: "Transport restarts after a failure"}, []string{"transport"})
+
+	agentFallbacks = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "runner_agent_fallbacks_total", Help: "Agent calls handed to a fallback agent"}, []string{"from", "to"})
+	agentCircuit   = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "runner_agent_circuit_state", Help: "Circuit breaker state per agent (1 for the current state)"}, []string{"agent", "state"})
+)
+
+var (
+	transportStates = []string{"starting", "running", "failing", "stopped"}
+	circuitStates   = []string{"closed", "open", "half_open"}
 )
 
 func init() {
-	prometheus.MustRegister(inboundMsgs, agentErrors, actionCalls, sendErrors)
+	prometheus.MustRegister(inboundMsgs, agentErrors, actionCalls, sendErrors, queueDepth, rateLimited, duplicates, deadLetters, transportState, transportRestarts, agentCircuit, agentFallbacks)
 }
 
 // Start runs a Prometheus handler on the given listen addr.
@@ -52,3 +67,41 @@ func IncAgentError() { agentErrors.Inc() }
 func IncAction(action string, status string) { actionCalls.WithLabelValues(action, status).Inc() }
 
 func IncSendError() { sendErrors.Inc() }
+
+func IncQueueDepth() { queueDepth.Inc() }
+
+func DecQueueDepth() { queueDepth.Dec() }
+
+func IncRateLimited(transport, reason string) { rateLimited.WithLabelValues(transport, reason).Inc() }
+
+func IncDuplicateInbound(transport string) { duplicates.WithLabelValues(transport).Inc() }
+
+func IncDeadLetter(transport string) { deadLetters.WithLabelValues(transport).Inc() }
+
+// SetTransportState marks state as the current supervisor state of transport;
+// entering "failing" also counts a restart.
+func SetTransportState(transport, state string) {
+	for _, s := range transportStates {
+		v := 0.0
+		if s == state {
+			v = 1
+		}
+		transportState.WithLabelValues(transport, s).Set(v)
+	}
+	if state == "failing" {
+		transportRestarts.WithLabelValues(transport).Inc()
+	}
+}
+
+// SetAgentCircuitState marks state as the current circuit breaker state of agent.
+func SetAgentCircuitState(agent, state string) {
+	for _, s := range circuitStates {
+		v := 0.0
+		if s == state {
+			v = 1
+		}
+		agentCircuit.WithLabelValues(agent, s).Set(v)
+	}
+}
+
+func IncAgentFallback(from, to string) { agentFallbacks.WithLabelValues(from, to).Inc() }
@@ -30,6 +30,8 @@ type Client struct {
 	relays  []string
 	store   store.StoreAPI
 	allowed map[string]struct{}
+	// transport is the transport ID cursors and recent messages are stored under.
+	transport string
 
 	secretMu sync.Mutex
 	secrets  map[string][]byte
@@ -67,6 +69,7 @@ func NewWithPool(privKey string, pubKey string, relays []string, allowedPubkeys
 		pubKey:      strings.ToLower(pubKey),
 		relays:      relays,
 		store:       st,
+		transport:   "nostr",
 		allowed:     allowed,
 		secrets:     make(map[string][]byte),
 		seen:        newSeenIDs(),
@@ -77,8 +80,22 @@ func NewWithPool(privKey string, pubKey string, relays []string, allowedPubkeys
 	}
 }
 
+// SetTransportID sets the transport ID the client's state is stored under, so
+// several Nostr transports sharing a store keep separate cursors.
+func (c *Client) SetTransportID(id string) {
+	if id != "" {
+		c.transport = id
+	}
+}
+
+func (c *Client) key(sender string) store.Key {
+	return store.SenderKey(c.transport, sender)
+}
+
 // Listen subscribes to encrypted DMs addressed to this runner and invokes handler for each new message.
-func (c *Client) Listen(ctx context.Context, handler func(context.Context, IncomingMessage)) error {
+// The event is marked processed and the cursor advanced only once handler returns
+// nil, i.e. the message has been persisted; otherwise it is fetched again after a restart.
+func (c *Client) Listen(ctx context.Context, handler func(context.Context, IncomingMessage) error) error {
 	if c.pool == nil {
 		return errors.New("nil pool")
 	}
@@ -103,7 +120,7 @@ func (c *Client) Listen(ctx context.Context, handler func(context.Context, Incom
 				if c.seen.Seen(evt.ID) {
 					continue
 				}
-				already, err := c.store.AlreadyProcessed(evt.ID)
+				already, err := c.store.Processed(evt.ID)
 				if err != nil {
 					continue
 				}
@@ -131,7 +148,7 @@ func (c *Client) Listen(ctx context.Context, handler func(context.Context, Incom
 						return
 					}
 
-					if seen, err := c.store.RecentMessageSeen(s, dec, c.msgWindow); err == nil && seen {
+					if seen, err := c.store.MessageSeen(c.key(s), dec, c.msgWindow); err == nil && seen {
 						return
 					}
 
@@ -139,9 +156,12 @@ func (c *Client) Listen(ctx context.Context, handler func(context.Context, Incom
 						return
 					}
 
-					_ = c.store.SaveCursor(s, e.CreatedAt.Time())
-
-					handler(ctx, IncomingMessage{Event: e, SenderPubKey: s, Plaintext: dec})
+					if err := handler(ctx, IncomingMessage{Event: e, SenderPubKey: s, Plaintext: dec}); err != nil {
+						return
+					}
+					_ = c.store.MarkProcessed(e.ID)
+					_ = c.store.RecordMessage(c.key(s), dec)
+					_ = c.store.SaveCursor(c.key(s), e.CreatedAt.Time())
 				}(evt, sender, secret)
 			}
 		}
@@ -264,7 +284,7 @@ func (c *Client) allowedList() []string {
 func (c *Client) lastCursorMax() nostr.Timestamp {
 	latest := time.Now().Add(-30 * time.Second)
 	for pk := range c.allowed {
-		if t, err := c.store.LastCursor(pk); err == nil && !t.IsZero() && t.After(latest) {
+		if t, err := c.store.LastCursor(c.key(pk)); err == nil && !t.IsZero() && t.After(latest) {
 			latest = t
 		}
 	}
@@ -61,11 +61,12 @@ func TestLastCursorMax(t *testing.T) {
 	st := newStore(t)
 	defer func() { _ = st.Close() }()
 	now := time.Now().UTC()
-	_ = st.SaveCursor("a", now.Add(-10*time.Second))
-	_ = st.SaveCursor("b", now.Add(-5*time.Second))
+	_ = st.SaveCursor(store.SenderKey("nostr", "a"), now.Add(-10*time.Second))
+	_ = st.SaveCursor(store.SenderKey("nostr", "b"), now.Add(-5*time.Second))
 	c := &Client{
-		store:   st,
-		allowed: map[string]struct{}{"a": {}, "b": {}},
+		store:     st,
+		allowed:   map[string]struct{}{"a": {}, "b": {}},
+		transport: "nostr",
 	}
 	ts := c.lastCursorMax()
 	if time.Unix(int64(ts), 0).After(now) {
@@ -89,35 +90,42 @@ func TestSharedSecretCaches(t *testing.T) {
 
 func TestListenNilPool(t *testing.T) {
 	c := &Client{pool: nil}
-	if err := c.Listen(context.Background(), func(context.Context, IncomingMessage) {}); err == nil {
+	if err := c.Listen(context.Background(), func(context.Context, IncomingMessage) error { return nil }); err == nil {
 		t.Fatalf("expected error on nil pool")
 	}
 }
 
 // stub implementations for Listen testing
 type stubStore struct {
+	mu        sync.Mutex
 	processed map[string]bool
 }
 
-func (s *stubStore) SaveActive(pubkey, sessionID string) error { return nil }
-func (s *stubStore) ClearActive(pubkey string) error           { return nil }
-func (s *stubStore) Active(pubkey string) (store.SessionState, bool, error) {
+func (s *stubStore) SaveActive(key store.Key, sessionID string) error { return nil }
+func (s *stubStore) ClearActive(key store.Key) error                  { return nil }
+func (s *stubStore) Active(key store.Key) (store.SessionState, bool, error) {
 	return store.SessionState{}, false, nil
 }
-func (s *stubStore) LastCursor(pubkey string) (time.Time, error)  { return time.Time{}, nil }
-func (s *stubStore) SaveCursor(pubkey string, ts time.Time) error { return nil }
-func (s *stubStore) AlreadyProcessed(eventID string) (bool, error) {
+func (s *stubStore) LastCursor(key store.Key) (time.Time, error)  { return time.Time{}, nil }
+func (s *stubStore) SaveCursor(key store.Key, ts time.Time) error { return nil }
+func (s *stubStore) Processed(eventID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.processed[eventID], nil
+}
+func (s *stubStore) MarkProcessed(eventID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if s.processed == nil {
 		s.processed = map[string]bool{}
 	}
-	seen := s.processed[eventID]
 	s.processed[eventID] = true
-	return seen, nil
+	return nil
 }
-func (s *stubStore) MarkProcessed(eventID string) error { return nil }
-func (s *stubStore) RecentMessageSeen(pubkey, message string, window time.Duration) (bool, error) {
+func (s *stubStore) MessageSeen(key store.Key, message string, window time.Duration) (bool, error) {
 	return false, nil
 }
+func (s *stubStore) RecordMessage(key store.Key, message string) error { return nil }
 
 type stubPool struct {
 	ch chan nostr.RelayEvent
@@ -174,7 +182,9 @@ func TestListenProcessesInbound(t *testing.T) {
 	defer cancel()
 
 	got := make(chan IncomingMessage, 1)
-	go func() { _ = c.Listen(ctx, func(_ context.Context, m IncomingMessage) { got <- m; cancel() }) }()
+	go func() {
+		_ = c.Listen(ctx, func(_ context.Context, m IncomingMessage) error { got <- m; cancel(); return nil })
+	}()
 
 	ev := &nostr.Event{ID: "e1", PubKey: pub, CreatedAt: nostr.Now(), Kind: nostr.KindEncryptedDirectMessage, Tags: nostr.Tags{nostr.Tag{"p", pub}}}
 	secret, _ := nip04.ComputeSharedSecret(pub, priv)
@@ -195,6 +205,70 @@ func TestListenProcessesInbound(t *testing.T) {
 	}
 }
 
+func TestListenMarksProcessedOnlyAfterHandoff(t *testing.T) {
+	priv := nostr.GeneratePrivateKey()
+	pub, _ := nostr.GetPublicKey(priv)
+	secret, _ := nip04.ComputeSharedSecret(pub, priv)
+	for _, tc := range []struct {
+		name       string
+		handlerErr error
+		want       bool
+	}{
+		{"persisted", nil, true},
+		{"not persisted", errors.New("queue write failed"), false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pool := newStubPool()
+			st := &stubStore{}
+			c := NewWithPool(priv, pub, []string{"wss://relay"}, []string{pub}, st, pool)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var id string // set before the event is delivered
+			handled := make(chan struct{})
+			go func() {
+				_ = c.Listen(ctx, func(context.Context, IncomingMessage) error {
+					if seen, _ := st.Processed(id); seen {
+						t.Errorf("event marked processed before the handler returned")
+					}
+					defer close(handled)
+					return tc.handlerErr
+				})
+			}()
+
+			ev := &nostr.Event{PubKey: pub, CreatedAt: nostr.Now(), Kind: nostr.KindEncryptedDirectMessage, Tags: nostr.Tags{nostr.Tag{"p", pub}}}
+			ev.Content, _ = nip04.Encrypt("hello", secret)
+			if err := ev.Sign(priv); err != nil {
+				t.Fatalf("sign: %v", err)
+			}
+			id = ev.ID
+			pool.ch <- nostr.RelayEvent{Event: ev}
+			select {
+			case <-handled:
+			case <-time.After(2 * time.Second):
+				t.Fatalf("timeout")
+			}
+			deadline := time.Now().Add(time.Second)
+			for {
+				seen, _ := st.Processed(ev.ID)
+				if seen == tc.want {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("processed = %v, want %v", seen, tc.want)
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			if !tc.want {
+				time.Sleep(50 * time.Millisecond)
+				if seen, _ := st.Processed(ev.ID); seen {
+					t.Fatalf("event marked processed although the handler failed")
+				}
+			}
+		})
+	}
+}
+
 func TestSendReplyPublishesErrors(t *testing.T) {
 	priv := nostr.GeneratePrivateKey()
 	pub, _ := nostr.GetPublicKey(priv)
@@ -237,7 +311,7 @@ func TestBuildFilterUsesAllowedAndCursor(t *testing.T) {
 	st := newStore(t)
 	defer func() { _ = st.Close() }()
 	now := time.Now()
-	_ = st.SaveCursor("alice", now.Add(-5*time.Second))
+	_ = st.SaveCursor(store.SenderKey("nostr", "alice"), now.Add(-5*time.Second))
 	priv := nostr.GeneratePrivateKey()
 	pub, _ := nostr.GetPublicKey(priv)
 	c := New(priv, pub, []string{"wss://relay"}, []string{"alice"}, st)
@@ -250,6 +324,20 @@ func TestBuildFilterUsesAllowedAndCursor(t *testing.T) {
 	}
 }
 
+func TestCursorsKeptPerTransport(t *testing.T) {
+	st := newStore(t)
+	defer func() { _ = st.Close() }()
+	old := time.Now().Add(-time.Hour)
+	_ = st.SaveCursor(store.SenderKey("nostr", "alice"), old)
+	priv := nostr.GeneratePrivateKey()
+	pub, _ := nostr.GetPublicKey(priv)
+	c := New(priv, pub, []string{"wss://relay"}, []string{"alice"}, st)
+	c.SetTransportID("nostr-work")
+	if since := c.lastCursorMax(); time.Unix(int64(since), 0).Before(time.Now().Add(-time.Minute)) {
+		t.Fatalf("second transport picked up the first one's cursor: %v", since)
+	}
+}
+
 func TestPublishProfileSuccess(t *testing.T) {
 	priv := nostr.GeneratePrivateKey()
 	pub, _ := nostr.GetPublicKey(priv)
@@ -4,15 +4,16 @@ import "time"
 
 // StoreAPI defines the persistence operations used by the runner.
 type StoreAPI interface {
-	SaveActive(pubkey, sessionID string) error
-	ClearActive(pubkey string) error
-	Active(pubkey string) (SessionState, bool, error)
+	SaveActive(key Key, sessionID string) error
+	ClearActive(key Key) error
+	Active(key Key) (SessionState, bool, error)
 
-	LastCursor(pubkey string) (time.Time, error)
-	SaveCursor(pubkey string, ts time.Time) error
+	LastCursor(key Key) (time.Time, error)
+	SaveCursor(key Key, ts time.Time) error
 
-	AlreadyProcessed(eventID string) (bool, error)
+	Processed(eventID string) (bool, error)
 	MarkProcessed(eventID string) error
 
-	RecentMessageSeen(pubkey, message string, window time.Duration) (bool, error)
+	MessageSeen(sender Key, message string, window time.Duration) (bool, error)
+	RecordMessage(sender Key, message string) error
 }
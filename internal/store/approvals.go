@@ -0,0 +1,77 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var bucketApprovals = []byte("approvals")
+
+// PendingApproval is an action call held until the sender approves or denies it.
+type PendingApproval struct {
+	ID        string          `json:"id"`
+	Transport string          `json:"transport"`
+	Sender    string          `json:"sender"`
+	ThreadID  string          `json:"thread_id"`
+	Action    string          `json:"action"`
+	Args      json.RawMessage `json:"args"`
+	CreatedAt time.Time       `json:"created_at"`
+	ExpiresAt time.Time       `json:"expires_at"`
+}
+
+// Expired reports whether the approval window has passed.
+func (p PendingApproval) Expired(now time.Time) bool {
+	return !p.ExpiresAt.IsZero() && now.After(p.ExpiresAt)
+}
+
+// SavePendingApproval stores a pending approval and drops any that have expired.
+func (s *Store) SavePendingApproval(p PendingApproval) error {
+	if p.ID == "" {
+		return errors.New("approval id required")
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketApprovals)
+		var expired [][]byte
+		_ = b.ForEach(func(k, v []byte) error {
+			var existing PendingApproval
+			if json.Unmarshal(v, &existing) != nil || existing.Expired(now) {
+				expired = append(expired, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		for _, k := range expired {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return b.Put([]byte(p.ID), data)
+	})
+}
+
+// TakePendingApproval removes and returns the pending approval with the given id.
+// Expired entries are returned as well so callers can report them.
+func (s *Store) TakePendingApproval(id string) (PendingApproval, bool, error) {
+	var p PendingApproval
+	var found bool
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketApprovals)
+		v := b.Get([]byte(id))
+		if v == nil {
+			return nil
+		}
+		if err := json.Unmarshal(v, &p); err != nil {
+			return err
+		}
+		found = true
+		return b.Delete([]byte(id))
+	})
+	return p, found, err
+}
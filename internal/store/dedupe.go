@@ -0,0 +1,76 @@
+package store
+
+import (
+	"errors"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var bucketInboundSeen = []byte("inbound_seen")
+
+// InboundSeen reports whether key was recorded less than ttl ago. It does not
+// record anything: callers record a message with RecordInbound (or as the
+// DedupeKey of EnqueueInbound) only once it is safely taken.
+func (s *Store) InboundSeen(key string, ttl time.Duration) (bool, error) {
+	if key == "" {
+		return false, errors.New("inbound key required")
+	}
+	var seen bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		seen = seenWithin(tx.Bucket(bucketInboundSeen), key, ttl)
+		return nil
+	})
+	return seen, err
+}
+
+// RecordInbound records a sighting of key. Refreshing on every sighting keeps
+// a message that a transport redelivers for longer than the TTL deduplicated.
+func (s *Store) RecordInbound(key string) error {
+	if key == "" {
+		return errors.New("inbound key required")
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return recordInbound(tx, key)
+	})
+}
+
+func seenWithin(b *bolt.Bucket, key string, ttl time.Duration) bool {
+	v := b.Get([]byte(key))
+	if v == nil {
+		return false
+	}
+	ts, err := time.Parse(time.RFC3339Nano, string(v))
+	return err == nil && time.Since(ts) < ttl
+}
+
+func recordInbound(tx *bolt.Tx, key string) error {
+	return tx.Bucket(bucketInboundSeen).Put([]byte(key), []byte(time.Now().UTC().Format(time.RFC3339Nano)))
+}
+
+// PruneInbound deletes inbound keys last seen before cutoff and returns how
+// many were removed.
+func (s *Store) PruneInbound(cutoff time.Time) (int, error) {
+	var n int
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketInboundSeen)
+		var stale [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			if ts, err := time.Parse(time.RFC3339Nano, string(v)); err != nil || ts.Before(cutoff) {
+				stale = append(stale, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range stale {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		n = len(stale)
+		return nil
+	})
+	return n, err
+}
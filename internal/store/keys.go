@@ -0,0 +1,79 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Key identifies per-conversation state: a sender on a transport, optionally
+// narrowed to one thread and one named agent. Transport is empty only for state
+// a linked user carries across transports, whose Sender is "user:<id>"; a
+// thread-wide key leaves Sender empty.
+type Key struct {
+	Transport string // transport ID, e.g. "nostr" or "whatsapp"
+	Sender    string
+	Thread    string
+	Agent     string // named agent owning a session; empty for the default agent
+}
+
+// SenderKey is the key of a sender's state on a transport.
+func SenderKey(transport, sender string) Key {
+	return Key{Transport: transport, Sender: sender}
+}
+
+// UserKey is the key of state a linked user shares across transports.
+func UserKey(id string) Key {
+	return Key{Sender: "user:" + id}
+}
+
+// IsZero reports whether k names no conversation.
+func (k Key) IsZero() bool {
+	return k.Transport == "" && k.Sender == "" && k.Thread == ""
+}
+
+// String encodes k as the bucket key: path-escaped transport, sender, thread
+// and agent joined by "/", with empty trailing parts left off, e.g.
+// "whatsapp/+15550001" or "email//%3Croot@example.com%3E".
+func (k Key) String() string {
+	parts := []string{k.Transport, k.Sender, k.Thread, k.Agent}
+	for len(parts) > 1 && parts[len(parts)-1] == "" {
+		parts = parts[:len(parts)-1]
+	}
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	return strings.Join(parts, "/")
+}
+
+// ParseKey decodes a key produced by Key.String.
+func ParseKey(s string) (Key, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) > 4 {
+		return Key{}, fmt.Errorf("invalid store key %q", s)
+	}
+	var fields [4]string
+	for i, p := range parts {
+		v, err := url.PathUnescape(p)
+		if err != nil {
+			return Key{}, fmt.Errorf("invalid store key %q: %w", s, err)
+		}
+		fields[i] = v
+	}
+	k := Key{Transport: fields[0], Sender: fields[1], Thread: fields[2], Agent: fields[3]}
+	if k.IsZero() {
+		return Key{}, fmt.Errorf("invalid store key %q", s)
+	}
+	return k, nil
+}
+
+var errEmptyKey = errors.New("store key required")
+
+// bytes is the encoded key, or an error for a key naming no conversation.
+func (k Key) bytes() ([]byte, error) {
+	if k.IsZero() {
+		return nil, errEmptyKey
+	}
+	return []byte(k.String()), nil
+}
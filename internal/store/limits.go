@@ -0,0 +1,52 @@
+package store
+
+import (
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var bucketLimits = []byte("limits")
+
+// LimitState is the persisted rate-limit usage for one sender.
+type LimitState struct {
+	Tokens       float64   `json:"tokens"`        // message tokens left in the bucket
+	RefilledAt   time.Time `json:"refilled_at"`   // last time Tokens was topped up
+	Day          string    `json:"day"`           // UTC day (YYYY-MM-DD) AgentSeconds counts for
+	AgentSeconds float64   `json:"agent_seconds"` // agent run time used on Day
+}
+
+// LimitState returns the stored usage for key.
+func (s *Store) LimitState(key Key) (LimitState, bool, error) {
+	var st LimitState
+	var found bool
+	k, err := key.bytes()
+	if err != nil {
+		return st, false, err
+	}
+	err = s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucketLimits).Get(k)
+		if v == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(v, &st)
+	})
+	return st, found, err
+}
+
+// SaveLimitState stores usage for key.
+func (s *Store) SaveLimitState(key Key, st LimitState) error {
+	k, err := key.bytes()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketLimits).Put(k, data)
+	})
+}
@@ -0,0 +1,146 @@
+package store
+
+import (
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// bucketHeld keeps, per original bucket, the legacy keys migration 2 could
+// not assign to a configured transport, until ReleaseHeld can.
+var bucketHeld = []byte("held_keys")
+
+// migrateKeys is migration 2. Before keys named their transport, sessions and
+// Nostr cursors were keyed by the bare sender. env.TransportFor names the
+// transport ID a sender belongs to; keys it returns "" for are moved to
+// bucketHeld rather than lost.
+func migrateKeys(tx *bolt.Tx, env MigrationEnv, step *MigrationStep) error {
+	transportFor := env.TransportFor
+	if transportFor == nil {
+		transportFor = func(string) string { return "" }
+	}
+	for _, name := range [][]byte{bucketActive, bucketCursor} {
+		if err := rekey(tx, name, transportFor, step); err != nil {
+			return err
+		}
+	}
+	// Recent-message hashes only live for seconds; start them afresh (Init
+	// creates the bucket again).
+	if tx.Bucket(bucketMessages) == nil {
+		return nil
+	}
+	return tx.DeleteBucket(bucketMessages)
+}
+
+func rekey(tx *bolt.Tx, name []byte, transportFor func(string) string, step *MigrationStep) error {
+	b := tx.Bucket(name)
+	if b == nil {
+		return nil // predates this bucket
+	}
+	old, err := entries(b)
+	if err != nil {
+		return err
+	}
+	for _, e := range old {
+		if err := b.Delete(e.k); err != nil {
+			return err
+		}
+		t := transportFor(string(e.k))
+		if t == "" {
+			if err := hold(tx, name, e.k, e.v); err != nil {
+				return err
+			}
+			step.Notes = append(step.Notes, fmt.Sprintf("held %s/%s: no configured transport matches the sender; it moves back once one does", name, e.k))
+			continue
+		}
+		if err := b.Put([]byte(SenderKey(t, string(e.k)).String()), e.v); err != nil {
+			return err
+		}
+		step.Changed++
+	}
+	return nil
+}
+
+type entry struct{ k, v []byte }
+
+// entries copies out b's keys and values so b can be changed while they are
+// walked.
+func entries(b *bolt.Bucket) ([]entry, error) {
+	var out []entry
+	err := b.ForEach(func(k, v []byte) error {
+		if v != nil {
+			out = append(out, entry{append([]byte(nil), k...), append([]byte(nil), v...)})
+		}
+		return nil
+	})
+	return out, err
+}
+
+func hold(tx *bolt.Tx, name, k, v []byte) error {
+	held, err := tx.CreateBucketIfNotExists(bucketHeld)
+	if err != nil {
+		return err
+	}
+	b, err := held.CreateBucketIfNotExists(name)
+	if err != nil {
+		return err
+	}
+	return b.Put(k, v)
+}
+
+// ReleaseHeld moves keys migration 2 held back into place under the transport
+// transportFor now names for their sender, unless that key has been written
+// since. It returns how many keys were restored.
+func (s *Store) ReleaseHeld(transportFor func(string) string) (int, error) {
+	if transportFor == nil {
+		return 0, nil
+	}
+	var n int
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		held := tx.Bucket(bucketHeld)
+		if held == nil {
+			return nil
+		}
+		for _, name := range [][]byte{bucketActive, bucketCursor} {
+			hb := held.Bucket(name)
+			if hb == nil {
+				continue
+			}
+			old, err := entries(hb)
+			if err != nil {
+				return err
+			}
+			b, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+			for _, e := range old {
+				t := transportFor(string(e.k))
+				if t == "" {
+					continue
+				}
+				if err := hb.Delete(e.k); err != nil {
+					return err
+				}
+				key := []byte(SenderKey(t, string(e.k)).String())
+				if b.Get(key) != nil {
+					continue
+				}
+				if err := b.Put(key, e.v); err != nil {
+					return err
+				}
+				n++
+			}
+			if k, _ := hb.Cursor().First(); k == nil {
+				if err := held.DeleteBucket(name); err != nil {
+					return err
+				}
+			}
+		}
+		if k, _ := held.Cursor().First(); k == nil {
+			return tx.DeleteBucket(bucketHeld)
+		}
+		return nil
+	})
+	return n, err
+}
@@ -0,0 +1,160 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	bucketOutbox      = []byte("outbox")
+	bucketDeadLetters = []byte("dead_letters")
+)
+
+// OutboxEntry is an outbound message whose delivery failed and is awaiting retry,
+// or, once in the dead-letter bucket, has given up.
+type OutboxEntry struct {
+	ID          string         `json:"id"`
+	Transport   string         `json:"transport"`
+	Recipient   string         `json:"recipient"`
+	Text        string         `json:"text"`
+	ThreadID    string         `json:"thread_id"`
+	Meta        map[string]any `json:"meta,omitempty"`
+	Attachments []Attachment   `json:"attachments,omitempty"`
+	Attempts    int            `json:"attempts"`
+	LastError   string         `json:"last_error,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+	NextAttempt time.Time      `json:"next_attempt"`
+}
+
+// EnqueueOutbox stores e for retry and returns its id.
+func (s *Store) EnqueueOutbox(e OutboxEntry) (string, error) {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketOutbox)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		e.ID = fmt.Sprintf("%016x", seq)
+		if e.CreatedAt.IsZero() {
+			e.CreatedAt = time.Now().UTC()
+		}
+		return putJSON(b, e.ID, e)
+	})
+	return e.ID, err
+}
+
+// DueOutbox returns up to limit entries whose NextAttempt is not after now.
+func (s *Store) DueOutbox(now time.Time, limit int) ([]OutboxEntry, error) {
+	var out []OutboxEntry
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketOutbox).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var e OutboxEntry
+			if json.Unmarshal(v, &e) != nil || e.NextAttempt.After(now) {
+				continue
+			}
+			out = append(out, e)
+			if limit > 0 && len(out) >= limit {
+				break
+			}
+		}
+		return nil
+	})
+	return out, err
+}
+
+// PendingOutbox returns every outbox entry, due or not, oldest first.
+func (s *Store) PendingOutbox() ([]OutboxEntry, error) {
+	var out []OutboxEntry
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketOutbox).ForEach(func(k, v []byte) error {
+			var e OutboxEntry
+			if json.Unmarshal(v, &e) == nil {
+				out = append(out, e)
+			}
+			return nil
+		})
+	})
+	return out, err
+}
+
+// UpdateOutbox saves a retried entry (attempt count, error, next attempt).
+func (s *Store) UpdateOutbox(e OutboxEntry) error {
+	if e.ID == "" {
+		return errors.New("outbox id required")
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(bucketOutbox), e.ID, e)
+	})
+}
+
+// DeleteOutbox removes a delivered entry.
+func (s *Store) DeleteOutbox(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketOutbox).Delete([]byte(id))
+	})
+}
+
+// DeadLetter moves e from the outbox to the dead-letter bucket.
+func (s *Store) DeadLetter(e OutboxEntry) error {
+	if e.ID == "" {
+		return errors.New("outbox id required")
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(bucketOutbox).Delete([]byte(e.ID)); err != nil {
+			return err
+		}
+		return putJSON(tx.Bucket(bucketDeadLetters), e.ID, e)
+	})
+}
+
+// DeadLetters lists messages that exhausted their retries, oldest first.
+func (s *Store) DeadLetters() ([]OutboxEntry, error) {
+	var out []OutboxEntry
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketDeadLetters).ForEach(func(k, v []byte) error {
+			var e OutboxEntry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return nil // skip corrupt entries
+			}
+			out = append(out, e)
+			return nil
+		})
+	})
+	return out, err
+}
+
+// ReplayDeadLetter moves a dead letter back into the outbox with a fresh attempt
+// budget, due immediately.
+func (s *Store) ReplayDeadLetter(id string) (OutboxEntry, error) {
+	var e OutboxEntry
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		dead := tx.Bucket(bucketDeadLetters)
+		v := dead.Get([]byte(id))
+		if v == nil {
+			return fmt.Errorf("dead letter %s not found", id)
+		}
+		if err := json.Unmarshal(v, &e); err != nil {
+			return err
+		}
+		e.Attempts = 0
+		e.NextAttempt = time.Now().UTC()
+		if err := dead.Delete([]byte(id)); err != nil {
+			return err
+		}
+		return putJSON(tx.Bucket(bucketOutbox), e.ID, e)
+	})
+	return e, err
+}
+
+func putJSON(b *bolt.Bucket, key string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(key), data)
+}
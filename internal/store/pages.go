@@ -0,0 +1,68 @@
+package store
+
+import (
+	"encoding/json"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var bucketPages = []byte("pages")
+
+// SavePages replaces the unsent reply parts kept for a conversation. An empty
+// slice clears them.
+func (s *Store) SavePages(key Key, parts []string) error {
+	k, err := key.bytes()
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketPages)
+		if len(parts) == 0 {
+			return b.Delete(k)
+		}
+		data, err := json.Marshal(parts)
+		if err != nil {
+			return err
+		}
+		return b.Put(k, data)
+	})
+}
+
+// NextPages removes and returns up to n stored parts for a conversation along with
+// the number of parts still left.
+func (s *Store) NextPages(key Key, n int) ([]string, int, error) {
+	k, err := key.bytes()
+	if err != nil {
+		return nil, 0, err
+	}
+	if n <= 0 {
+		n = 1
+	}
+	var out []string
+	var left int
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketPages)
+		v := b.Get(k)
+		if v == nil {
+			return nil
+		}
+		var parts []string
+		if err := json.Unmarshal(v, &parts); err != nil {
+			return err
+		}
+		if n > len(parts) {
+			n = len(parts)
+		}
+		out, parts = parts[:n], parts[n:]
+		left = len(parts)
+		if left == 0 {
+			return b.Delete(k)
+		}
+		data, err := json.Marshal(parts)
+		if err != nil {
+			return err
+		}
+		return b.Put(k, data)
+	})
+	return out, left, err
+}
@@ -0,0 +1,52 @@
+package store
+
+import (
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var bucketPrefs = []byte("sender_prefs")
+
+// SenderPrefs holds per-sender choices made with chat commands.
+type SenderPrefs struct {
+	Agent     string    `json:"agent,omitempty"`   // /agent override; empty means use routes
+	Project   string    `json:"project,omitempty"` // active project ID
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SenderPrefs returns the stored preferences for key.
+func (s *Store) SenderPrefs(key Key) (SenderPrefs, bool, error) {
+	var p SenderPrefs
+	var found bool
+	k, err := key.bytes()
+	if err != nil {
+		return p, false, err
+	}
+	err = s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucketPrefs).Get(k)
+		if v == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(v, &p)
+	})
+	return p, found, err
+}
+
+// SaveSenderPrefs stores preferences for key.
+func (s *Store) SaveSenderPrefs(key Key, p SenderPrefs) error {
+	k, err := key.bytes()
+	if err != nil {
+		return err
+	}
+	p.UpdatedAt = time.Now().UTC()
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketPrefs).Put(k, data)
+	})
+}
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var bucketInbound = []byte("inbound_queue")
+
+// Inbound queue states.
+const (
+	InboundPending = "pending" // received, not started
+	InboundRunning = "running" // being handled; still here after a crash means interrupted
+)
+
+// Attachment references a spooled file carried by a queued or outbound message.
+// It mirrors core.Attachment.
+type Attachment struct {
+	Name     string `json:"name"`
+	MIMEType string `json:"mime_type,omitempty"`
+	Size     int64  `json:"size"`
+	Path     string `json:"path"`
+}
+
+// QueuedMessage is an inbound message persisted until the runner has handled it.
+type QueuedMessage struct {
+	ID          string         `json:"id"`
+	Transport   string         `json:"transport"`
+	Sender      string         `json:"sender"`
+	Text        string         `json:"text"`
+	ThreadID    string         `json:"thread_id"`
+	Meta        map[string]any `json:"meta,omitempty"`
+	Attachments []Attachment   `json:"attachments,omitempty"`
+	State       string         `json:"state"`
+	Attempts    int            `json:"attempts"`
+	EnqueuedAt  time.Time      `json:"enqueued_at"`
+	// DedupeKey, when set, is recorded as seen (see RecordInbound) in the same
+	// transaction that queues the message, so a message is never marked seen
+	// without being queued.
+	DedupeKey string    `json:"dedupe_key,omitempty"`
+	StartedAt time.Time `json:"started_at,omitempty"`
+}
+
+// EnqueueInbound persists m as pending and returns its id. Ids sort in arrival order.
+func (s *Store) EnqueueInbound(m QueuedMessage) (string, error) {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketInbound)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		m.ID = fmt.Sprintf("%016x", seq)
+		m.State = InboundPending
+		if m.EnqueuedAt.IsZero() {
+			m.EnqueuedAt = time.Now().UTC()
+		}
+		data, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte(m.ID), data); err != nil {
+			return err
+		}
+		if m.DedupeKey == "" {
+			return nil
+		}
+		return recordInbound(tx, m.DedupeKey)
+	})
+	return m.ID, err
+}
+
+// MarkInboundRunning flags a queued message as in progress and counts the attempt.
+func (s *Store) MarkInboundRunning(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketInbound)
+		v := b.Get([]byte(id))
+		if v == nil {
+			return errors.New("queued message not found")
+		}
+		var m QueuedMessage
+		if err := json.Unmarshal(v, &m); err != nil {
+			return err
+		}
+		m.State = InboundRunning
+		m.Attempts++
+		m.StartedAt = time.Now().UTC()
+		data, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(id), data)
+	})
+}
+
+// CompleteInbound removes a handled message from the queue.
+func (s *Store) CompleteInbound(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketInbound).Delete([]byte(id))
+	})
+}
+
+// PendingInbound lists queued messages, oldest first.
+func (s *Store) PendingInbound() ([]QueuedMessage, error) {
+	var out []QueuedMessage
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketInbound).ForEach(func(k, v []byte) error {
+			var m QueuedMessage
+			if err := json.Unmarshal(v, &m); err != nil {
+				return nil // skip corrupt entries
+			}
+			out = append(out, m)
+			return nil
+		})
+	})
+	return out, err
+}
@@ -0,0 +1,167 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// SchemaVersion is the state DB layout this build reads and writes. Any change
+// to a bucket, key or value format bumps it and appends to migrations.
+const SchemaVersion = 2
+
+var (
+	bucketMeta        = []byte("meta")
+	metaSchemaVersion = []byte("schema_version")
+	// metaKeyFormat marked databases already on structured keys before the
+	// schema version existed; it reads as version 2.
+	metaKeyFormat = []byte("key_format")
+)
+
+// ErrSchemaTooNew reports a state DB written by a newer build.
+var ErrSchemaTooNew = errors.New("state DB schema is newer than this build")
+
+// ErrSchemaOutdated reports a state DB that needs Migrate before use.
+var ErrSchemaOutdated = errors.New("state DB schema is older than this build; run buddy state migrate")
+
+// Migration upgrades the state DB from Version-1 to Version. Apply runs inside
+// the migration's write transaction and records what it changed in step.
+type Migration struct {
+	Version     int
+	Description string
+	Apply       func(tx *bolt.Tx, env MigrationEnv, step *MigrationStep) error
+}
+
+// MigrationEnv carries what migrations need to know beyond the DB itself.
+type MigrationEnv struct {
+	// TransportFor names the transport ID a legacy bare sender belongs to, or
+	// "" when unknown.
+	TransportFor func(sender string) string
+}
+
+// migrations is the ordered registry. Version 1 is the unversioned layout
+// that predates it; entry i upgrades to version i+2.
+var migrations = []Migration{
+	{Version: 2, Description: "key state by transport, sender and thread", Apply: migrateKeys},
+}
+
+// MigrationStep is what one migration changed (or would change).
+type MigrationStep struct {
+	Version     int
+	Description string
+	Changed     int      // keys rewritten
+	Notes       []string // e.g. keys dropped because they could not be converted
+}
+
+// MigrationReport summarizes a Migrate call.
+type MigrationReport struct {
+	From, To int
+	DryRun   bool
+	Backup   string // snapshot taken before migrating; empty when nothing ran
+	Steps    []MigrationStep
+}
+
+// Pending reports whether the DB was (or, on a dry run, would be) migrated.
+func (r MigrationReport) Pending() bool { return r.From < r.To }
+
+// errDryRun rolls back a dry-run transaction.
+var errDryRun = errors.New("dry run")
+
+// Version returns the schema version the DB is on.
+func (s *Store) Version() (int, error) {
+	var v int
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		v, err = schemaVersion(tx)
+		return err
+	})
+	return v, err
+}
+
+// schemaVersion reads the recorded version. A database without buckets is new
+// and has nothing to migrate.
+func schemaVersion(tx *bolt.Tx) (int, error) {
+	meta := tx.Bucket(bucketMeta)
+	if meta == nil {
+		if name, _ := tx.Cursor().First(); name == nil {
+			return SchemaVersion, nil
+		}
+		return 1, nil
+	}
+	if raw := meta.Get(metaSchemaVersion); raw != nil {
+		v, err := strconv.Atoi(string(raw))
+		if err != nil || v < 1 {
+			return 0, fmt.Errorf("invalid state DB schema version %q", raw)
+		}
+		return v, nil
+	}
+	if string(meta.Get(metaKeyFormat)) == "2" {
+		return 2, nil
+	}
+	return 1, nil
+}
+
+func setSchemaVersion(tx *bolt.Tx, v int) error {
+	meta, err := tx.CreateBucketIfNotExists(bucketMeta)
+	if err != nil {
+		return err
+	}
+	if err := meta.Delete(metaKeyFormat); err != nil {
+		return err
+	}
+	return meta.Put(metaSchemaVersion, []byte(strconv.Itoa(v)))
+}
+
+// Migrate runs the pending migrations in order, in one transaction, and
+// records SchemaVersion. Before changing anything it copies the DB to a
+// snapshot next to it ("<path>.v<from>-<timestamp>.bak"). With dryRun the
+// migrations run and are rolled back, so the report shows what would change
+// and the DB is left untouched.
+func (s *Store) Migrate(env MigrationEnv, dryRun bool) (MigrationReport, error) {
+	rep := MigrationReport{To: SchemaVersion, DryRun: dryRun}
+	from, err := s.Version()
+	if err != nil {
+		return rep, err
+	}
+	rep.From = from
+	if from > SchemaVersion {
+		return rep, fmt.Errorf("%w: v%d, supported v%d", ErrSchemaTooNew, from, SchemaVersion)
+	}
+	if from == SchemaVersion {
+		return rep, nil
+	}
+	if !dryRun {
+		rep.Backup = fmt.Sprintf("%s.v%d-%s.bak", s.db.Path(), from, time.Now().UTC().Format("20060102T150405"))
+		if err := s.db.View(func(tx *bolt.Tx) error {
+			return tx.CopyFile(rep.Backup, 0o600)
+		}); err != nil {
+			return rep, fmt.Errorf("backup state DB: %w", err)
+		}
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		for _, m := range migrations {
+			if m.Version <= from {
+				continue
+			}
+			step := MigrationStep{Version: m.Version, Description: m.Description}
+			if err := m.Apply(tx, env, &step); err != nil {
+				return fmt.Errorf("migration %d (%s): %w", m.Version, m.Description, err)
+			}
+			rep.Steps = append(rep.Steps, step)
+		}
+		if err := setSchemaVersion(tx, SchemaVersion); err != nil {
+			return err
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if errors.Is(err, errDryRun) {
+		err = nil
+	}
+	return rep, err
+}
@@ -0,0 +1,156 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestMigrationRegistryOrdered(t *testing.T) {
+	for i, m := range migrations {
+		if m.Version != i+2 || m.Description == "" || m.Apply == nil {
+			t.Fatalf("migration %d malformed: %+v", i, m)
+		}
+	}
+	if got := migrations[len(migrations)-1].Version; got != SchemaVersion {
+		t.Fatalf("last migration is v%d, SchemaVersion is %d", got, SchemaVersion)
+	}
+}
+
+func TestNewStoreRecordsSchemaVersion(t *testing.T) {
+	st, cleanup := newTempStore(t)
+	defer cleanup()
+	if v, err := st.Version(); err != nil || v != SchemaVersion {
+		t.Fatalf("fresh store at v%d, %v", v, err)
+	}
+}
+
+func TestMigrateDryRunChangesNothing(t *testing.T) {
+	st := legacyStore(t, map[string]map[string]string{
+		"active_sessions": {"+15550001": `{"session_id":"s1"}`},
+	})
+	env := MigrationEnv{TransportFor: func(string) string { return "whatsapp" }}
+	rep, err := st.Migrate(env, true)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if !rep.DryRun || rep.From != 1 || rep.To != SchemaVersion || rep.Backup != "" || len(rep.Steps) != 1 || rep.Steps[0].Changed != 1 {
+		t.Fatalf("unexpected report %+v", rep)
+	}
+	if v, _ := st.Version(); v != 1 {
+		t.Fatalf("dry run recorded v%d", v)
+	}
+	if _, ok, _ := st.Active(SenderKey("whatsapp", "+15550001")); ok {
+		t.Fatalf("dry run rewrote keys")
+	}
+	if matches, _ := filepath.Glob(st.db.Path() + ".*.bak"); len(matches) != 0 {
+		t.Fatalf("dry run took a backup: %v", matches)
+	}
+}
+
+func TestMigrateTakesBackup(t *testing.T) {
+	st := legacyStore(t, map[string]map[string]string{
+		"active_sessions": {"+15550001": `{"session_id":"s1"}`},
+	})
+	rep, err := st.Migrate(MigrationEnv{TransportFor: func(string) string { return "whatsapp" }}, false)
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if v, _ := st.Version(); v != SchemaVersion {
+		t.Fatalf("migrated store at v%d", v)
+	}
+	if filepath.Dir(rep.Backup) != filepath.Dir(st.db.Path()) {
+		t.Fatalf("backup %q not next to the DB", rep.Backup)
+	}
+	backup, err := bolt.Open(rep.Backup, 0o600, nil)
+	if err != nil {
+		t.Fatalf("open backup: %v", err)
+	}
+	defer backup.Close()
+	_ = backup.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(bucketActive).Get([]byte("+15550001")) == nil {
+			t.Fatalf("backup does not hold the pre-migration data")
+		}
+		return nil
+	})
+}
+
+func TestNewRefusesNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	st, err := New(path)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	_ = st.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketMeta).Put(metaSchemaVersion, []byte(strconv.Itoa(SchemaVersion+1)))
+	})
+	_ = st.Close()
+	if _, err := New(path); !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("expected ErrSchemaTooNew, got %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("db removed: %v", err)
+	}
+}
+
+// closedLegacyDB writes a v1 DB that predates the inbound_seen bucket and
+// returns its path.
+func closedLegacyDB(t *testing.T) string {
+	t.Helper()
+	st := legacyStore(t, map[string]map[string]string{
+		"active_sessions": {"+15550001": `{"session_id":"s1"}`},
+	})
+	path := st.db.Path()
+	if err := st.db.Update(func(tx *bolt.Tx) error { return tx.DeleteBucket(bucketInboundSeen) }); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	_ = st.Close()
+	return path
+}
+
+func TestOpenLeavesLegacyDBUntouched(t *testing.T) {
+	path := closedLegacyDB(t)
+	if _, err := New(path); !errors.Is(err, ErrSchemaOutdated) {
+		t.Fatalf("expected ErrSchemaOutdated, got %v", err)
+	}
+	st, err := Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer st.Close()
+	env := MigrationEnv{TransportFor: func(string) string { return "whatsapp" }}
+	if _, err := st.Migrate(env, true); err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	hasSeen := func(db *bolt.DB) bool {
+		var ok bool
+		_ = db.View(func(tx *bolt.Tx) error { ok = tx.Bucket(bucketInboundSeen) != nil; return nil })
+		return ok
+	}
+	if hasSeen(st.db) {
+		t.Fatalf("open or dry run created buckets")
+	}
+
+	rep, err := st.Migrate(env, false)
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	backup, err := bolt.Open(rep.Backup, 0o600, nil)
+	if err != nil {
+		t.Fatalf("open backup: %v", err)
+	}
+	defer backup.Close()
+	if hasSeen(backup) {
+		t.Fatalf("backup holds buckets the previous build never wrote")
+	}
+	if err := st.Init(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	if !hasSeen(st.db) {
+		t.Fatalf("init did not create buckets")
+	}
+}
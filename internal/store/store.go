@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -35,8 +36,33 @@ type Store struct {
 	db *bolt.DB
 }
 
-// New opens (or creates) the database at the given path.
+// buckets are the buckets Init creates.
+var buckets = [][]byte{
+	bucketActive, bucketCursor, bucketProcessed, bucketMessages, bucketHistory, bucketAudit,
+	bucketApprovals, bucketPages, bucketLimits, bucketInbound, bucketOutbox, bucketDeadLetters,
+	bucketPrefs, bucketInboundSeen,
+}
+
+// New opens (or creates) the database at the given path and readies it for
+// use; see Open and Init. A database on an older schema is refused: open it
+// with Open, Migrate it, then Init it.
 func New(path string) (*Store, error) {
+	s, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Init(); err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Open opens the database at the given path, creating an empty one if it is
+// missing, without writing to an existing one, so the schema version can be
+// read, a dry run reported and a backup taken before anything changes. A
+// database from a newer build is refused.
+func Open(path string) (*Store, error) {
 	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
 		return nil, err
 	}
@@ -44,25 +70,13 @@ func New(path string) (*Store, error) {
 	if err != nil {
 		return nil, err
 	}
-
-	err = db.Update(func(tx *bolt.Tx) error {
-		if _, err := tx.CreateBucketIfNotExists(bucketActive); err != nil {
-			return err
-		}
-		if _, err := tx.CreateBucketIfNotExists(bucketCursor); err != nil {
-			return err
-		}
-		if _, err := tx.CreateBucketIfNotExists(bucketProcessed); err != nil {
-			return err
-		}
-		if _, err := tx.CreateBucketIfNotExists(bucketMessages); err != nil {
-			return err
-		}
-		if _, err := tx.CreateBucketIfNotExists(bucketHistory); err != nil {
+	err = db.View(func(tx *bolt.Tx) error {
+		v, err := schemaVersion(tx)
+		if err != nil {
 			return err
 		}
-		if _, err := tx.CreateBucketIfNotExists(bucketAudit); err != nil {
-			return err
+		if v > SchemaVersion {
+			return fmt.Errorf("%w: v%d, supported v%d", ErrSchemaTooNew, v, SchemaVersion)
 		}
 		return nil
 	})
@@ -73,6 +87,27 @@ func New(path string) (*Store, error) {
 	return &Store{db: db}, nil
 }
 
+// Init creates the buckets and records SchemaVersion on a new database. It
+// refuses a database that still needs Migrate, so buckets are only added to
+// the current layout.
+func (s *Store) Init() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		v, err := schemaVersion(tx)
+		if err != nil {
+			return err
+		}
+		if v < SchemaVersion {
+			return fmt.Errorf("%w: v%d, current v%d", ErrSchemaOutdated, v, SchemaVersion)
+		}
+		for _, name := range buckets {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return setSchemaVersion(tx, SchemaVersion)
+	})
+}
+
 // Close releases the underlying DB handle.
 func (s *Store) Close() error {
 	if s == nil || s.db == nil {
@@ -81,31 +116,43 @@ func (s *Store) Close() error {
 	return s.db.Close()
 }
 
-// SaveActive stores the active session for a given sender pubkey.
-func (s *Store) SaveActive(pubkey, sessionID string) error {
+// SaveActive stores the active session for a conversation.
+func (s *Store) SaveActive(key Key, sessionID string) error {
+	k, err := key.bytes()
+	if err != nil {
+		return err
+	}
 	st := SessionState{SessionID: sessionID, UpdatedAt: time.Now().UTC()}
 	data, err := json.Marshal(st)
 	if err != nil {
 		return err
 	}
 	return s.db.Update(func(tx *bolt.Tx) error {
-		return tx.Bucket(bucketActive).Put([]byte(pubkey), data)
+		return tx.Bucket(bucketActive).Put(k, data)
 	})
 }
 
-// ClearActive removes the active session for a sender.
-func (s *Store) ClearActive(pubkey string) error {
+// ClearActive removes the active session for a conversation.
+func (s *Store) ClearActive(key Key) error {
+	k, err := key.bytes()
+	if err != nil {
+		return err
+	}
 	return s.db.Update(func(tx *bolt.Tx) error {
-		return tx.Bucket(bucketActive).Delete([]byte(pubkey))
+		return tx.Bucket(bucketActive).Delete(k)
 	})
 }
 
-// Active returns the session state for a sender, if present.
-func (s *Store) Active(pubkey string) (SessionState, bool, error) {
+// Active returns the session state for a conversation, if present.
+func (s *Store) Active(key Key) (SessionState, bool, error) {
 	var st SessionState
-	err := s.db.View(func(tx *bolt.Tx) error {
+	k, err := key.bytes()
+	if err != nil {
+		return st, false, err
+	}
+	err = s.db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket(bucketActive)
-		data := b.Get([]byte(pubkey))
+		data := b.Get(k)
 		if data == nil {
 			return nil
 		}
@@ -124,11 +171,15 @@ func (s *Store) Active(pubkey string) (SessionState, bool, error) {
 }
 
 // LastCursor returns the last event timestamp we processed for this sender.
-func (s *Store) LastCursor(pubkey string) (time.Time, error) {
+func (s *Store) LastCursor(key Key) (time.Time, error) {
 	var ts time.Time
-	err := s.db.View(func(tx *bolt.Tx) error {
+	k, err := key.bytes()
+	if err != nil {
+		return ts, err
+	}
+	err = s.db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket(bucketCursor)
-		v := b.Get([]byte(pubkey))
+		v := b.Get(k)
 		if v == nil {
 			ts = time.Time{}
 			return nil
@@ -145,27 +196,14 @@ func (s *Store) LastCursor(pubkey string) (time.Time, error) {
 }
 
 // SaveCursor persists the last event timestamp for a sender.
-func (s *Store) SaveCursor(pubkey string, t time.Time) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
-		return tx.Bucket(bucketCursor).Put([]byte(pubkey), []byte(t.UTC().Format(time.RFC3339Nano)))
-	})
-}
-
-// AlreadyProcessed checks if we've handled an event ID; if not, it marks it processed.
-func (s *Store) AlreadyProcessed(id string) (bool, error) {
-	if id == "" {
-		return false, errors.New("empty event id")
+func (s *Store) SaveCursor(key Key, t time.Time) error {
+	k, err := key.bytes()
+	if err != nil {
+		return err
 	}
-	var existed bool
-	err := s.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket(bucketProcessed)
-		if v := b.Get([]byte(id)); v != nil {
-			existed = true
-			return nil
-		}
-		return b.Put([]byte(id), []byte{1})
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketCursor).Put(k, []byte(t.UTC().Format(time.RFC3339Nano)))
 	})
-	return existed, err
 }
 
 // MarkProcessed marks an event ID as processed without checking existence.
@@ -178,45 +216,81 @@ func (s *Store) MarkProcessed(id string) error {
 	})
 }
 
-// RecentMessageSeen returns true if the same sender/plaintext was seen within the window.
-// It also records the current occurrence.
-func (s *Store) RecentMessageSeen(sender, plaintext string, window time.Duration) (bool, error) {
+// Processed reports whether an event ID has been marked processed, without
+// marking it.
+func (s *Store) Processed(id string) (bool, error) {
+	if id == "" {
+		return false, errors.New("empty event id")
+	}
+	var existed bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		existed = tx.Bucket(bucketProcessed).Get([]byte(id)) != nil
+		return nil
+	})
+	return existed, err
+}
+
+// MessageSeen reports whether the same sender/plaintext was recorded within
+// the window, without recording it; callers record it with RecordMessage once
+// the message has been handed off.
+func (s *Store) MessageSeen(sender Key, plaintext string, window time.Duration) (bool, error) {
+	return s.recentMessage(sender, plaintext, window, false)
+}
+
+// RecordMessage records an occurrence of plaintext from sender for
+// MessageSeen.
+func (s *Store) RecordMessage(sender Key, plaintext string) error {
+	_, err := s.recentMessage(sender, plaintext, 0, true)
+	return err
+}
+
+func (s *Store) recentMessage(sender Key, plaintext string, window time.Duration, record bool) (bool, error) {
 	if window <= 0 {
 		window = 30 * time.Second
 	}
-	sender = strings.ToLower(strings.TrimSpace(sender))
+	sender.Sender = strings.ToLower(strings.TrimSpace(sender.Sender))
+	if sender.IsZero() {
+		return false, errEmptyKey
+	}
 	body := strings.TrimSpace(plaintext)
 	h := sha256.Sum256([]byte(body))
-	key := sender + ":" + hex.EncodeToString(h[:])
+	key := sender.String() + "#" + hex.EncodeToString(h[:])
 	now := time.Now().UTC()
 
 	var seen bool
-	err := s.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket(bucketMessages)
-		v := b.Get([]byte(key))
-		if v != nil {
-			if ts, err := time.Parse(time.RFC3339Nano, string(v)); err == nil {
-				if now.Sub(ts) < window {
-					seen = true
-				}
+	check := func(b *bolt.Bucket) {
+		if v := b.Get([]byte(key)); v != nil {
+			if ts, err := time.Parse(time.RFC3339Nano, string(v)); err == nil && now.Sub(ts) < window {
+				seen = true
 			}
 		}
+	}
+	if !record {
+		err := s.db.View(func(tx *bolt.Tx) error {
+			check(tx.Bucket(bucketMessages))
+			return nil
+		})
+		return seen, err
+	}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketMessages)
+		check(b)
 		return b.Put([]byte(key), []byte(now.Format(time.RFC3339Nano)))
 	})
 	return seen, err
 }
 
 // AppendHistory appends a turn to the history for a thread, trimming to maxEntries.
-func (s *Store) AppendHistory(threadID string, turn json.RawMessage, maxEntries int) error {
-	if threadID == "" {
-		return errors.New("thread id required")
+func (s *Store) AppendHistory(thread Key, turn json.RawMessage, maxEntries int) error {
+	key, err := thread.bytes()
+	if err != nil {
+		return err
 	}
 	if maxEntries <= 0 {
 		maxEntries = 50
 	}
 	return s.db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket(bucketHistory)
-		key := []byte(threadID)
 		var entries []json.RawMessage
 		if v := b.Get(key); v != nil {
 			_ = json.Unmarshal(v, &entries)
@@ -234,16 +308,17 @@ func (s *Store) AppendHistory(threadID string, turn json.RawMessage, maxEntries
 }
 
 // History returns up to maxEntries of the thread history.
-func (s *Store) History(threadID string, maxEntries int) ([]json.RawMessage, error) {
-	if threadID == "" {
-		return nil, errors.New("thread id required")
+func (s *Store) History(thread Key, maxEntries int) ([]json.RawMessage, error) {
+	key, err := thread.bytes()
+	if err != nil {
+		return nil, err
 	}
 	if maxEntries <= 0 {
 		maxEntries = 50
 	}
 	var entries []json.RawMessage
-	err := s.db.View(func(tx *bolt.Tx) error {
-		if v := tx.Bucket(bucketHistory).Get([]byte(threadID)); v != nil {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(bucketHistory).Get(key); v != nil {
 			_ = json.Unmarshal(v, &entries)
 			if len(entries) > maxEntries {
 				entries = entries[len(entries)-maxEntries:]
@@ -254,6 +329,17 @@ func (s *Store) History(threadID string, maxEntries int) ([]json.RawMessage, err
 	return entries, err
 }
 
+// ClearHistory drops all stored turns for a thread.
+func (s *Store) ClearHistory(thread Key) error {
+	key, err := thread.bytes()
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketHistory).Delete(key)
+	})
+}
+
 // AppendAudit records an action execution entry.
 func (s *Store) AppendAudit(action, sender, outcome string, dur time.Duration) error {
 	maxEntries := auditMaxEntries
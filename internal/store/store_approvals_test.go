@@ -0,0 +1,32 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPendingApprovalLifecycle(t *testing.T) {
+	st, cleanup := newTempStore(t)
+	defer cleanup()
+
+	now := time.Now().UTC()
+	if err := st.SavePendingApproval(PendingApproval{ID: "old", ExpiresAt: now.Add(-time.Minute)}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if err := st.SavePendingApproval(PendingApproval{ID: "abc", Action: "shell", Sender: "alice", ExpiresAt: now.Add(time.Minute)}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if _, ok, _ := st.TakePendingApproval("old"); ok {
+		t.Fatalf("expired approval should be purged on save")
+	}
+	p, ok, err := st.TakePendingApproval("abc")
+	if err != nil || !ok || p.Action != "shell" || p.Expired(time.Now()) {
+		t.Fatalf("unexpected take %+v ok=%v err=%v", p, ok, err)
+	}
+	if _, ok, _ := st.TakePendingApproval("abc"); ok {
+		t.Fatalf("approval should only be taken once")
+	}
+	if err := st.SavePendingApproval(PendingApproval{}); err == nil {
+		t.Fatalf("expected id validation error")
+	}
+}
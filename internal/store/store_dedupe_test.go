@@ -0,0 +1,45 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInboundSeenTTLAndPrune(t *testing.T) {
+	st, cleanup := newTempStore(t)
+	defer cleanup()
+
+	if seen, err := st.InboundSeen("whatsapp:SM1", time.Hour); err != nil || seen {
+		t.Fatalf("first sighting reported seen=%v err=%v", seen, err)
+	}
+	if seen, _ := st.InboundSeen("whatsapp:SM1", time.Hour); seen {
+		t.Fatalf("checking recorded the key")
+	}
+	if err := st.RecordInbound("whatsapp:SM1"); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	if seen, _ := st.InboundSeen("whatsapp:SM1", time.Hour); !seen {
+		t.Fatalf("redelivery not detected")
+	}
+	if seen, _ := st.InboundSeen("whatsapp:SM1", 0); seen {
+		t.Fatalf("expired key still reported seen")
+	}
+	if n, err := st.PruneInbound(time.Now().Add(time.Minute)); err != nil || n != 1 {
+		t.Fatalf("prune removed %d, err=%v", n, err)
+	}
+	if seen, _ := st.InboundSeen("whatsapp:SM1", time.Hour); seen {
+		t.Fatalf("pruned key still reported seen")
+	}
+}
+
+func TestEnqueueInboundRecordsDedupeKey(t *testing.T) {
+	st, cleanup := newTempStore(t)
+	defer cleanup()
+
+	if _, err := st.EnqueueInbound(QueuedMessage{Transport: "whatsapp", Sender: "+1", Text: "hi", DedupeKey: "whatsapp:SM1"}); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	if seen, _ := st.InboundSeen("whatsapp:SM1", time.Hour); !seen {
+		t.Fatalf("queued message not recorded as seen")
+	}
+}
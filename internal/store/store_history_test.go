@@ -6,23 +6,34 @@ import (
 	"time"
 )
 
+var (
+	thread = Key{Transport: "email", Thread: "<root@example.com>"}
+	alice  = SenderKey("nostr", "alice")
+)
+
 func TestHistoryAppendAndTrim(t *testing.T) {
 	st, cleanup := newTempStore(t)
 	defer cleanup()
 
 	for i := 0; i < 5; i++ {
 		b, _ := json.Marshal(i)
-		if err := st.AppendHistory("thread", b, 3); err != nil {
+		if err := st.AppendHistory(thread, b, 3); err != nil {
 			t.Fatalf("append err: %v", err)
 		}
 	}
-	entries, err := st.History("thread", 10)
+	entries, err := st.History(thread, 10)
 	if err != nil {
 		t.Fatalf("history err: %v", err)
 	}
 	if len(entries) != 3 {
 		t.Fatalf("expected 3 entries, got %d", len(entries))
 	}
+	if err := st.ClearHistory(thread); err != nil {
+		t.Fatalf("clear history: %v", err)
+	}
+	if entries, _ := st.History(thread, 10); len(entries) != 0 {
+		t.Fatalf("expected cleared history, got %d entries", len(entries))
+	}
 }
 
 func TestAuditAppend(t *testing.T) {
@@ -50,27 +61,25 @@ func TestAuditAppend(t *testing.T) {
 	}
 }
 
-func TestAlreadyProcessedAndRecentMessage(t *testing.T) {
+func TestProcessedAndMessageSeenDoNotMark(t *testing.T) {
 	st, cleanup := newTempStore(t)
 	defer cleanup()
 
-	if seen, err := st.AlreadyProcessed("e1"); err != nil || seen {
-		t.Fatalf("first seen unexpected: %v %v", seen, err)
-	}
-	if seen, _ := st.AlreadyProcessed("e1"); !seen {
-		t.Fatalf("second should be seen")
-	}
-	if err := st.MarkProcessed("e2"); err != nil {
-		t.Fatalf("mark processed: %v", err)
+	for i := 0; i < 2; i++ {
+		if seen, err := st.Processed("e1"); err != nil || seen {
+			t.Fatalf("check %d marked the event: %v %v", i, seen, err)
+		}
+		if seen, err := st.MessageSeen(alice, "hello", time.Minute); err != nil || seen {
+			t.Fatalf("check %d recorded the message: %v %v", i, seen, err)
+		}
 	}
-
-	seen, err := st.RecentMessageSeen("alice", "hello", time.Minute)
-	if err != nil || seen {
-		t.Fatalf("first recent should be false")
+	_ = st.MarkProcessed("e1")
+	_ = st.RecordMessage(alice, "hello")
+	if seen, _ := st.Processed("e1"); !seen {
+		t.Fatalf("marked event not reported")
 	}
-	seen, _ = st.RecentMessageSeen("alice", "hello", time.Minute)
-	if !seen {
-		t.Fatalf("second recent should be true")
+	if seen, _ := st.MessageSeen(alice, "hello", time.Minute); !seen {
+		t.Fatalf("recorded message not reported")
 	}
 }
 
@@ -89,10 +98,10 @@ func TestCursorSaveAndLoad(t *testing.T) {
 	defer cleanup()
 
 	now := time.Now().UTC().Truncate(time.Millisecond)
-	if err := st.SaveCursor("alice", now); err != nil {
+	if err := st.SaveCursor(alice, now); err != nil {
 		t.Fatalf("save cursor: %v", err)
 	}
-	got, err := st.LastCursor("alice")
+	got, err := st.LastCursor(alice)
 	if err != nil {
 		t.Fatalf("last cursor: %v", err)
 	}
@@ -105,19 +114,19 @@ func TestActiveLifecycle(t *testing.T) {
 	st, cleanup := newTempStore(t)
 	defer cleanup()
 
-	if _, ok, err := st.Active("alice"); err != nil || ok {
+	if _, ok, err := st.Active(alice); err != nil || ok {
 		t.Fatalf("expected no active session")
 	}
-	if err := st.SaveActive("alice", "sess1"); err != nil {
+	if err := st.SaveActive(alice, "sess1"); err != nil {
 		t.Fatalf("save active: %v", err)
 	}
-	if stt, ok, err := st.Active("alice"); err != nil || !ok || stt.SessionID != "sess1" {
+	if stt, ok, err := st.Active(alice); err != nil || !ok || stt.SessionID != "sess1" {
 		t.Fatalf("unexpected active %+v ok=%v err=%v", stt, ok, err)
 	}
-	if err := st.ClearActive("alice"); err != nil {
+	if err := st.ClearActive(alice); err != nil {
 		t.Fatalf("clear active: %v", err)
 	}
-	if _, ok, _ := st.Active("alice"); ok {
+	if _, ok, _ := st.Active(alice); ok {
 		t.Fatalf("expected cleared session")
 	}
 }
@@ -126,19 +135,19 @@ func TestHistoryValidationAndProcessedErrors(t *testing.T) {
 	st, cleanup := newTempStore(t)
 	defer cleanup()
 
-	if err := st.AppendHistory("", json.RawMessage(`{}`), 0); err == nil {
+	if err := st.AppendHistory(Key{}, json.RawMessage(`{}`), 0); err == nil {
 		t.Fatalf("expected thread id error")
 	}
-	if _, err := st.History("", 1); err == nil {
+	if _, err := st.History(Key{}, 1); err == nil {
 		t.Fatalf("expected history validation error")
 	}
-	if _, err := st.AlreadyProcessed(""); err == nil {
+	if _, err := st.Processed(""); err == nil {
 		t.Fatalf("expected error on empty id")
 	}
 	if err := st.MarkProcessed(""); err == nil {
 		t.Fatalf("expected error on empty id")
 	}
-	if seen, err := st.RecentMessageSeen("bob", "hi", 0); err != nil || seen {
+	if seen, err := st.MessageSeen(SenderKey("nostr", "bob"), "hi", 0); err != nil || seen {
 		t.Fatalf("recent message with default window should be false")
 	}
 }
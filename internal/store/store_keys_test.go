@@ -0,0 +1,141 @@
+package store
+
+import (
+	"strings"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestKeyRoundTrip(t *testing.T) {
+	keys := []Key{
+		SenderKey("whatsapp", "+15550001"),
+		{Transport: "email", Thread: "<root/1@example.com>"},
+		{Transport: "email", Sender: "a@x", Thread: "<r@x>", Agent: "quick"},
+		UserKey("alice"),
+	}
+	for _, k := range keys {
+		got, err := ParseKey(k.String())
+		if err != nil || got != k {
+			t.Fatalf("round trip %+v: got %+v (%q), %v", k, got, k.String(), err)
+		}
+	}
+	if got := SenderKey("whatsapp", "+15550001").String(); got != "whatsapp/+15550001" {
+		t.Fatalf("unexpected encoding %q", got)
+	}
+	if SenderKey("nostr", "abc") == SenderKey("nostr2", "abc") {
+		t.Fatalf("keys on different transports must differ")
+	}
+	for _, bad := range []string{"", "a/b/c/d/e", "%zz"} {
+		if _, err := ParseKey(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+	if err := (&Store{}).SaveActive(Key{}, "s"); err == nil {
+		t.Fatalf("expected error for empty key")
+	}
+}
+
+// legacyStore returns a store whose data predates structured keys.
+func legacyStore(t *testing.T, buckets map[string]map[string]string) *Store {
+	t.Helper()
+	st, cleanup := newTempStore(t)
+	t.Cleanup(cleanup)
+	err := st.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(bucketMeta); err != nil {
+			return err
+		}
+		for name, kv := range buckets {
+			for k, v := range kv {
+				if err := tx.Bucket([]byte(name)).Put([]byte(k), []byte(v)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	return st
+}
+
+func TestMigrateKeys(t *testing.T) {
+	session := `{"session_id":"s1"}`
+	st := legacyStore(t, map[string]map[string]string{
+		"active_sessions": {
+			"abcdef":         session,
+			"+15550001":      session,
+			"mystery-sender": session,
+		},
+		"cursors": {"abcdef": "2026-01-02T03:04:05Z"},
+	})
+	transportFor := func(s string) string {
+		switch {
+		case strings.HasPrefix(s, "+"):
+			return "whatsapp"
+		case s == "abcdef":
+			return "nostr"
+		}
+		return ""
+	}
+	rep, err := st.Migrate(MigrationEnv{TransportFor: transportFor}, false)
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if len(rep.Steps) != 1 || rep.Steps[0].Changed != 3 || len(rep.Steps[0].Notes) != 1 {
+		t.Fatalf("unexpected report %+v", rep)
+	}
+
+	for _, k := range []Key{SenderKey("nostr", "abcdef"), SenderKey("whatsapp", "+15550001")} {
+		if s, ok, err := st.Active(k); err != nil || !ok || s.SessionID != "s1" {
+			t.Fatalf("session %+v not migrated: %v %v", k, ok, err)
+		}
+	}
+	if ts, _ := st.LastCursor(SenderKey("nostr", "abcdef")); ts.IsZero() {
+		t.Fatalf("cursor not migrated")
+	}
+
+	// The sender no transport matched is held, not dropped, until one does.
+	if n, err := st.ReleaseHeld(transportFor); err != nil || n != 0 {
+		t.Fatalf("released %d keys with no transport: %v", n, err)
+	}
+	n, err := st.ReleaseHeld(func(s string) string {
+		if s == "mystery-sender" {
+			return "mock"
+		}
+		return transportFor(s)
+	})
+	if err != nil || n != 1 {
+		t.Fatalf("released %d keys: %v", n, err)
+	}
+	if s, ok, _ := st.Active(SenderKey("mock", "mystery-sender")); !ok || s.SessionID != "s1" {
+		t.Fatalf("held session not restored")
+	}
+	_ = st.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(bucketHeld) != nil {
+			t.Fatalf("held bucket left behind")
+		}
+		return nil
+	})
+
+	// Runs once: new-format keys are left alone afterwards.
+	if rep, err := st.Migrate(MigrationEnv{TransportFor: transportFor}, false); err != nil || rep.Pending() || len(rep.Steps) != 0 {
+		t.Fatalf("second run changed data: %+v %v", rep, err)
+	}
+	if _, ok, _ := st.Active(SenderKey("nostr", "abcdef")); !ok {
+		t.Fatalf("second run lost a session")
+	}
+}
+
+func TestNewStoreNeedsNoMigration(t *testing.T) {
+	st, cleanup := newTempStore(t)
+	defer cleanup()
+	_ = st.SaveActive(SenderKey("nostr", "abcdef"), "s1")
+	if rep, err := st.Migrate(MigrationEnv{}, false); err != nil || rep.Pending() || rep.Backup != "" {
+		t.Fatalf("fresh store migrated: %+v %v", rep, err)
+	}
+	if _, ok, _ := st.Active(SenderKey("nostr", "abcdef")); !ok {
+		t.Fatalf("session lost")
+	}
+}
@@ -0,0 +1,26 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimitStateRoundTrip(t *testing.T) {
+	st, cleanup := newTempStore(t)
+	defer cleanup()
+
+	if _, ok, err := st.LimitState(SenderKey("mock", "alice")); err != nil || ok {
+		t.Fatalf("expected no state, ok=%v err=%v", ok, err)
+	}
+	want := LimitState{Tokens: 2.5, RefilledAt: time.Now().UTC().Truncate(time.Second), Day: "2026-01-02", AgentSeconds: 90}
+	if err := st.SaveLimitState(SenderKey("mock", "alice"), want); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	got, ok, err := st.LimitState(SenderKey("mock", "alice"))
+	if err != nil || !ok {
+		t.Fatalf("load: ok=%v err=%v", ok, err)
+	}
+	if got.Tokens != want.Tokens || !got.RefilledAt.Equal(want.RefilledAt) || got.Day != want.Day || got.AgentSeconds != want.AgentSeconds {
+		t.Fatalf("unexpected state %+v", got)
+	}
+}
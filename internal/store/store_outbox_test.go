@@ -0,0 +1,57 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOutboxRetryAndDeadLetter(t *testing.T) {
+	st, cleanup := newTempStore(t)
+	defer cleanup()
+
+	now := time.Now().UTC()
+	id, err := st.EnqueueOutbox(OutboxEntry{Transport: "mock", Recipient: "alice", Text: "hi", Attempts: 1, NextAttempt: now.Add(time.Minute)})
+	if err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	if due, _ := st.DueOutbox(now, 10); len(due) != 0 {
+		t.Fatalf("entry should not be due yet: %+v", due)
+	}
+	if pending, err := st.PendingOutbox(); err != nil || len(pending) != 1 || pending[0].ID != id {
+		t.Fatalf("pending should list entries that are not due: %+v err=%v", pending, err)
+	}
+	due, err := st.DueOutbox(now.Add(2*time.Minute), 10)
+	if err != nil || len(due) != 1 || due[0].ID != id || due[0].Text != "hi" {
+		t.Fatalf("unexpected due entries %+v err=%v", due, err)
+	}
+
+	e := due[0]
+	e.Attempts, e.LastError = 5, "relay down"
+	if err := st.DeadLetter(e); err != nil {
+		t.Fatalf("dead letter: %v", err)
+	}
+	if due, _ := st.DueOutbox(now.Add(time.Hour), 10); len(due) != 0 {
+		t.Fatalf("dead letter still in outbox")
+	}
+	dead, err := st.DeadLetters()
+	if err != nil || len(dead) != 1 || dead[0].LastError != "relay down" {
+		t.Fatalf("unexpected dead letters %+v err=%v", dead, err)
+	}
+
+	replayed, err := st.ReplayDeadLetter(id)
+	if err != nil || replayed.Attempts != 0 {
+		t.Fatalf("replay: %+v err=%v", replayed, err)
+	}
+	if dead, _ := st.DeadLetters(); len(dead) != 0 {
+		t.Fatalf("dead letter not removed after replay")
+	}
+	if due, _ := st.DueOutbox(time.Now().UTC().Add(time.Second), 10); len(due) != 1 {
+		t.Fatalf("replayed entry not due")
+	}
+	if err := st.DeleteOutbox(id); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := st.ReplayDeadLetter("missing"); err == nil {
+		t.Fatalf("expected error replaying unknown id")
+	}
+}
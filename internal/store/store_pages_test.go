@@ -0,0 +1,31 @@
+package store
+
+import "testing"
+
+func TestPagesSaveAndPage(t *testing.T) {
+	st, cleanup := newTempStore(t)
+	defer cleanup()
+
+	if err := st.SavePages(SenderKey("mock", "alice"), []string{"p3", "p4", "p5"}); err != nil {
+		t.Fatalf("save pages: %v", err)
+	}
+	parts, left, err := st.NextPages(SenderKey("mock", "alice"), 2)
+	if err != nil || len(parts) != 2 || parts[0] != "p3" || left != 1 {
+		t.Fatalf("unexpected page %v left=%d err=%v", parts, left, err)
+	}
+	parts, left, _ = st.NextPages(SenderKey("mock", "alice"), 2)
+	if len(parts) != 1 || parts[0] != "p5" || left != 0 {
+		t.Fatalf("unexpected last page %v left=%d", parts, left)
+	}
+	if parts, _, _ := st.NextPages(SenderKey("mock", "alice"), 2); len(parts) != 0 {
+		t.Fatalf("expected no pages left, got %v", parts)
+	}
+
+	_ = st.SavePages(SenderKey("mock", "alice"), []string{"x"})
+	if err := st.SavePages(SenderKey("mock", "alice"), nil); err != nil {
+		t.Fatalf("clear pages: %v", err)
+	}
+	if parts, _, _ := st.NextPages(SenderKey("mock", "alice"), 1); len(parts) != 0 {
+		t.Fatalf("expected cleared pages, got %v", parts)
+	}
+}
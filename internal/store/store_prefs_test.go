@@ -0,0 +1,19 @@
+package store
+
+import "testing"
+
+func TestSenderPrefsRoundTrip(t *testing.T) {
+	st, cleanup := newTempStore(t)
+	defer cleanup()
+
+	if _, ok, err := st.SenderPrefs(SenderKey("mock", "alice")); err != nil || ok {
+		t.Fatalf("expected no prefs, ok=%v err=%v", ok, err)
+	}
+	if err := st.SaveSenderPrefs(SenderKey("mock", "alice"), SenderPrefs{Agent: "quick"}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	got, ok, err := st.SenderPrefs(SenderKey("mock", "alice"))
+	if err != nil || !ok || got.Agent != "quick" || got.UpdatedAt.IsZero() {
+		t.Fatalf("unexpected prefs %+v ok=%v err=%v", got, ok, err)
+	}
+}
@@ -0,0 +1,36 @@
+package store
+
+import "testing"
+
+func TestInboundQueueLifecycle(t *testing.T) {
+	st, cleanup := newTempStore(t)
+	defer cleanup()
+
+	first, err := st.EnqueueInbound(QueuedMessage{Transport: "mock", Sender: "alice", Text: "one"})
+	if err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	second, _ := st.EnqueueInbound(QueuedMessage{Transport: "mock", Sender: "bob", Text: "two"})
+	if err := st.MarkInboundRunning(first); err != nil {
+		t.Fatalf("mark running: %v", err)
+	}
+
+	pending, err := st.PendingInbound()
+	if err != nil || len(pending) != 2 {
+		t.Fatalf("expected 2 queued, got %d err=%v", len(pending), err)
+	}
+	if pending[0].ID != first || pending[0].State != InboundRunning || pending[0].Attempts != 1 {
+		t.Fatalf("unexpected first entry %+v", pending[0])
+	}
+	if pending[1].ID != second || pending[1].State != InboundPending || pending[1].Text != "two" {
+		t.Fatalf("unexpected second entry %+v", pending[1])
+	}
+
+	if err := st.CompleteInbound(first); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	pending, _ = st.PendingInbound()
+	if len(pending) != 1 || pending[0].ID != second {
+		t.Fatalf("expected only second left, got %+v", pending)
+	}
+}
@@ -1,5 +1,7 @@
 package imap
 
+import "github.com/joelklabo/buddy/internal/core"
+
 // Config for IMAP/SMTP transport.
 type Config struct {
 	ID       string `yaml:"id" json:"id"`
@@ -16,6 +18,12 @@ type Config struct {
 
 	AllowSenders []string `yaml:"allow_senders" json:"allow_senders"`
 	MaxBytes     int      `yaml:"max_bytes" json:"max_bytes"`
+	// MaxMessageBytes caps a whole message, attachments included, by its
+	// RFC822.SIZE; larger mail is flagged read without being downloaded.
+	MaxMessageBytes int `yaml:"max_message_bytes" json:"max_message_bytes"`
+
+	// Spool stores attachments; nil drops them. Set by the app.
+	Spool *core.Spool `yaml:"-" json:"-"`
 }
 
 func (c *Config) Defaults() {
@@ -37,6 +45,9 @@ func (c *Config) Defaults() {
 	if c.MaxBytes == 0 {
 		c.MaxBytes = 262144 // 256 KiB
 	}
+	if c.MaxMessageBytes == 0 {
+		c.MaxMessageBytes = 25 << 20 // 25 MiB, a common mail size limit
+	}
 }
 
 func (c *Config) Validate() error {
@@ -2,29 +2,43 @@ package imap
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/smtp"
+	"os"
 	"strings"
 	"time"
 
 	"github.com/emersion/go-imap"
 	imapclient "github.com/emersion/go-imap/client"
-	"github.com/emersion/go-message"
+	"github.com/emersion/go-message/mail"
 	"github.com/joelklabo/buddy/internal/core"
+	"github.com/joelklabo/buddy/internal/transports/email"
 )
 
 // Transport implements a polling IMAP receive + SMTP send.
 type Transport struct {
 	cfg Config
+	log *slog.Logger
+
+	// spooled remembers the attachments of mail already read, keyed by
+	// Message-Id, so refetching the folder does not spool them again.
+	spooled map[string][]core.Attachment
 }
 
-func New(cfg Config) (*Transport, error) {
+func New(cfg Config, logger *slog.Logger) (*Transport, error) {
 	cfg.Defaults()
 	if err := cfg.Validate(); err != nil {
 		return nil, err
 	}
-	return &Transport{cfg: cfg}, nil
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Transport{cfg: cfg, log: logger.With("transport", cfg.ID), spooled: map[string][]core.Attachment{}}, nil
 }
 
 func (t *Transport) ID() string { return t.cfg.ID }
@@ -64,58 +78,267 @@ func (t *Transport) pollOnce(ctx context.Context, inbound chan<- core.InboundMes
 	if _, err := c.Select(t.cfg.Folder, false); err != nil {
 		return err
 	}
+	return t.poll(ctx, c, inbound)
+}
+
+// envelope is what the first, header-only fetch learns about a message.
+type envelope struct {
+	uid  uint32
+	size uint32
+	env  *imap.Envelope
+}
+
+// poll hands the unread mail in the selected folder to the runner.
+func (t *Transport) poll(ctx context.Context, c *imapclient.Client, inbound chan<- core.InboundMessage) error {
+	// Only unread mail is fetched, and only read with BODY.PEEK: a message is
+	// flagged \Seen once the runner has taken it, so mail left in the folder is
+	// never run again however long the runner was down.
+	criteria := imap.NewSearchCriteria()
+	criteria.WithoutFlags = []string{imap.SeenFlag}
+	uids, err := c.UidSearch(criteria)
+	if err != nil || len(uids) == 0 {
+		return err
+	}
 
+	// Envelopes and sizes come first so mail from unknown senders is never
+	// downloaded and oversized mail is never spooled.
 	seqset := new(imap.SeqSet)
-	seqset.AddRange(1, 0)
-	messages := make(chan *imap.Message, 10)
+	seqset.AddNum(uids...)
+	envs := make(chan *imap.Message, 10)
 	done := make(chan error, 1)
 	go func() {
-		done <- c.Fetch(seqset, []imap.FetchItem{imap.FetchEnvelope, imap.FetchBody}, messages)
+		done <- c.UidFetch(seqset, []imap.FetchItem{imap.FetchUid, imap.FetchEnvelope, imap.FetchRFC822Size}, envs)
 	}()
-
-	for msg := range messages {
-		if msg.Envelope == nil {
-			continue
+	var pending []envelope
+	for msg := range envs {
+		if msg.Envelope != nil {
+			pending = append(pending, envelope{uid: msg.Uid, size: msg.Size, env: msg.Envelope})
 		}
+	}
+	if err := <-done; err != nil {
+		return err
+	}
+
+	// Mail from unknown senders stays unread for whoever else reads the
+	// folder. Mail from allowed senders that can never be run is flagged \Seen
+	// with the taken mail so it is not fetched again.
+	seen := new(imap.SeqSet)
+	var taken []string
+	section := &imap.BodySectionName{Peek: true}
+	for _, p := range pending {
 		from := ""
-		if len(msg.Envelope.From) > 0 {
-			from = msg.Envelope.From[0].Address()
-		}
-		var body strings.Builder
-		section := &imap.BodySectionName{}
-		if r := msg.GetBody(section); r != nil {
-			m, _ := message.Read(r)
-			if m != nil {
-				b, _ := io.ReadAll(m.Body)
-				body.Write(b)
-			}
+		if len(p.env.From) > 0 {
+			from = p.env.From[0].Address()
 		}
-
 		if !t.allowed(from) {
 			continue
 		}
-		if body.Len() > t.cfg.MaxBytes {
+		if p.size > uint32(t.cfg.MaxMessageBytes) {
+			t.log.Warn("dropping oversized message", "message_id", p.env.MessageId, "size", p.size, "max", t.cfg.MaxMessageBytes)
+			seen.AddNum(p.uid)
+			continue
+		}
+		r, err := fetchBody(c, p.uid, section)
+		if err != nil {
+			return err
+		}
+		if r == nil {
 			continue
 		}
+		m, err := readMessage(r, t.saver(p.env.MessageId))
+		if err != nil {
+			t.log.Warn("read message failed", "message_id", p.env.MessageId, "err", err)
+		}
+		if len(m.Text) > t.cfg.MaxBytes {
+			t.log.Warn("dropping message with oversized text", "message_id", p.env.MessageId, "len", len(m.Text), "max", t.cfg.MaxBytes)
+			seen.AddNum(p.uid)
+			continue
+		}
+		if m.Attachments != nil && p.env.MessageId != "" {
+			t.spooled[p.env.MessageId] = m.Attachments
+		}
+		// Mail without a Message-Id is identified by a hash of its headers, so
+		// the runner can still drop it if it is fetched again.
+		id := p.env.MessageId
+		if id == "" {
+			id = m.HeaderHash
+		}
 
-		inbound <- core.InboundMessage{
+		acked := make(chan error, 1)
+		select {
+		case inbound <- core.InboundMessage{
 			Transport: t.ID(),
 			Sender:    from,
-			Text:      body.String(),
-			ThreadID:  msg.Envelope.InReplyTo,
+			Text:      m.Text,
+			ThreadID:  email.ThreadRoot(m.References, p.env.InReplyTo, id),
+			MessageID: id,
 			Meta: map[string]any{
-				"subject":    msg.Envelope.Subject,
-				"message_id": msg.Envelope.MessageId,
+				"subject":    p.env.Subject,
+				"message_id": p.env.MessageId,
 			},
+			Attachments: m.Attachments,
+			Ack:         func(err error) { acked <- err },
+		}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		select {
+		case err := <-acked:
+			if err != nil {
+				t.log.Warn("runner did not take message; will refetch", "message_id", id, "err", err)
+				continue
+			}
+			seen.AddNum(p.uid)
+			taken = append(taken, p.env.MessageId)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if seen.Empty() {
+		return nil
+	}
+	if err := c.UidStore(seen, imap.FormatFlagsOp(imap.AddFlags, true), []interface{}{imap.SeenFlag}, nil); err != nil {
+		return err
+	}
+	// \Seen mail is never fetched again, so its spooled files need no reuse.
+	for _, id := range taken {
+		delete(t.spooled, id)
+	}
+	return nil
+}
+
+// fetchBody fetches the full message with uid, or nil if the server has none.
+func fetchBody(c *imapclient.Client, uid uint32, section *imap.BodySectionName) (imap.Literal, error) {
+	set := new(imap.SeqSet)
+	set.AddNum(uid)
+	msgs := make(chan *imap.Message, 1)
+	if err := c.UidFetch(set, []imap.FetchItem{imap.FetchUid, section.FetchItem()}, msgs); err != nil {
+		return nil, err
+	}
+	msg := <-msgs
+	if msg == nil {
+		return nil, nil
+	}
+	return msg.GetBody(section), nil
+}
+
+// errSkipAttachment is returned by savers for an attachment they leave out;
+// they log the reason themselves.
+var errSkipAttachment = errors.New("attachment skipped")
+
+// saver returns the function readMessage stores attachments with: the spool,
+// or the files already spooled for messageID when the folder is refetched.
+func (t *Transport) saver(messageID string) func(name, mimeType string, r io.Reader) (core.Attachment, error) {
+	if prev, ok := t.spooled[messageID]; ok && messageID != "" {
+		i := 0
+		return func(string, string, io.Reader) (core.Attachment, error) {
+			if i >= len(prev) {
+				return core.Attachment{}, errSkipAttachment
+			}
+			i++
+			if _, err := os.Stat(prev[i-1].Path); err != nil { // evicted from the spool
+				t.log.Warn("spooled attachment is gone", "path", prev[i-1].Path, "err", err)
+				return core.Attachment{}, errSkipAttachment
+			}
+			return prev[i-1], nil
+		}
+	}
+	if t.cfg.Spool == nil {
+		return func(name, _ string, _ io.Reader) (core.Attachment, error) {
+			t.log.Warn("dropping attachment; attachments are disabled", "name", name)
+			return core.Attachment{}, errSkipAttachment
+		}
+	}
+	return func(name, mimeType string, r io.Reader) (core.Attachment, error) {
+		att, err := t.cfg.Spool.Save(name, mimeType, r)
+		if err != nil {
+			t.log.Warn("spool attachment failed", "name", name, "err", err)
+			return core.Attachment{}, errSkipAttachment
 		}
+		return att, nil
 	}
-	return <-done
+}
+
+// message is the part of a fetched mail the transport uses.
+type message struct {
+	Text        string
+	Attachments []core.Attachment
+	References  string // raw References header
+	HeaderHash  string // "sha256:<hex>" over the header fields, for mail without a Message-Id
+}
+
+// readMessage returns the plain-text body of an RFC 5322 message and passes
+// each attachment to save, leaving out those save fails on. A message without a text/plain part yields the
+// first inline text part instead.
+func readMessage(r io.Reader, save func(name, mimeType string, r io.Reader) (core.Attachment, error)) (message, error) {
+	mr, err := mail.CreateReader(r)
+	if err != nil {
+		return message{}, err
+	}
+	m := message{References: mr.Header.Get("References"), HeaderHash: headerHash(mr.Header)}
+	var plain, other string
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			m.Text = firstNonEmpty(plain, other)
+			return m, err
+		}
+		switch h := p.Header.(type) {
+		case *mail.InlineHeader:
+			ct, _, _ := h.ContentType()
+			if !strings.HasPrefix(ct, "text/") {
+				continue
+			}
+			b, _ := io.ReadAll(p.Body)
+			if ct == "text/plain" && plain == "" {
+				plain = string(b)
+			} else if other == "" {
+				other = string(b)
+			}
+		case *mail.AttachmentHeader:
+			name, _ := h.Filename()
+			ct, _, _ := h.ContentType()
+			att, err := save(name, ct, p.Body)
+			if err != nil {
+				continue
+			}
+			m.Attachments = append(m.Attachments, att)
+		}
+	}
+	m.Text = firstNonEmpty(plain, other)
+	return m, nil
+}
+
+// headerHash fingerprints a message by its header fields in order.
+func headerHash(h mail.Header) string {
+	sum := sha256.New()
+	fields := h.Fields()
+	for fields.Next() {
+		fmt.Fprintf(sum, "%s: %s\n", fields.Key(), fields.Value())
+	}
+	return "sha256:" + hex.EncodeToString(sum.Sum(nil))
+}
+
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
 }
 
 func (t *Transport) Send(ctx context.Context, msg core.OutboundMessage) error {
 	auth := smtp.PlainAuth("", t.cfg.Username, t.cfg.Password, t.cfg.SMTPHost)
 	to := []string{msg.Recipient}
-	data := fmt.Sprintf("Subject: buddy reply\r\nIn-Reply-To: %s\r\n\r\n%s", msg.ThreadID, msg.Text)
+	header := "Subject: buddy reply\r\n"
+	if inReplyTo, references := email.ReplyHeaders(msg); inReplyTo != "" {
+		header += fmt.Sprintf("In-Reply-To: %s\r\nReferences: %s\r\n", inReplyTo, references)
+	}
+	data := header + "\r\n" + msg.Text
 	return smtp.SendMail(fmt.Sprintf("%s:%d", t.cfg.SMTPHost, t.cfg.SMTPPort), auth, t.cfg.Username, to, []byte(data))
 }
 
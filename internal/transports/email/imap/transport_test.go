@@ -0,0 +1,204 @@
+package imap
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend/memory"
+	imapclient "github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/server"
+	"github.com/joelklabo/buddy/internal/core"
+	"github.com/joelklabo/buddy/internal/transports/email"
+)
+
+const multipartMail = "From: alice@example.com\r\n" +
+	"Subject: logs\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=XX\r\n" +
+	"\r\n" +
+	"--XX\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"please check\r\n" +
+	"--XX\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"Content-Disposition: attachment; filename=\"app.log\"\r\n" +
+	"\r\n" +
+	"panic: nil map\r\n" +
+	"--XX--\r\n"
+
+func TestReadMessageSpoolsAttachments(t *testing.T) {
+	spool, err := core.NewSpool(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatalf("spool: %v", err)
+	}
+	m, err := readMessage(strings.NewReader(multipartMail), spool.Save)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	text, atts := m.Text, m.Attachments
+	if strings.TrimSpace(text) != "please check" {
+		t.Fatalf("unexpected text %q", text)
+	}
+	if len(atts) != 1 || atts[0].Name != "app.log" || atts[0].MIMEType != "text/plain" {
+		t.Fatalf("unexpected attachments %+v", atts)
+	}
+	if data, _ := os.ReadFile(atts[0].Path); strings.TrimSpace(string(data)) != "panic: nil map" {
+		t.Fatalf("spooled content %q", data)
+	}
+}
+
+func TestReadMessagePlainBody(t *testing.T) {
+	raw := "From: alice@example.com\r\nContent-Type: text/plain\r\n\r\nhello\r\n"
+	m, err := readMessage(strings.NewReader(raw), nil)
+	if err != nil || strings.TrimSpace(m.Text) != "hello" || m.Attachments != nil {
+		t.Fatalf("got %+v %v", m, err)
+	}
+}
+
+func TestSaverReusesSpooledAttachments(t *testing.T) {
+	spool, _ := core.NewSpool(t.TempDir(), 0, 0)
+	tr, err := New(Config{Host: "imap.example.com", Username: "u", Password: "p", AllowSenders: []string{"alice@example.com"}, Spool: spool}, nil)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	m, _ := readMessage(strings.NewReader(multipartMail), tr.saver("<m1>"))
+	first := m.Attachments
+	tr.spooled["<m1>"] = first
+	m, _ = readMessage(strings.NewReader(multipartMail), tr.saver("<m1>"))
+	again := m.Attachments
+	if len(again) != 1 || again[0].Path != first[0].Path {
+		t.Fatalf("expected spooled file reused, got %+v vs %+v", again, first)
+	}
+	entries, _ := os.ReadDir(spool.Dir())
+	if len(entries) != 1 {
+		t.Fatalf("expected one spooled file, got %d", len(entries))
+	}
+}
+
+func TestThreadRootStableAcrossReplies(t *testing.T) {
+	raw := "From: alice@example.com\r\nMessage-Id: <m3>\r\nIn-Reply-To: <m2>\r\nReferences: <m1> <m2>\r\n\r\nagain\r\n"
+	m, err := readMessage(strings.NewReader(raw), nil)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if got := email.ThreadRoot(m.References, "<m2>", "<m3>"); got != "<m1>" {
+		t.Fatalf("expected thread root <m1>, got %q", got)
+	}
+	if got := email.ThreadRoot("", "", "<m1>"); got != "<m1>" {
+		t.Fatalf("first message should root its thread, got %q", got)
+	}
+}
+
+func TestReadMessageHashesHeaders(t *testing.T) {
+	a := "From: alice@example.com\r\nSubject: one\r\nDate: Mon, 2 Jan 2006 15:04:05 +0000\r\n\r\nhi\r\n"
+	b := "From: alice@example.com\r\nSubject: two\r\nDate: Mon, 2 Jan 2006 15:04:05 +0000\r\n\r\nhi\r\n"
+	m1, _ := readMessage(strings.NewReader(a), nil)
+	again, _ := readMessage(strings.NewReader(a), nil)
+	m2, _ := readMessage(strings.NewReader(b), nil)
+	if !strings.HasPrefix(m1.HeaderHash, "sha256:") || m1.HeaderHash != again.HeaderHash {
+		t.Fatalf("hash not stable: %q %q", m1.HeaderHash, again.HeaderHash)
+	}
+	if m1.HeaderHash == m2.HeaderHash {
+		t.Fatalf("different mail hashed alike")
+	}
+}
+
+// memoryServer serves go-imap's in-memory backend (user "username", password
+// "password") and returns a client logged in and with INBOX selected.
+func memoryServer(t *testing.T) *imapclient.Client {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := server.New(memory.New())
+	s.AllowInsecureAuth = true
+	go func() { _ = s.Serve(l) }()
+	t.Cleanup(func() { _ = s.Close() })
+	c, err := imapclient.Dial(l.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { _ = c.Logout() })
+	if err := c.Login("username", "password"); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	return c
+}
+
+func TestPollSkipsUnknownAndOversizedMail(t *testing.T) {
+	c := memoryServer(t)
+	mails := []string{
+		"From: bob@example.com\r\nMessage-Id: <bob>\r\n\r\nhello\r\n",
+		"From: alice@example.com\r\nMessage-Id: <big>\r\n\r\n" + strings.Repeat("x", 2000) + "\r\n",
+		strings.Replace(multipartMail, "Subject: logs\r\n", "Subject: logs\r\nMessage-Id: <logs>\r\n", 1),
+	}
+	for _, m := range mails {
+		if err := c.Append("INBOX", nil, time.Now(), bytes.NewBufferString(m)); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+	if _, err := c.Select("INBOX", false); err != nil {
+		t.Fatalf("select: %v", err)
+	}
+
+	spool, _ := core.NewSpool(t.TempDir(), 0, 0)
+	tr, err := New(Config{Host: "imap.example.com", Username: "u", Password: "p", AllowSenders: []string{"alice@example.com"}, MaxMessageBytes: 1000, Spool: spool}, nil)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	inbound := make(chan core.InboundMessage)
+	got := make(chan core.InboundMessage, len(mails))
+	go func() {
+		for m := range inbound {
+			got <- m
+			m.Ack(nil)
+		}
+	}()
+	defer close(inbound)
+	if err := tr.poll(context.Background(), c, inbound); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	close(got)
+	var ids []string
+	for m := range got {
+		ids = append(ids, m.MessageID)
+		if len(m.Attachments) != 1 {
+			t.Fatalf("attachments not spooled: %+v", m.Attachments)
+		}
+	}
+	if len(ids) != 1 || ids[0] != "<logs>" {
+		t.Fatalf("delivered %v, want only <logs>", ids)
+	}
+	if len(tr.spooled) != 0 {
+		t.Fatalf("spooled entries kept after \\Seen: %v", tr.spooled)
+	}
+
+	// Only bob's mail is left unread; the oversized mail was flagged with the
+	// delivered one.
+	criteria := imap.NewSearchCriteria()
+	criteria.WithoutFlags = []string{imap.SeenFlag}
+	uids, err := c.UidSearch(criteria)
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(uids) != 1 {
+		t.Fatalf("unseen uids %v, want bob's only", uids)
+	}
+	msgs := make(chan *imap.Message, 1)
+	set := new(imap.SeqSet)
+	set.AddNum(uids...)
+	if err := c.UidFetch(set, []imap.FetchItem{imap.FetchEnvelope}, msgs); err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if m := <-msgs; m.Envelope.MessageId != "<bob>" {
+		t.Fatalf("unseen message %q, want <bob>", m.Envelope.MessageId)
+	}
+}
@@ -1,6 +1,10 @@
 package mailgun
 
-import "time"
+import (
+	"time"
+
+	"github.com/joelklabo/buddy/internal/core"
+)
 
 // Config holds Mailgun transport settings.
 type Config struct {
@@ -15,6 +19,9 @@ type Config struct {
 	AllowSenders []string      `yaml:"allow_senders" json:"allow_senders"`
 	MaxBytes     int           `yaml:"max_bytes" json:"max_bytes"`
 	Timeout      time.Duration `yaml:"timeout" json:"timeout"`
+
+	// Spool stores inbound attachments; nil drops them. Set by the app.
+	Spool *core.Spool `yaml:"-" json:"-"`
 }
 
 // Defaults fills missing optional fields.
@@ -1,14 +1,20 @@
 package mailgun
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
 	"net/http"
 	"net/url"
+	"os"
 	"strings"
 	"time"
 
 	"github.com/joelklabo/buddy/internal/core"
+	"github.com/joelklabo/buddy/internal/transports/email"
 	"sync/atomic"
 )
 
@@ -75,7 +81,12 @@ func (t *Transport) Start(ctx context.Context, inbound chan<- core.InboundMessag
 // Handler returns an http.Handler that processes Mailgun webhooks.
 func (t *Transport) Handler(inbound chan<- core.InboundMessage) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if err := r.ParseForm(); err != nil {
+		parse := r.ParseForm
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			// Mailgun posts messages with attachments as multipart forms.
+			parse = func() error { return r.ParseMultipartForm(32 << 20) }
+		}
+		if err := parse(); err != nil {
 			http.Error(w, "bad request", http.StatusBadRequest)
 			return
 		}
@@ -100,20 +111,19 @@ func (t *Transport) Handler(inbound chan<- core.InboundMessage) http.Handler {
 			return
 		}
 
-		thread := r.FormValue("In-Reply-To")
-		if thread == "" {
-			thread = r.FormValue("Message-Id")
-		}
+		thread := email.ThreadRoot(r.FormValue("References"), r.FormValue("In-Reply-To"), r.FormValue("Message-Id"))
 
 		inbound <- core.InboundMessage{
 			Transport: t.ID(),
 			Sender:    from,
 			Text:      text,
 			ThreadID:  thread,
+			MessageID: r.FormValue("Message-Id"),
 			Meta: map[string]any{
 				"subject":    r.FormValue("subject"),
 				"message_id": r.FormValue("Message-Id"),
 			},
+			Attachments: t.attachments(r),
 		}
 
 		t.lastOK.Store(time.Now())
@@ -122,15 +132,54 @@ func (t *Transport) Handler(inbound chan<- core.InboundMessage) http.Handler {
 	})
 }
 
+// attachments spools the files of a multipart webhook (Mailgun's
+// attachment-N fields). Files that cannot be stored are logged and skipped.
+func (t *Transport) attachments(r *http.Request) []core.Attachment {
+	if r.MultipartForm == nil || len(r.MultipartForm.File) == 0 {
+		return nil
+	}
+	if t.cfg.Spool == nil {
+		slog.Warn("mailgun: dropping attachments; attachments are disabled", "count", len(r.MultipartForm.File))
+		return nil
+	}
+	var atts []core.Attachment
+	for i := 1; ; i++ {
+		files := r.MultipartForm.File[fmt.Sprintf("attachment-%d", i)]
+		if len(files) == 0 {
+			break
+		}
+		for _, fh := range files {
+			f, err := fh.Open()
+			if err != nil {
+				slog.Warn("mailgun: open attachment failed", "name", fh.Filename, "err", err)
+				continue
+			}
+			att, err := t.cfg.Spool.Save(fh.Filename, fh.Header.Get("Content-Type"), f)
+			_ = f.Close()
+			if err != nil {
+				slog.Warn("mailgun: spool attachment failed", "name", fh.Filename, "err", err)
+				continue
+			}
+			atts = append(atts, att)
+		}
+	}
+	return atts
+}
+
+// SendsAttachments reports that replies carry their attachments.
+func (t *Transport) SendsAttachments() bool { return true }
+
 // Send uses Mailgun Messages API.
 func (t *Transport) Send(ctx context.Context, msg core.OutboundMessage) error {
+	inReplyTo, references := email.ReplyHeaders(msg)
 	return t.client.Send(ctx, SendRequest{
-		From:       "buddy@" + t.cfg.Domain,
-		To:         msg.Recipient,
-		Subject:    "buddy reply",
-		Text:       msg.Text,
-		InReplyTo:  msg.ThreadID,
-		References: msg.ThreadID,
+		From:        "buddy@" + t.cfg.Domain,
+		To:          msg.Recipient,
+		Subject:     "buddy reply",
+		Text:        msg.Text,
+		InReplyTo:   inReplyTo,
+		References:  references,
+		Attachments: msg.Attachments,
 	})
 }
 
@@ -178,6 +227,8 @@ type SendRequest struct {
 	Text       string
 	InReplyTo  string
 	References string
+
+	Attachments []core.Attachment // sent as multipart/form-data
 }
 
 func (c *Client) Send(ctx context.Context, req SendRequest) error {
@@ -197,12 +248,21 @@ func (c *Client) Send(ctx context.Context, req SendRequest) error {
 	ctx, cancel := context.WithTimeout(ctx, c.timeout)
 	defer cancel()
 
+	body, contentType := io.Reader(strings.NewReader(form.Encode())), "application/x-www-form-urlencoded"
+	if len(req.Attachments) > 0 {
+		buf, ct, err := multipartBody(form, req.Attachments)
+		if err != nil {
+			return core.Permanent(err)
+		}
+		body, contentType = buf, ct
+	}
+
 	endpoint := c.baseURL + "/" + c.domain + "/messages"
-	reqHTTP, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	reqHTTP, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, body)
 	if err != nil {
 		return err
 	}
-	reqHTTP.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	reqHTTP.Header.Set("Content-Type", contentType)
 	reqHTTP.SetBasicAuth("api", c.apiKey)
 
 	resp, err := http.DefaultClient.Do(reqHTTP)
@@ -211,7 +271,39 @@ func (c *Client) Send(ctx context.Context, req SendRequest) error {
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode >= 300 {
-		return fmt.Errorf("mailgun send failed: %s", resp.Status)
+		return core.HTTPError(resp.StatusCode, fmt.Errorf("mailgun send failed: %s", resp.Status))
 	}
 	return nil
 }
+
+// multipartBody encodes form and atts (as "attachment" parts) for the messages
+// endpoint.
+func multipartBody(form url.Values, atts []core.Attachment) (*bytes.Buffer, string, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for k, vs := range form {
+		for _, v := range vs {
+			if err := mw.WriteField(k, v); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+	for _, a := range atts {
+		f, err := os.Open(a.Path)
+		if err != nil {
+			return nil, "", fmt.Errorf("attachment %s: %w", a.Name, err)
+		}
+		part, err := mw.CreateFormFile("attachment", a.Name)
+		if err == nil {
+			_, err = io.Copy(part, f)
+		}
+		_ = f.Close()
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, "", err
+	}
+	return &buf, mw.FormDataContentType(), nil
+}
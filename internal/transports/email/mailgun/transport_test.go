@@ -1,12 +1,17 @@
 package mailgun
 
 import (
+	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -66,6 +71,9 @@ func TestHandlerAcceptsValidRequest(t *testing.T) {
 		if msg.Sender != "alice@example.com" {
 			t.Fatalf("unexpected sender: %s", msg.Sender)
 		}
+		if msg.MessageID != "<m1>" {
+			t.Fatalf("unexpected message id: %q", msg.MessageID)
+		}
 	case <-time.After(time.Second):
 		t.Fatalf("no inbound message received")
 	}
@@ -120,3 +128,82 @@ func hmacSha(timestamp, token, key string) string {
 	mac.Write([]byte(token))
 	return hex.EncodeToString(mac.Sum(nil))
 }
+
+func TestHandlerSpoolsAttachments(t *testing.T) {
+	spool, err := core.NewSpool(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatalf("spool: %v", err)
+	}
+	tr, err := New(Config{
+		Domain:       "mg.example.com",
+		APIKey:       "test-api",
+		SigningKey:   "test-key",
+		AllowSenders: []string{"alice@example.com"},
+		Spool:        spool,
+	})
+	if err != nil {
+		t.Fatalf("new transport: %v", err)
+	}
+	inbound := make(chan core.InboundMessage, 1)
+	ts := httptest.NewServer(tr.Handler(inbound))
+	t.Cleanup(ts.Close)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fields := map[string]string{
+		"timestamp":        "1700000000",
+		"token":            "abcdef",
+		"signature":        hmacHex("1700000000", "abcdef", "test-key"),
+		"sender":           "alice@example.com",
+		"stripped-text":    "see log",
+		"attachment-count": "1",
+	}
+	for k, v := range fields {
+		_ = mw.WriteField(k, v)
+	}
+	fw, _ := mw.CreateFormFile("attachment-1", "build.log")
+	_, _ = fw.Write([]byte("error: boom"))
+	_ = mw.Close()
+
+	resp, err := http.Post(ts.URL, mw.FormDataContentType(), &body)
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", resp.StatusCode)
+	}
+	msg := <-inbound
+	if len(msg.Attachments) != 1 || msg.Attachments[0].Name != "build.log" || msg.Attachments[0].Size != 11 {
+		t.Fatalf("unexpected attachments %+v", msg.Attachments)
+	}
+	if data, _ := os.ReadFile(msg.Attachments[0].Path); string(data) != "error: boom" {
+		t.Fatalf("spooled content %q", data)
+	}
+}
+
+func TestClientSendsAttachmentsAsMultipart(t *testing.T) {
+	var got *multipart.Form
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("parse multipart: %v", err)
+		}
+		got = r.MultipartForm
+	}))
+	t.Cleanup(srv.Close)
+
+	path := filepath.Join(t.TempDir(), "out.txt")
+	if err := os.WriteFile(path, []byte("result"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient(srv.URL, "mg.example.com", "key", time.Second)
+	err := c.Send(context.Background(), SendRequest{
+		From: "buddy@mg.example.com", To: "alice@example.com", Text: "here",
+		Attachments: []core.Attachment{{Name: "out.txt", Path: path}},
+	})
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if got == nil || got.Value["text"][0] != "here" || len(got.File["attachment"]) != 1 || got.File["attachment"][0].Filename != "out.txt" {
+		t.Fatalf("unexpected form %+v", got)
+	}
+}
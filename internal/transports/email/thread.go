@@ -0,0 +1,37 @@
+// Package email holds the threading rules shared by the mail transports.
+package email
+
+import (
+	"strings"
+
+	"github.com/joelklabo/buddy/internal/core"
+)
+
+// ThreadRoot identifies a mail thread by its first message: the first
+// References entry, else In-Reply-To, else the message itself. Every reply in a
+// thread yields the same ID, so thread-scoped sessions hold across it.
+func ThreadRoot(references, inReplyTo, messageID string) string {
+	if refs := strings.Fields(references); len(refs) > 0 {
+		return refs[0]
+	}
+	if inReplyTo != "" {
+		return inReplyTo
+	}
+	return messageID
+}
+
+// ReplyHeaders returns the In-Reply-To and References values for a reply. The
+// transports put the inbound Message-Id in Meta["message_id"]; the reply
+// answers that message and references the thread root before it. Replies
+// without one fall back to the thread root alone.
+func ReplyHeaders(msg core.OutboundMessage) (inReplyTo, references string) {
+	parent, _ := msg.Meta["message_id"].(string)
+	switch {
+	case parent == "":
+		return msg.ThreadID, msg.ThreadID
+	case msg.ThreadID == "" || msg.ThreadID == parent:
+		return parent, parent
+	default:
+		return parent, msg.ThreadID + " " + parent
+	}
+}
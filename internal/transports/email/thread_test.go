@@ -0,0 +1,31 @@
+package email
+
+import (
+	"testing"
+
+	"github.com/joelklabo/buddy/internal/core"
+)
+
+func TestThreadRootPrefersReferences(t *testing.T) {
+	if got := ThreadRoot("<root> <m2>", "<m2>", "<m3>"); got != "<root>" {
+		t.Fatalf("expected <root>, got %q", got)
+	}
+	if got := ThreadRoot("", "<m2>", "<m3>"); got != "<m2>" {
+		t.Fatalf("expected In-Reply-To, got %q", got)
+	}
+	if got := ThreadRoot("", "", "<m1>"); got != "<m1>" {
+		t.Fatalf("expected Message-Id, got %q", got)
+	}
+}
+
+func TestReplyHeadersAnswerInboundMessage(t *testing.T) {
+	msg := core.OutboundMessage{ThreadID: "<m1>", Meta: map[string]any{"message_id": "<m3>"}}
+	irt, refs := ReplyHeaders(msg)
+	if irt != "<m3>" || refs != "<m1> <m3>" {
+		t.Fatalf("unexpected headers %q %q", irt, refs)
+	}
+	irt, refs = ReplyHeaders(core.OutboundMessage{ThreadID: "<m1>"})
+	if irt != "<m1>" || refs != "<m1>" {
+		t.Fatalf("expected thread root fallback, got %q %q", irt, refs)
+	}
+}
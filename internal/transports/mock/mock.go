@@ -26,6 +26,9 @@ func New(id string) *Transport {
 
 func (t *Transport) ID() string { return t.id }
 
+// SendsAttachments reports that outbound attachments are passed through as is.
+func (t *Transport) SendsAttachments() bool { return true }
+
 func (t *Transport) Start(ctx context.Context, in chan<- core.InboundMessage) error {
 	for {
 		select {
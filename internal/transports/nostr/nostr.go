@@ -13,6 +13,7 @@ import (
 
 // Config holds the parameters needed to run the Nostr transport.
 type Config struct {
+	ID             string // transport ID; defaults to "nostr"
 	Relays         []string
 	PrivateKey     string
 	AllowedPubkeys []string
@@ -27,7 +28,7 @@ type Transport struct {
 }
 
 type nostrClient interface {
-	Listen(ctx context.Context, handler func(context.Context, client.IncomingMessage)) error
+	Listen(ctx context.Context, handler func(context.Context, client.IncomingMessage) error) error
 	SendReply(ctx context.Context, toPubKey string, message string) error
 }
 
@@ -40,8 +41,12 @@ func New(cfg Config, st *store.Store) (*Transport, error) {
 	if err != nil {
 		return nil, fmt.Errorf("derive pubkey: %w", err)
 	}
+	if cfg.ID == "" {
+		cfg.ID = "nostr"
+	}
 	c := client.New(cfg.PrivateKey, pub, cfg.Relays, cfg.AllowedPubkeys, st)
-	return &Transport{cfg: cfg, store: st, client: c, id: "nostr"}, nil
+	c.SetTransportID(cfg.ID)
+	return &Transport{cfg: cfg, store: st, client: c, id: cfg.ID}, nil
 }
 
 // ID returns transport identifier.
@@ -49,12 +54,30 @@ func (t *Transport) ID() string { return t.id }
 
 // Start subscribes to Nostr DMs and pushes inbound messages.
 func (t *Transport) Start(ctx context.Context, inbound chan<- core.InboundMessage) error {
-	handler := func(msgCtx context.Context, msg client.IncomingMessage) {
-		inbound <- core.InboundMessage{
+	// The client marks an event processed only after the runner has persisted it,
+	// so a crash in between redelivers it instead of losing it.
+	handler := func(msgCtx context.Context, msg client.IncomingMessage) error {
+		acked := make(chan error, 1)
+		im := core.InboundMessage{
 			Transport: t.id,
 			Sender:    msg.SenderPubKey,
 			Text:      msg.Plaintext,
 			ThreadID:  msg.SenderPubKey,
+			Ack:       func(err error) { acked <- err },
+		}
+		if msg.Event != nil {
+			im.MessageID = msg.Event.ID
+		}
+		select {
+		case inbound <- im:
+		case <-msgCtx.Done():
+			return msgCtx.Err()
+		}
+		select {
+		case err := <-acked:
+			return err
+		case <-msgCtx.Done():
+			return msgCtx.Err()
 		}
 	}
 	return t.client.Listen(ctx, handler)
@@ -63,7 +86,7 @@ func (t *Transport) Start(ctx context.Context, inbound chan<- core.InboundMessag
 // Send delivers a DM reply back to sender.
 func (t *Transport) Send(ctx context.Context, msg core.OutboundMessage) error {
 	if msg.Recipient == "" {
-		return fmt.Errorf("nostr recipient missing")
+		return core.Permanent(fmt.Errorf("nostr recipient missing"))
 	}
 	return t.client.SendReply(ctx, msg.Recipient, msg.Text)
 }
@@ -35,10 +35,16 @@ type stubClient struct {
 	listenErr error
 	sendErr   error
 	called    bool
+
+	deliver    *client.IncomingMessage // handed to the handler by Listen
+	handlerErr error                   // what the handler returned for deliver
 }
 
-func (s *stubClient) Listen(ctx context.Context, handler func(context.Context, client.IncomingMessage)) error {
+func (s *stubClient) Listen(ctx context.Context, handler func(context.Context, client.IncomingMessage) error) error {
 	s.called = true
+	if s.deliver != nil {
+		s.handlerErr = handler(ctx, *s.deliver)
+	}
 	return s.listenErr
 }
 
@@ -84,3 +90,22 @@ func TestStartReturnsClientError(t *testing.T) {
 		t.Fatalf("unexpected err: %v", err)
 	}
 }
+
+func TestStartReportsRunnerAck(t *testing.T) {
+	priv := nostr.GeneratePrivateKey()
+	st, _ := store.New(t.TempDir() + "/state.db")
+	defer func() { _ = st.Close() }()
+	tr, _ := New(Config{PrivateKey: priv}, st)
+	sc := &stubClient{deliver: &client.IncomingMessage{SenderPubKey: "bob", Plaintext: "hi"}}
+	tr.client = sc
+
+	inbound := make(chan core.InboundMessage)
+	go func() {
+		msg := <-inbound
+		msg.Ack(errors.New("queue write failed"))
+	}()
+	_ = tr.Start(context.Background(), inbound)
+	if sc.handlerErr == nil || sc.handlerErr.Error() != "queue write failed" {
+		t.Fatalf("handler should report the runner's ack, got %v", sc.handlerErr)
+	}
+}
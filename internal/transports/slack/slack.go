@@ -33,5 +33,5 @@ func (t *Transport) Start(ctx context.Context, inbound chan<- core.InboundMessag
 }
 
 func (t *Transport) Send(ctx context.Context, msg core.OutboundMessage) error {
-	return errors.New("slack transport not implemented")
+	return core.Permanent(errors.New("slack transport not implemented"))
 }
@@ -10,10 +10,12 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"mime"
 	"net"
 	"net/http"
 	"net/url"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -33,12 +35,17 @@ type Config struct {
 	AllowedNumbers []string `json:"allowed_numbers"`
 	SignatureKey   string   `json:"signature_key"` // optional; falls back to AuthToken
 	BaseURL        string   `json:"base_url"`      // optional Twilio API base override for tests
+
+	// Spool stores inbound media (MediaUrlN); nil drops it. Set by the app.
+	Spool *core.Spool `json:"-"`
 }
 
 type Transport struct {
 	cfg Config
 	log *slog.Logger
 
+	media *http.Client // bounds each media download
+
 	addrMu sync.RWMutex
 	addr   string
 }
@@ -65,11 +72,14 @@ func New(cfg Config, logger *slog.Logger) (*Transport, error) {
 	if logger == nil {
 		logger = slog.Default()
 	}
-	return &Transport{cfg: cfg, log: logger.With("transport", "whatsapp")}, nil
+	return &Transport{cfg: cfg, log: logger.With("transport", "whatsapp"), media: &http.Client{Timeout: mediaTimeout}}, nil
 }
 
 func (t *Transport) ID() string { return t.cfg.ID }
 
+// MaxReplyChars reports Twilio's WhatsApp body limit so the runner splits longer replies.
+func (t *Transport) MaxReplyChars() int { return 1600 }
+
 func (t *Transport) Start(ctx context.Context, inbound chan<- core.InboundMessage) error {
 	mux := http.NewServeMux()
 	mux.HandleFunc(t.cfg.Path, func(w http.ResponseWriter, r *http.Request) {
@@ -97,7 +107,23 @@ func (t *Transport) Start(ctx context.Context, inbound chan<- core.InboundMessag
 			Transport: t.ID(),
 			Sender:    from,
 			Text:      body,
-			ThreadID:  msgID,
+			// WhatsApp chats have no threads; ThreadID stays empty so sessions and
+			// history follow the sender under every scope.
+			MessageID: msgID, // Twilio retries a webhook with the same MessageSid
+		}
+		if n, _ := strconv.Atoi(r.Form.Get("NumMedia")); n > 0 {
+			// Twilio gives up on a webhook after about 15 s, well inside the
+			// media timeout, so media is fetched after acknowledging it.
+			w.WriteHeader(http.StatusOK)
+			form := r.Form
+			go func() {
+				im.Attachments = t.fetchMedia(ctx, form, msgID)
+				select {
+				case inbound <- im:
+				case <-ctx.Done():
+				}
+			}()
+			return
 		}
 		select {
 		case inbound <- im:
@@ -141,6 +167,87 @@ func (t *Transport) Addr() string {
 	return t.addr
 }
 
+// mediaTimeout bounds one media download.
+const mediaTimeout = 60 * time.Second
+
+// fetchMedia downloads the NumMedia files Twilio attached to a message into the
+// spool, keyed by MessageSid so a retried webhook reuses files already fetched.
+// Files that fail to download are logged and skipped.
+func (t *Transport) fetchMedia(ctx context.Context, form url.Values, msgID string) []core.Attachment {
+	n, _ := strconv.Atoi(form.Get("NumMedia"))
+	if n <= 0 {
+		return nil
+	}
+	if t.cfg.Spool == nil {
+		t.log.Warn("dropping media; attachments are disabled", "count", n)
+		return nil
+	}
+	var atts []core.Attachment
+	for i := 0; i < n; i++ {
+		mediaURL := form.Get(fmt.Sprintf("MediaUrl%d", i))
+		if mediaURL == "" {
+			continue
+		}
+		mimeType := form.Get(fmt.Sprintf("MediaContentType%d", i))
+		name := mediaName(msgID, i, mimeType)
+		if msgID != "" {
+			if att, ok := t.cfg.Spool.Saved(msgID, name, mimeType); ok {
+				atts = append(atts, att)
+				continue
+			}
+		}
+		att, err := t.download(ctx, mediaURL, msgID, name, mimeType)
+		if err != nil {
+			t.log.Warn("media download failed", "url", mediaURL, "err", err)
+			continue
+		}
+		atts = append(atts, att)
+	}
+	return atts
+}
+
+func (t *Transport) download(ctx context.Context, mediaURL, msgID, name, mimeType string) (core.Attachment, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, mediaURL, nil)
+	if err != nil {
+		return core.Attachment{}, err
+	}
+	req.SetBasicAuth(t.cfg.AccountSID, t.cfg.AuthToken)
+	client := t.media
+	if client == nil {
+		client = &http.Client{Timeout: mediaTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return core.Attachment{}, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode >= 300 {
+		return core.Attachment{}, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	if msgID == "" {
+		return t.cfg.Spool.Save(name, mimeType, resp.Body)
+	}
+	return t.cfg.Spool.SaveAs(msgID, name, mimeType, resp.Body)
+}
+
+// commonExt picks the usual extension where mime lists several.
+var commonExt = map[string]string{"image/jpeg": ".jpg", "audio/mpeg": ".mp3", "text/plain": ".txt"}
+
+// mediaName names a media file after its message, since Twilio does not send
+// the original file name.
+func mediaName(msgID string, i int, mimeType string) string {
+	ext := commonExt[mimeType]
+	if exts, _ := mime.ExtensionsByType(mimeType); ext == "" && len(exts) > 0 {
+		ext = exts[0]
+	}
+	if msgID == "" {
+		msgID = "media"
+	}
+	return fmt.Sprintf("%s-%d%s", msgID, i, ext)
+}
+
 func (t *Transport) Send(ctx context.Context, msg core.OutboundMessage) error {
 	form := url.Values{}
 	form.Set("To", "whatsapp:"+msg.Recipient)
@@ -163,7 +270,7 @@ func (t *Transport) Send(ctx context.Context, msg core.OutboundMessage) error {
 	}()
 	if resp.StatusCode >= 300 {
 		b, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("twilio send failed: %s", strings.TrimSpace(string(b)))
+		return core.HTTPError(resp.StatusCode, fmt.Errorf("twilio send failed: %s", strings.TrimSpace(string(b))))
 	}
 	return nil
 }
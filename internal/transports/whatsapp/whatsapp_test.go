@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
 	"sort"
 	"strings"
 	"testing"
@@ -75,7 +76,7 @@ func TestWebhookInbound(t *testing.T) {
 
 	select {
 	case m := <-inbound:
-		if m.Text != "hello wa" || m.Sender != "15555550100" {
+		if m.Text != "hello wa" || m.Sender != "15555550100" || m.MessageID != "SM123" || m.ThreadID != "" {
 			t.Fatalf("bad message %+v", m)
 		}
 	case <-time.After(2 * time.Second):
@@ -191,3 +192,115 @@ func TestContainsHelper(t *testing.T) {
 		t.Fatalf("should not contain")
 	}
 }
+
+func TestFetchMediaSpoolsFiles(t *testing.T) {
+	var fetches int
+	media := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		if user, pass, ok := r.BasicAuth(); !ok || user != "AC123" || pass != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = io.WriteString(w, "png-bytes")
+	}))
+	defer media.Close()
+
+	spool, err := core.NewSpool(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatalf("spool: %v", err)
+	}
+	tr, _ := New(Config{AccountSID: "AC123", AuthToken: "token", FromNumber: "whatsapp:+1", Spool: spool}, nil)
+	form := url.Values{
+		"NumMedia":          {"2"},
+		"MediaUrl0":         {media.URL + "/m0"},
+		"MediaContentType0": {"image/png"},
+		"MediaUrl1":         {"http://127.0.0.1:1/unreachable"},
+	}
+	atts := tr.fetchMedia(context.Background(), form, "SM1")
+	if len(atts) != 1 {
+		t.Fatalf("expected one attachment, got %+v", atts)
+	}
+	a := atts[0]
+	if a.Name != "SM1-0.png" || a.MIMEType != "image/png" || a.Size != int64(len("png-bytes")) {
+		t.Fatalf("unexpected attachment %+v", a)
+	}
+	if data, err := os.ReadFile(a.Path); err != nil || string(data) != "png-bytes" {
+		t.Fatalf("spooled file %q, %v", data, err)
+	}
+
+	// A retried webhook for the same MessageSid reuses the spooled file.
+	again := tr.fetchMedia(context.Background(), form, "SM1")
+	if fetches != 1 || len(again) != 1 || again[0].Path != a.Path {
+		t.Fatalf("retry re-downloaded media: fetches=%d atts=%+v", fetches, again)
+	}
+}
+
+func TestWebhookAcksBeforeFetchingMedia(t *testing.T) {
+	release := make(chan struct{})
+	media := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		_, _ = io.WriteString(w, "png-bytes")
+	}))
+	defer media.Close()
+	defer func() {
+		select {
+		case <-release:
+		default:
+			close(release)
+		}
+	}()
+
+	spool, _ := core.NewSpool(t.TempDir(), 0, 0)
+	cfg := Config{AccountSID: "AC123", AuthToken: "token", FromNumber: "whatsapp:+1", Listen: "127.0.0.1:0", Spool: spool}
+	tr, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	inbound := make(chan core.InboundMessage, 1)
+	go func() { _ = tr.Start(ctx, inbound) }()
+	deadline := time.Now().Add(2 * time.Second)
+	for tr.Addr() == "" && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	form := url.Values{
+		"From":              {"whatsapp:+15550001"},
+		"MessageSid":        {"SM9"},
+		"NumMedia":          {"1"},
+		"MediaUrl0":         {media.URL + "/m0"},
+		"MediaContentType0": {"image/png"},
+	}
+	rawURL := "http://" + tr.Addr() + "/twilio/webhook"
+	req, _ := http.NewRequest(http.MethodPost, rawURL, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Twilio-Signature", signFor(rawURL, form, ""))
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("webhook waited for the media download: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+
+	close(release)
+	select {
+	case m := <-inbound:
+		if m.MessageID != "SM9" || len(m.Attachments) != 1 || m.Attachments[0].Name != "SM9-0.png" {
+			t.Fatalf("bad message %+v", m)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("no message after the media arrived")
+	}
+}
+
+func TestFetchMediaWithoutSpool(t *testing.T) {
+	tr, _ := New(Config{AccountSID: "AC123", AuthToken: "token", FromNumber: "whatsapp:+1"}, nil)
+	form := url.Values{"NumMedia": {"1"}, "MediaUrl0": {"http://127.0.0.1:1/m"}}
+	if atts := tr.fetchMedia(context.Background(), form, "SM1"); atts != nil {
+		t.Fatalf("expected media dropped, got %+v", atts)
+	}
+}